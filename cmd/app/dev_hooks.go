@@ -40,6 +40,7 @@ func createTempUser(repo db.Repository) {
 		ID:             uuid.NewString(),
 		Username:       username,
 		HashedPassword: string(hashedPassword),
+		Role:           models.RoleAdmin,
 	}
 
 	if err := repo.CreateUser(ctx, user); err != nil {
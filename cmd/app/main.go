@@ -10,14 +10,12 @@ import (
 	"patrol-cloud/internal/background"
 	"patrol-cloud/internal/config"
 	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/queue"
 	//"patrol-cloud/internal/models"
 	"patrol-cloud/internal/services"
 	"patrol-cloud/internal/storage"
-	"patrol-cloud/internal/tasks"
 	"syscall"
 	"time"
-
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 	//"github.com/gin-gonic/gin"
 	//"github.com/google/uuid"
 	//"golang.org/x/crypto/bcrypt"
@@ -46,23 +44,62 @@ func main() {
 	// (为测试添加一个临时用户)
 	createTempUser(repo)
 
-	minioClient, err := storage.NewMinIOClient(cfg.MinIOEndpoint, cfg.MinIOAccessKey, cfg.MinIOSecretKey, false)
-	if err != nil {
-		log.Fatalf("Failed to initialize MinIO client: %v", err)
+	var objectStore storage.ObjectStore
+	switch cfg.StorageBackend {
+	case "local":
+		objectStore, err = storage.NewLocalStore(cfg.LocalStorageDir, cfg.LocalStorageBaseURL, []byte(cfg.JWTSecret))
+		if err != nil {
+			log.Fatalf("Failed to initialize local object store: %v", err)
+		}
+		log.Println("Local object store initialized.")
+	default:
+		objectStore, err = storage.NewMinIOClient(cfg.MinIOEndpoint, cfg.MinIOAccessKey, cfg.MinIOSecretKey, false)
+		if err != nil {
+			log.Fatalf("Failed to initialize MinIO client: %v", err)
+		}
+		log.Println("MinIO client initialized.")
 	}
-	log.Println("MinIO client initialized.")
 
-	opts := mqtt.NewClientOptions().AddBroker(cfg.EMQXHost).SetClientID("patrol-cloud-server")
-	mqttClient := mqtt.NewClient(opts)
-	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
-		log.Fatalf("Failed to connect to MQTT broker: %v", token.Error())
+	// MQTT 连接在监听器注册订阅之后再建立 (见下文)，断线后自动重连并重新订阅
+	mqttConn, err := background.NewMQTTConnection(background.MQTTOptions{
+		Broker:               cfg.EMQXHost,
+		Username:             cfg.MQTTUsername,
+		Password:             cfg.MQTTPassword,
+		ClientID:             cfg.MQTTClientID,
+		ClientIDPrefix:       cfg.MQTTClientIDPrefix,
+		CACertFile:           cfg.MQTTCACertFile,
+		ClientCertFile:       cfg.MQTTClientCertFile,
+		ClientKeyFile:        cfg.MQTTClientKeyFile,
+		CleanSession:         cfg.MQTTCleanSession,
+		KeepAlive:            cfg.MQTTKeepAlive,
+		ConnectTimeout:       cfg.MQTTConnectTimeout,
+		MaxReconnectInterval: cfg.MQTTMaxReconnectInterval,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize MQTT client: %v", err)
 	}
-	defer mqttClient.Disconnect(250)
-	log.Println("MQTT client initialized.")
+	defer mqttConn.Disconnect(250)
+	mqttClient := mqttConn.Client()
+	log.Printf("MQTT client initialized with client ID %s.", mqttConn.ClientID())
 
-	// 初始化失败任务队列
-	failedTaskQueue := tasks.NewFileQueue("failed_tasks.log")
-	log.Println("Failed task queue initialized.")
+	// 初始化持久化后台任务队列
+	taskQueue, err := queue.Open(cfg.TaskQueueDir, queue.Options{MaxAttempts: cfg.TaskQueueMaxAttempts})
+	if err != nil {
+		log.Fatalf("Failed to open task queue: %v", err)
+	}
+	defer taskQueue.Close()
+	// 旧版本写入的失败任务文件，死信文件中的任务保持死信状态
+	for legacy, state := range map[string]queue.TaskState{
+		"failed_tasks.log":      queue.StatePending,
+		"failed_tasks.dead.log": queue.StateDead,
+	} {
+		if n, err := services.ImportLegacyFailedTasks(taskQueue, legacy, state); err != nil {
+			log.Printf("WARN: Failed to import legacy failed tasks from %s: %v", legacy, err)
+		} else if n > 0 {
+			log.Printf("Imported %d legacy failed tasks from %s as %s.", n, legacy, state)
+		}
+	}
+	log.Println("Task queue initialized.")
 
 	// --- 3. 服务和后台任务初始化 ---
 	telemetryHub := services.NewTelemetryHub()
@@ -76,18 +113,131 @@ func main() {
 
 	llmService := services.NewLLMService(cfg.LLMApiKey, cfg.LLMBaseURL)
 	authService := services.NewAuthService(repo, []byte(cfg.JWTSecret))
-	commandService := services.NewCommandService(mqttClient)
-	decisionService := services.NewDecisionService(aiService, repo, minioClient, failedTaskQueue)
+	commandService := services.NewCommandService(mqttClient, repo)
+	decisionService := services.NewDecisionService(aiService, repo, objectStore, taskQueue)
+
+	imageSpool, err := services.NewImageSpool(cfg.ImageSpoolDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize image spool: %v", err)
+	}
+	decisionService.EnableImageSpool(imageSpool)
+	if cfg.OutboxEnabled {
+		decisionService.EnableOutbox()
+	}
+
+	uploadLimits := services.DefaultUploadLimits
+	uploadLimits.MaxImageBytes = cfg.DecisionMaxImageBytes
+	uploadLimits.MaxDimension = cfg.DecisionMaxDimension
+	decisionService.SetUploadLimits(uploadLimits)
+
+	inferencePool := services.NewInferencePool(cfg.InferenceWorkers, cfg.InferenceQueueSize)
+	decisionService.UseInferencePool(inferencePool, cfg.DecisionDefaultTimeout, cfg.DecisionMaxTimeout)
+	log.Printf("Inference pool started with %d workers (queue size %d).", cfg.InferenceWorkers, cfg.InferenceQueueSize)
+	decisionService.LimitDecodes(cfg.DecodeWorkers)
+
+	if cfg.DedupEnabled {
+		decisionService.EnableDeduplication(services.DedupOptions{
+			MaxDistance: cfg.DedupMaxDistance,
+			Window:      cfg.DedupWindow,
+		})
+		log.Printf("Decision deduplication enabled (max distance %d, window %s).", cfg.DedupMaxDistance, cfg.DedupWindow)
+	}
+
+	// 配置了候选模型时开启影子评估
+	var candidateModel services.Recognizer
+	if cfg.ShadowModelPath != "" {
+		candidateService, err := services.NewAIService(cfg.ShadowModelPath)
+		if err != nil {
+			log.Fatalf("Failed to initialize shadow AI service: %v", err)
+		}
+		candidateModel = candidateService
+	}
+	shadowService := services.NewShadowService(candidateModel, repo)
+	accessService := services.NewAccessService(repo)
+	labelService := services.NewLabelService(repo, accessService)
+	datasetExportService := services.NewDatasetExportService(repo, objectStore, accessService)
+	if n, err := datasetExportService.RecoverExports(context.Background()); err != nil {
+		log.Printf("WARN: Failed to recover interrupted dataset exports: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted dataset exports as failed.", n)
+	}
+	hotspotService := services.NewHotspotService(repo)
+	taxonomyService := services.NewTaxonomyService(repo)
+	evidenceService := services.NewEvidenceService(repo, objectStore, accessService)
+	imageService, err := services.NewDecisionImageService(repo, objectStore, accessService, cfg.ImageURLMode, cfg.ImageURLExpiry, "/api/v1/images", []byte(cfg.JWTSecret))
+	if err != nil {
+		log.Fatalf("Failed to initialize decision image service: %v", err)
+	}
+	taskAdminService := services.NewTaskAdminService(taskQueue, imageSpool)
+	telemetryRejectService := services.NewTelemetryRejectService(repo, accessService, services.NewTelemetryValidator(services.DefaultTelemetryLimits))
+	retentionService := services.NewRetentionService(repo, objectStore, services.RetentionPolicy{
+		ImageMaxAge:        time.Duration(cfg.RetentionImageDays) * 24 * time.Hour,
+		KeepLabelledImages: cfg.RetentionKeepLabelledImages,
+		TelemetryMaxAge:    time.Duration(cfg.RetentionTelemetryDays) * 24 * time.Hour,
+		RollupMaxAge:       time.Duration(cfg.RetentionRollupDays) * 24 * time.Hour,
+		RejectMaxAge:       time.Duration(cfg.RetentionRejectDays) * 24 * time.Hour,
+		BatchSize:          cfg.RetentionBatchSize,
+	})
+	if candidateModel != nil {
+		decisionService.EnableShadowEvaluation(shadowService)
+		log.Printf("Shadow evaluation enabled with candidate model %s.", candidateModel.ModelVersion())
+	}
 
 	log.Println("All services initialized.")
 
-	// 启动 MQTT 监听器
-	mqttListener := background.NewMQTTListener(mqttClient, telemetryHub.BroadcastChannel, repo)
+	// 恢复车辆的最后在线时间，用于计算在线状态
+	presenceService := services.NewPresenceService(repo, services.PresenceThresholds{
+		StaleAfter:   cfg.PresenceStaleAfter,
+		OfflineAfter: cfg.PresenceOfflineAfter,
+	}, telemetryHub.BroadcastChannel)
+	if err := presenceService.Load(context.Background(), time.Now()); err != nil {
+		log.Printf("WARN: Failed to load vehicle last-seen times: %v", err)
+	}
+
+	// 启动遥测批量写入器和 MQTT 监听器
+	telemetryWriter := background.NewTelemetryWriter(repo, background.TelemetryWriterOptions{
+		BatchSize:     cfg.TelemetryBatchSize,
+		FlushInterval: cfg.TelemetryFlushInterval,
+		MaxPending:    cfg.TelemetryMaxPending,
+	})
+	telemetryWriter.Start()
+	mqttListener := background.NewMQTTListener(mqttConn, telemetryHub.BroadcastChannel, telemetryWriter, telemetryRejectService, presenceService, background.IngestOptions{
+		Workers:   cfg.MQTTIngestWorkers,
+		QueueSize: cfg.MQTTIngestQueueSize,
+		MaxWait:   cfg.MQTTIngestMaxWait,
+	})
 	mqttListener.StartListening()
-	log.Println("MQTT listener started.")
+	if err := mqttConn.Connect(cfg.MQTTConnectTimeout); err != nil {
+		// 客户端会在后台继续重试，连接成功后自动订阅
+		log.Printf("WARN: MQTT broker not reachable yet, retrying in background: %v", err)
+	}
+	log.Printf("MQTT listener started with %d ingest workers.", cfg.MQTTIngestWorkers)
+
+	// 启动数据保留任务 (未开启时仍可通过 API 查看试运行报告)
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if cfg.RetentionEnabled {
+		background.NewRetentionJob(retentionService, cfg.RetentionInterval).Start(jobCtx)
+	}
+	background.NewPresenceJob(presenceService, cfg.PresenceSweepInterval).Start(jobCtx)
+
+	// 注册后台任务的处理函数并启动任务队列
+	taskQueue.Register(services.TaskKindDecisionLog, decisionService.HandleDecisionLogTask)
+	taskQueue.Register(services.TaskKindImageUpload, decisionService.HandleImageUploadTask)
+	queueWorkers := taskQueue.Start(jobCtx, cfg.TaskQueueWorkers)
+
+	// 启动发件箱分发器。即使本副本未开启发件箱，也处理其他副本 (或开启期间) 写入的消息
+	outboxDispatcher := background.NewOutboxDispatcher(repo, background.OutboxOptions{
+		MaxAttempts:  cfg.OutboxMaxAttempts,
+		BatchSize:    cfg.OutboxBatchSize,
+		Lease:        cfg.OutboxLease,
+		PollInterval: cfg.OutboxPollInterval,
+	})
+	outboxDispatcher.Register(services.OutboxKindDecisionLocate, decisionService.HandleDecisionLocateMessage)
+	outboxWorkers := outboxDispatcher.Start(jobCtx, cfg.OutboxWorkers)
 
 	// --- 4. HTTP 服务启动 ---
-	router := api.SetupRouter(repo, authService, commandService, decisionService, llmService, telemetryHub, []byte(cfg.JWTSecret), cfg.WebsocketAllowedOrigins)
+	router := api.SetupRouter(repo, authService, commandService, decisionService, llmService, shadowService, labelService, datasetExportService, hotspotService, taxonomyService, evidenceService, accessService, imageService, retentionService, taskAdminService, telemetryRejectService, presenceService, objectStore, telemetryHub, []byte(cfg.JWTSecret), cfg.WebsocketAllowedOrigins)
 
 	server := &http.Server{
 		Addr:    ":8888",
@@ -114,6 +264,15 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
+	mqttListener.Stop()
+	if err := presenceService.Flush(ctx); err != nil {
+		log.Printf("WARN: Failed to persist vehicle last-seen times: %v", err)
+	}
+	telemetryWriter.Close()
+	stopJobs()
+	queueWorkers.Wait()
+	outboxWorkers.Wait()
+	inferencePool.Close()
 
 	log.Println("Server exiting.")
 }
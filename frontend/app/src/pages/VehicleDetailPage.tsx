@@ -46,6 +46,8 @@ interface DecisionLog {
   vehicle_id: string;
   timestamp: string;
   image_url: string;
+  thumbnail_url?: string;
+  preview_url?: string;
   server_decision: ServerDecision;
 }
 
@@ -121,7 +123,7 @@ const VehicleDetailPage: React.FC = () => {
                 <CardMedia
                   component="img"
                   height="200"
-                  image={log.image_url} // Directly use the image URL
+                  image={log.preview_url || log.image_url} // Prefer the downscaled preview, fall back to the original
                   alt={`Decision log ${log.id}`}
                 />
                 <CardContent>
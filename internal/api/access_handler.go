@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"patrol-cloud/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessHandler 负责处理用户车辆访问授权的 API 请求 (仅管理员)
+type AccessHandler struct {
+	accessSvc *services.AccessService
+}
+
+// NewAccessHandler 创建一个新的 AccessHandler
+func NewAccessHandler(svc *services.AccessService) *AccessHandler {
+	return &AccessHandler{accessSvc: svc}
+}
+
+// HandleListVehicleAccess 返回用户被授权访问的车辆
+func (h *AccessHandler) HandleListVehicleAccess(c *gin.Context) {
+	userID := c.Param("id")
+
+	vehicleIDs, all, err := h.accessSvc.ListVehicleAccess(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to list vehicle access for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list vehicle access"})
+		return
+	}
+	if vehicleIDs == nil {
+		vehicleIDs = []string{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":      userID,
+		"all_vehicles": all,
+		"vehicle_ids":  vehicleIDs,
+	})
+}
+
+// HandleGrantVehicleAccess 授权用户访问车辆
+func (h *AccessHandler) HandleGrantVehicleAccess(c *gin.Context) {
+	userID, vehicleID := c.Param("id"), c.Param("vehicleId")
+
+	if err := h.accessSvc.GrantVehicleAccess(c.Request.Context(), userID, vehicleID); err != nil {
+		if errors.Is(err, services.ErrUnknownGrantee) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user or vehicle with the specified ID was not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to grant user %s access to vehicle %s: %v", userID, vehicleID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to grant vehicle access"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// HandleRevokeVehicleAccess 撤销用户对车辆的访问授权
+func (h *AccessHandler) HandleRevokeVehicleAccess(c *gin.Context) {
+	userID, vehicleID := c.Param("id"), c.Param("vehicleId")
+
+	if err := h.accessSvc.RevokeVehicleAccess(c.Request.Context(), userID, vehicleID); err != nil {
+		if errors.Is(err, services.ErrGrantNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user has no access grant for this vehicle"})
+			return
+		}
+		log.Printf("ERROR: Failed to revoke user %s access to vehicle %s: %v", userID, vehicleID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke vehicle access"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -26,7 +26,7 @@ func (h *CommandHandler) HandleSendCommand(c *gin.Context) {
 	}
 
 	// 调用服务层发布 MQTT 消息
-	commandID, err := h.cmdSvc.SendCommand(req.VehicleID, req.Command, "") // task_id 可选
+	commandID, err := h.cmdSvc.SendCommand(c.Request.Context(), req.VehicleID, req.Command, "", c.GetString("userID")) // task_id 可选
 	if err != nil {
 		log.Printf("ERROR: Failed to send command: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue command"})
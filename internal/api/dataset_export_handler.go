@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DatasetExportHandler 负责处理训练数据集导出相关的 API 请求
+type DatasetExportHandler struct {
+	exportSvc *services.DatasetExportService
+}
+
+// NewDatasetExportHandler 创建一个新的 DatasetExportHandler
+func NewDatasetExportHandler(svc *services.DatasetExportService) *DatasetExportHandler {
+	return &DatasetExportHandler{exportSvc: svc}
+}
+
+// HandleCreateExport 按过滤条件创建一个后台导出任务
+func (h *DatasetExportHandler) HandleCreateExport(c *gin.Context) {
+	var filter models.DatasetExportFilter
+	if err := c.ShouldBindJSON(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: start_time and end_time must be RFC3339"})
+		return
+	}
+
+	export, err := h.exportSvc.StartExport(c.Request.Context(), filter, c.GetString("userID"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidExportFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must not be before start_time"})
+			return
+		}
+		if errors.Is(err, services.ErrAccessDenied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "access to this vehicle is not permitted"})
+			return
+		}
+		log.Printf("ERROR: Failed to start dataset export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start dataset export"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, export)
+}
+
+// HandleGetExport 返回导出任务的状态，完成后包含下载链接，只对创建者和管理员可见
+func (h *DatasetExportHandler) HandleGetExport(c *gin.Context) {
+	export, err := h.exportSvc.GetExport(c.Request.Context(), c.Param("id"), c.GetString("userID"), c.GetString("role"))
+	if err != nil {
+		log.Printf("ERROR: Failed to get dataset export %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get dataset export"})
+		return
+	}
+	if export == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "dataset export with the specified ID was not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, export)
+}
@@ -1,12 +1,19 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
+	"math"
+	"mime/multipart"
 	"net/http"
 	"patrol-cloud/internal/models"
 	"patrol-cloud/internal/services"
+	"strconv"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -19,45 +26,251 @@ func NewDecisionHandler(svc *services.DecisionService) *DecisionHandler {
 	return &DecisionHandler{decisionSvc: svc}
 }
 
+// apiError 是结构化的错误响应，error 字段与其余接口保持一致
+type apiError struct {
+	Error   string                 `json:"error"`
+	Code    string                 `json:"code,omitempty"`
+	Field   string                 `json:"field,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// multipartOverhead 是请求体中除图片外 (元数据、分隔符等) 允许的额外字节数
+const multipartOverhead = 1 << 20
+
 // HandleDecision 严格遵循 3.2.1 和 4.2.2 的设计
 func (h *DecisionHandler) HandleDecision(c *gin.Context) {
-	// 1. 解析 multipart/form-data
+	// 1. 解析 multipart/form-data，请求体超过上限时直接拒绝
+	maxImageBytes := h.decisionSvc.UploadLimits().MaxImageBytes
+	if !h.parseMultipart(c, maxImageBytes+multipartOverhead) {
+		return
+	}
+
 	// 1a. 解析 metadata
 	metadataStr := c.PostForm("metadata")
 	if metadataStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "metadata is required"})
+		c.JSON(http.StatusBadRequest, apiError{Error: "metadata is required", Code: services.CodeMetadataInvalid, Field: "metadata"})
 		return
 	}
 
 	var metadata models.DecisionRequestMetadata
 	if err := json.Unmarshal([]byte(metadataStr), &metadata); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid metadata JSON"})
+		c.JSON(http.StatusBadRequest, apiError{Error: "invalid metadata JSON", Code: services.CodeMetadataInvalid, Field: "metadata"})
 		return
 	}
 
 	// 1b. 解析 image
-	imageFile, _, err := c.Request.FormFile("image")
+	imageFile, imageHeader, err := c.Request.FormFile("image")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "image file is required"})
+		c.JSON(http.StatusBadRequest, apiError{Error: "image file is required", Code: services.CodeMetadataInvalid, Field: "image"})
 		return
 	}
 	defer imageFile.Close()
 
+	if imageHeader.Size > maxImageBytes {
+		h.writeProcessError(c, imageTooLarge(maxImageBytes, imageHeader.Size))
+		return
+	}
+
 	imageBytes, err := io.ReadAll(imageFile)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read image file"})
 		return
 	}
 
-	// 2. 调用 Service 层处理
-	result, err := h.decisionSvc.ProcessDecision(c.Request.Context(), imageBytes, metadata)
+	// 2. 根据客户端声明的超时设置截止时间，超时后不再继续排队或推理
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.decisionSvc.RequestTimeout(requestTimeout(c)))
+	defer cancel()
+
+	// 3. 调用 Service 层处理 (包括图片与元数据校验)
+	result, err := h.decisionSvc.ProcessDecision(ctx, imageBytes, metadata)
 	if err != nil {
-		// (根据错误类型返回 500 或其他)
-		log.Printf("ERROR: ProcessDecision failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process decision"})
+		h.writeProcessError(c, err)
 		return
 	}
 
-	// 3. 响应 (格式必须符合 3.2.1)
+	// 4. 响应 (格式必须符合 3.2.1)
 	c.JSON(http.StatusOK, result)
 }
+
+// parseMultipart 在限制请求体大小的前提下解析表单，失败时写出错误响应并返回 false
+func (h *DecisionHandler) parseMultipart(c *gin.Context, maxBodyBytes int64) bool {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes)
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, apiError{
+				Error:   "request body exceeds the maximum allowed size",
+				Code:    services.CodeImageTooLarge,
+				Details: map[string]interface{}{"max_bytes": maxBodyBytes},
+			})
+			return false
+		}
+		c.JSON(http.StatusBadRequest, apiError{Error: "invalid multipart form", Code: services.CodeMetadataInvalid})
+		return false
+	}
+	return true
+}
+
+// imageTooLarge 构造图片超出大小上限的校验错误
+func imageTooLarge(maxBytes, size int64) error {
+	return &services.ValidationError{
+		Code:    services.CodeImageTooLarge,
+		Field:   "image",
+		Message: "image exceeds the maximum allowed size",
+		Details: map[string]interface{}{"max_bytes": maxBytes, "size": size},
+	}
+}
+
+// requestTimeoutHeader 允许客户端以毫秒声明其愿意等待的时间
+const requestTimeoutHeader = "X-Request-Timeout"
+
+// requestTimeout 解析 X-Request-Timeout 头，缺失或非法时返回 0
+func requestTimeout(c *gin.Context) time.Duration {
+	ms, err := strconv.Atoi(c.GetHeader(requestTimeoutHeader))
+	if err != nil || ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// validationStatus 将校验错误码映射为 HTTP 状态码
+var validationStatus = map[string]int{
+	services.CodeImageTooLarge:       http.StatusRequestEntityTooLarge,
+	services.CodeUnsupportedMedia:    http.StatusUnsupportedMediaType,
+	services.CodeImageUndecodable:    http.StatusUnprocessableEntity,
+	services.CodeImageDimensions:     http.StatusUnprocessableEntity,
+	services.CodeMetadataInvalid:     http.StatusBadRequest,
+	services.CodeUnknownVehicle:      http.StatusUnprocessableEntity,
+	services.CodeTimestampOutOfRange: http.StatusUnprocessableEntity,
+}
+
+// describeProcessError 返回 ProcessDecision 错误对应的 HTTP 状态码和客户端可见的错误描述
+func describeProcessError(err error) (int, apiError) {
+	var vErr *services.ValidationError
+	switch {
+	case errors.As(err, &vErr):
+		status, ok := validationStatus[vErr.Code]
+		if !ok {
+			status = http.StatusBadRequest
+		}
+		return status, apiError{Error: vErr.Message, Code: vErr.Code, Field: vErr.Field, Details: vErr.Details}
+	case errors.Is(err, services.ErrInferenceQueueFull):
+		return http.StatusServiceUnavailable, apiError{Error: "decision service is overloaded, retry later", Code: "overloaded"}
+	case errors.Is(err, services.ErrInferencePoolClosed):
+		return http.StatusServiceUnavailable, apiError{Error: "decision service is shutting down, retry later", Code: "shutting_down"}
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return http.StatusGatewayTimeout, apiError{Error: "decision deadline exceeded", Code: "deadline_exceeded"}
+	default:
+		return http.StatusInternalServerError, apiError{Error: "failed to process decision", Code: "internal_error"}
+	}
+}
+
+// writeProcessError 将 ProcessDecision 的错误映射为 HTTP 响应
+func (h *DecisionHandler) writeProcessError(c *gin.Context, err error) {
+	status, body := describeProcessError(err)
+	switch status {
+	case http.StatusServiceUnavailable:
+		// 快速拒绝，让边缘端在超时前得知需要稍后重试
+		retryAfter := int(math.Ceil(h.decisionSvc.RetryAfter().Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+	case http.StatusInternalServerError:
+		log.Printf("ERROR: ProcessDecision failed: %v", err)
+	}
+	c.JSON(status, body)
+}
+
+// batchDecisionItem 是批量识别响应中单张图片的结果，失败时内联错误描述
+type batchDecisionItem struct {
+	Index  int                    `json:"index"`
+	Result *models.DecisionResult `json:"result,omitempty"`
+	*apiError
+}
+
+// HandleDecisionBatch 在一个 multipart 请求中识别多张图片。
+// 图片放在多个 "images" 字段中，"metadata" 为与图片一一对应的 JSON 数组。
+func (h *DecisionHandler) HandleDecisionBatch(c *gin.Context) {
+	// 1. 解析 multipart/form-data
+	maxImageBytes := h.decisionSvc.UploadLimits().MaxImageBytes
+	if !h.parseMultipart(c, services.MaxDecisionBatchImages*maxImageBytes+multipartOverhead) {
+		return
+	}
+	files := c.Request.MultipartForm.File["images"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, apiError{Error: "at least one image is required", Code: services.CodeMetadataInvalid, Field: "images"})
+		return
+	}
+	if len(files) > services.MaxDecisionBatchImages {
+		status, body := describeProcessError(services.BatchTooLarge(len(files)))
+		c.JSON(status, body)
+		return
+	}
+
+	var metadataList []models.DecisionRequestMetadata
+	if err := json.Unmarshal([]byte(c.PostForm("metadata")), &metadataList); err != nil {
+		c.JSON(http.StatusBadRequest, apiError{Error: "metadata must be a JSON array", Code: services.CodeMetadataInvalid, Field: "metadata"})
+		return
+	}
+	if len(metadataList) != len(files) {
+		c.JSON(http.StatusBadRequest, apiError{Error: "metadata must contain exactly one entry per image", Code: services.CodeMetadataInvalid, Field: "metadata"})
+		return
+	}
+
+	// 2. 读取图片，读取失败或超出大小的图片单独报错，不影响其余图片
+	response := make([]batchDecisionItem, len(files))
+	var items []services.DecisionBatchItem
+	var indexes []int
+	for i, fileHeader := range files {
+		response[i].Index = i
+		if fileHeader.Size > maxImageBytes {
+			_, body := describeProcessError(imageTooLarge(maxImageBytes, fileHeader.Size))
+			response[i].apiError = &body
+			continue
+		}
+		imageBytes, err := readFormFile(fileHeader)
+		if err != nil {
+			response[i].apiError = &apiError{Error: "failed to read image file", Code: "internal_error"}
+			continue
+		}
+		items = append(items, services.DecisionBatchItem{Image: imageBytes, Metadata: metadataList[i]})
+		indexes = append(indexes, i)
+	}
+
+	// 3. 调用 Service 层处理
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.decisionSvc.RequestTimeout(requestTimeout(c)))
+	defer cancel()
+
+	overloaded := 0
+	for j, outcome := range h.decisionSvc.ProcessDecisionBatch(ctx, items) {
+		i := indexes[j]
+		if outcome.Err != nil {
+			status, body := describeProcessError(outcome.Err)
+			switch status {
+			case http.StatusServiceUnavailable:
+				overloaded++
+			case http.StatusInternalServerError:
+				log.Printf("ERROR: ProcessDecisionBatch failed for item %d: %v", i, outcome.Err)
+			}
+			response[i].apiError = &body
+			continue
+		}
+		response[i].Result = outcome.Result
+	}
+
+	// 整批都因过载被拒绝时按单张请求的方式返回 503
+	if overloaded == len(files) {
+		h.writeProcessError(c, services.ErrInferenceQueueFull)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": response})
+}
+
+// readFormFile 读取 multipart 中的一个文件
+func readFormFile(fileHeader *multipart.FileHeader) ([]byte, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"patrol-cloud/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EvidenceHandler 负责处理决策证据包相关的 API 请求
+type EvidenceHandler struct {
+	evidenceSvc *services.EvidenceService
+}
+
+// NewEvidenceHandler 创建一个新的 EvidenceHandler
+func NewEvidenceHandler(svc *services.EvidenceService) *EvidenceHandler {
+	return &EvidenceHandler{evidenceSvc: svc}
+}
+
+// HandleGetEvidence 生成并以流的方式下载单条决策的证据包 (ZIP)
+func (h *EvidenceHandler) HandleGetEvidence(c *gin.Context) {
+	decisionID := c.Param("id")
+
+	bundle, err := h.evidenceSvc.PrepareBundle(c.Request.Context(), decisionID, c.GetString("userID"))
+	if err != nil {
+		if errors.Is(err, services.ErrDecisionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "decision log with the specified ID was not found"})
+			return
+		}
+		if errors.Is(err, services.ErrAccessDenied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "access to this vehicle is not permitted"})
+			return
+		}
+		log.Printf("ERROR: Failed to build evidence bundle for decision %s: %v", decisionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build evidence bundle"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="evidence-%s.zip"`, decisionID))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	if err := bundle.WriteTo(c.Request.Context(), c.Writer); err != nil {
+		// 响应头已经发出，只能中断连接，客户端会收到不完整的归档
+		log.Printf("ERROR: Failed to stream evidence bundle for decision %s: %v", decisionID, err)
+		c.Abort()
+	}
+}
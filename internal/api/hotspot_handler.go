@@ -0,0 +1,60 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"patrol-cloud/internal/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HotspotHandler 负责处理垃圾热点地图相关的 API 请求
+type HotspotHandler struct {
+	hotspotSvc *services.HotspotService
+}
+
+// NewHotspotHandler 创建一个新的 HotspotHandler
+func NewHotspotHandler(svc *services.HotspotService) *HotspotHandler {
+	return &HotspotHandler{hotspotSvc: svc}
+}
+
+// HandleGetHotspots 按时间范围和动作聚类决策位置，返回 GeoJSON FeatureCollection
+func (h *HotspotHandler) HandleGetHotspots(c *gin.Context) {
+	startTime, endTime, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if endTime.Before(startTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must not be before start_time"})
+		return
+	}
+
+	radius, err := strconv.ParseFloat(c.DefaultQuery("radius_m", strconv.FormatFloat(services.DefaultHotspotRadius, 'f', -1, 64)), 64)
+	if err != nil || radius <= 0 || radius > 5000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'radius_m' parameter: must be a number in (0, 5000]"})
+		return
+	}
+	minPoints, err := strconv.Atoi(c.DefaultQuery("min_points", strconv.Itoa(services.DefaultHotspotMinPoints)))
+	if err != nil || minPoints < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'min_points' parameter: must be a positive integer"})
+		return
+	}
+
+	hotspots, err := h.hotspotSvc.Hotspots(c.Request.Context(), services.HotspotQuery{
+		StartTime:    startTime,
+		EndTime:      endTime,
+		Action:       c.Query("action"),
+		RadiusMeters: radius,
+		MinPoints:    minPoints,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to build decision hotspots: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build decision hotspots"})
+		return
+	}
+
+	c.Header("Content-Type", "application/geo+json")
+	c.JSON(http.StatusOK, hotspots)
+}
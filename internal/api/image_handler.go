@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"patrol-cloud/internal/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImageHandler 负责决策图片的鉴权代理下载
+type ImageHandler struct {
+	imageSvc *services.DecisionImageService
+}
+
+// NewImageHandler 创建一个新的 ImageHandler
+func NewImageHandler(svc *services.DecisionImageService) *ImageHandler {
+	return &ImageHandler{imageSvc: svc}
+}
+
+// HandleGetImage 校验链接签名和车辆访问权限后返回决策图片，variant 可选 original (默认)、thumbnail、preview。
+// 链接由日志接口签发，浏览器通过 <img> 直接加载，因此不要求 Authorization 头。
+func (h *ImageHandler) HandleGetImage(c *gin.Context) {
+	decisionID := c.Param("id")
+	userID, variant := c.Query("user"), c.Query("variant")
+
+	if err := h.imageSvc.VerifyLink(userID, decisionID, variant, c.Query("expires"), c.Query("signature")); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid or expired image link"})
+		return
+	}
+
+	rc, info, err := h.imageSvc.Open(c.Request.Context(), userID, decisionID, variant)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrDecisionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "decision log with the specified ID was not found"})
+		case errors.Is(err, services.ErrImageNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "decision has no stored image"})
+		case errors.Is(err, services.ErrAccessDenied):
+			c.JSON(http.StatusForbidden, gin.H{"error": "access to this vehicle is not permitted"})
+		case errors.Is(err, services.ErrInvalidImageVariant):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'variant' parameter: must be original, thumbnail or preview"})
+		default:
+			log.Printf("ERROR: Failed to open image for decision %s: %v", decisionID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load image"})
+		}
+		return
+	}
+	defer rc.Close()
+
+	// 响应依赖调用者的权限，只允许浏览器私有缓存
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Header("Content-Type", info.ContentType)
+	c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, rc); err != nil {
+		log.Printf("ERROR: Failed to stream image for decision %s: %v", decisionID, err)
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// LabelHandler 负责处理决策标注和模型评估相关的 API 请求
+type LabelHandler struct {
+	labelSvc *services.LabelService
+}
+
+// NewLabelHandler 创建一个新的 LabelHandler
+func NewLabelHandler(svc *services.LabelService) *LabelHandler {
+	return &LabelHandler{labelSvc: svc}
+}
+
+// HandlePutLabel 为决策日志写入真实标注，标注人取自当前登录用户
+func (h *LabelHandler) HandlePutLabel(c *gin.Context) {
+	var req models.LabelDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var verrs validator.ValidationErrors
+		if errors.As(err, &verrs) && verrs[0].Field() == "CorrectAction" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: correct_action is required"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+
+	label, err := h.labelSvc.LabelDecision(c.Request.Context(), c.Param("id"), c.GetString("userID"), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrDecisionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "decision log with the specified ID was not found"})
+		case errors.Is(err, services.ErrAccessDenied):
+			c.JSON(http.StatusForbidden, gin.H{"error": "access to this vehicle is not permitted"})
+		case errors.Is(err, services.ErrInvalidLabel):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			log.Printf("ERROR: Failed to label decision %s: %v", c.Param("id"), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save label"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, label)
+}
+
+// HandleGetLabel 返回决策日志的标注
+func (h *LabelHandler) HandleGetLabel(c *gin.Context) {
+	label, err := h.labelSvc.GetLabel(c.Request.Context(), c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		if writeDecisionAccessError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get label"})
+		return
+	}
+	if label == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "decision log has not been labelled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, label)
+}
+
+// HandleDeleteLabel 删除决策日志的标注
+func (h *LabelHandler) HandleDeleteLabel(c *gin.Context) {
+	deleted, err := h.labelSvc.DeleteLabel(c.Request.Context(), c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		if writeDecisionAccessError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete label"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "decision log has not been labelled"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// writeDecisionAccessError 在决策不存在或无权访问时写出 404 / 403 并返回 true
+func writeDecisionAccessError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrDecisionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "decision log with the specified ID was not found"})
+	case errors.Is(err, services.ErrAccessDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": "access to this vehicle is not permitted"})
+	default:
+		return false
+	}
+	return true
+}
+
+// HandleGetModelMetrics 返回各模型版本在已标注决策上的精确率与召回率
+func (h *LabelHandler) HandleGetModelMetrics(c *gin.Context) {
+	startTime, endTime, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	metrics, err := h.labelSvc.ModelMetrics(c.Request.Context(), startTime, endTime)
+	if err != nil {
+		log.Printf("ERROR: Failed to compute model metrics: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute model metrics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"models": metrics})
+}
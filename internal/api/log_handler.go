@@ -1,8 +1,12 @@
 package api
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/services"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -10,18 +14,30 @@ import (
 
 // LogHandler 负责处理日志相关的 API 请求
 type LogHandler struct {
-	repo db.Repository
+	repo      db.Repository
+	accessSvc *services.AccessService
+	imageSvc  *services.DecisionImageService
 }
 
 // NewLogHandler 创建一个新的 LogHandler
-func NewLogHandler(repo db.Repository) *LogHandler {
-	return &LogHandler{repo: repo}
+func NewLogHandler(repo db.Repository, accessSvc *services.AccessService, imageSvc *services.DecisionImageService) *LogHandler {
+	return &LogHandler{repo: repo, accessSvc: accessSvc, imageSvc: imageSvc}
 }
 
 // HandleListDecisionLogs 处理获取决策日志列表的请求
 func (h *LogHandler) HandleListDecisionLogs(c *gin.Context) {
 	vehicleID := c.Param("id")
 
+	if err := h.accessSvc.CheckVehicleAccess(c.Request.Context(), c.GetString("userID"), vehicleID); err != nil {
+		if errors.Is(err, services.ErrAccessDenied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "access to this vehicle is not permitted"})
+			return
+		}
+		log.Printf("ERROR: Failed to check access to vehicle %s: %v", vehicleID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list decision logs"})
+		return
+	}
+
 	// 解析分页参数
 	pageStr := c.DefaultQuery("page", "1")
 	page, err := strconv.Atoi(pageStr)
@@ -49,6 +65,7 @@ func (h *LogHandler) HandleListDecisionLogs(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list decision logs"})
 		return
 	}
+	h.imageSvc.ResolveURLs(c.Request.Context(), c.GetString("userID"), logs...)
 
 	c.JSON(http.StatusOK, gin.H{
 		"logs":  logs, // Changed from data to logs for consistency
@@ -56,13 +73,27 @@ func (h *LogHandler) HandleListDecisionLogs(c *gin.Context) {
 	})
 }
 
-// HandleListAllDecisionLogs 处理获取所有决策日志的请求
+// HandleListAllDecisionLogs 处理获取所有决策日志的请求，只返回当前用户有权访问的车辆的日志
 func (h *LogHandler) HandleListAllDecisionLogs(c *gin.Context) {
-	logs, err := h.repo.ListAllDecisionLogs(c.Request.Context())
+	allowed, err := h.accessSvc.VehicleFilter(c.Request.Context(), c.GetString("userID"))
+	if err != nil {
+		log.Printf("ERROR: Failed to load vehicle access for user %s: %v", c.GetString("userID"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list all decision logs"})
+		return
+	}
+
+	all, err := h.repo.ListAllDecisionLogs(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list all decision logs"})
 		return
 	}
+	logs := make([]*models.DecisionLog, 0, len(all))
+	for _, l := range all {
+		if allowed(l.VehicleID) {
+			logs = append(logs, l)
+		}
+	}
+	h.imageSvc.ResolveURLs(c.Request.Context(), c.GetString("userID"), logs...)
 
 	c.JSON(http.StatusOK, gin.H{
 		"logs":  logs,
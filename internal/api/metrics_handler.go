@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+	"patrol-cloud/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsHandler 负责暴露进程内的运行指标
+type MetricsHandler struct {
+	registry *metrics.Registry
+}
+
+// NewMetricsHandler 创建一个新的 MetricsHandler
+func NewMetricsHandler(registry *metrics.Registry) *MetricsHandler {
+	return &MetricsHandler{registry: registry}
+}
+
+// HandleGetMetrics 以 JSON 形式返回所有指标的当前值
+func (h *MetricsHandler) HandleGetMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, h.registry.Snapshot())
+}
@@ -42,6 +42,7 @@ func AuthMiddleware(secretKey []byte) gin.HandlerFunc {
 			// 将用户信息存储在上下文中，以便后续处理程序使用
 			c.Set("userID", claims["sub"])
 			c.Set("username", claims["username"])
+			c.Set("role", claims["role"])
 		} else {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
@@ -50,3 +51,14 @@ func AuthMiddleware(secretKey []byte) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequireRole 创建一个 Gin 中间件，只允许 JWT 中角色为 role 的用户访问，须在 AuthMiddleware 之后使用
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != role {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"patrol-cloud/internal/storage"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ObjectHandler 为本地对象存储后端提供签名下载链接的访问 (MinIO 后端由 MinIO 自身提供)
+type ObjectHandler struct {
+	store *storage.LocalStore
+}
+
+// NewObjectHandler 创建一个新的 ObjectHandler
+func NewObjectHandler(store *storage.LocalStore) *ObjectHandler {
+	return &ObjectHandler{store: store}
+}
+
+// HandleGetObject 校验链接签名后返回对象内容，签名无效或过期时返回 403
+func (h *ObjectHandler) HandleGetObject(c *gin.Context) {
+	bucket := c.Param("bucket")
+	name := strings.TrimPrefix(c.Param("name"), "/")
+
+	if err := h.store.VerifySignature(bucket, name, c.Query("expires"), c.Query("signature")); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid or expired download link"})
+		return
+	}
+
+	reader, info, err := h.store.Get(c.Request.Context(), bucket, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "object not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to read object %s/%s: %v", bucket, name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read object"})
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Type", info.ContentType)
+	c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		log.Printf("ERROR: Failed to stream object %s/%s: %v", bucket, name, err)
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseTimeRange 解析 start_time / end_time 查询参数 (RFC3339)，两者均为必填
+func parseTimeRange(c *gin.Context) (time.Time, time.Time, error) {
+	startTimeStr := c.Query("start_time")
+	endTimeStr := c.Query("end_time")
+	if startTimeStr == "" || endTimeStr == "" {
+		return time.Time{}, time.Time{}, errors.New("start_time and end_time query parameters are required")
+	}
+
+	startTime, err := time.Parse(time.RFC3339, startTimeStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid start_time format; use RFC3339")
+	}
+	endTime, err := time.Parse(time.RFC3339, endTimeStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid end_time format; use RFC3339")
+	}
+	return startTime, endTime, nil
+}
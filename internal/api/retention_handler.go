@@ -0,0 +1,32 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"patrol-cloud/internal/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RetentionHandler 负责处理数据保留策略相关的 API 请求 (仅管理员)
+type RetentionHandler struct {
+	retentionSvc *services.RetentionService
+}
+
+// NewRetentionHandler 创建一个新的 RetentionHandler
+func NewRetentionHandler(svc *services.RetentionService) *RetentionHandler {
+	return &RetentionHandler{retentionSvc: svc}
+}
+
+// HandleGetReport 返回保留策略的试运行报告：按当前策略下一次执行将删除哪些数据
+func (h *RetentionHandler) HandleGetReport(c *gin.Context) {
+	report, err := h.retentionSvc.Report(c.Request.Context(), time.Now())
+	if err != nil {
+		log.Printf("ERROR: Failed to build retention report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build retention report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
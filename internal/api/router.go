@@ -3,7 +3,10 @@ package api
 import (
 	"patrol-cloud/internal/api/middleware"
 	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/metrics"
+	"patrol-cloud/internal/models"
 	"patrol-cloud/internal/services"
+	"patrol-cloud/internal/storage"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +18,19 @@ func SetupRouter(
 	cmdSvc *services.CommandService,
 	decisionSvc *services.DecisionService,
 	llmSvc *services.LLMService,
+	shadowSvc *services.ShadowService,
+	labelSvc *services.LabelService,
+	exportSvc *services.DatasetExportService,
+	hotspotSvc *services.HotspotService,
+	taxonomySvc *services.TaxonomyService,
+	evidenceSvc *services.EvidenceService,
+	accessSvc *services.AccessService,
+	imageSvc *services.DecisionImageService,
+	retentionSvc *services.RetentionService,
+	taskSvc *services.TaskAdminService,
+	rejectSvc *services.TelemetryRejectService,
+	presenceSvc *services.PresenceService,
+	objectStore storage.ObjectStore,
 	telemetryHub *services.TelemetryHub,
 	jwtSecret []byte,
 	websocketAllowedOrigins string,
@@ -28,9 +44,21 @@ func SetupRouter(
 	commandHandler := NewCommandHandler(cmdSvc)
 	decisionHandler := NewDecisionHandler(decisionSvc)
 	wsHandler := NewWebSocketHandler(telemetryHub, authSvc, websocketAllowedOrigins)
-	vehicleHandler := NewVehicleHandler(repo)
+	vehicleHandler := NewVehicleHandler(repo, presenceSvc)
 	telemetryHandler := NewTelemetryHandler(repo)
-	logHandler := NewLogHandler(repo)
+	logHandler := NewLogHandler(repo, accessSvc, imageSvc)
+	shadowHandler := NewShadowHandler(shadowSvc)
+	labelHandler := NewLabelHandler(labelSvc)
+	exportHandler := NewDatasetExportHandler(exportSvc)
+	hotspotHandler := NewHotspotHandler(hotspotSvc)
+	taxonomyHandler := NewTaxonomyHandler(taxonomySvc)
+	evidenceHandler := NewEvidenceHandler(evidenceSvc)
+	metricsHandler := NewMetricsHandler(metrics.Default)
+	imageHandler := NewImageHandler(imageSvc)
+	accessHandler := NewAccessHandler(accessSvc)
+	retentionHandler := NewRetentionHandler(retentionSvc)
+	taskHandler := NewTaskHandler(taskSvc)
+	rejectHandler := NewTelemetryRejectHandler(rejectSvc)
 
 	// API v1 路由组
 	v1 := router.Group("/api/v1")
@@ -38,6 +66,9 @@ func SetupRouter(
 		// 3.3.1 用户认证 (公开路由)
 		v1.POST("/auth/login", authHandler.HandleLogin)
 
+		// 决策图片代理下载 (由链接签名鉴权，并检查车辆访问权限)
+		v1.GET("/images/:id", imageHandler.HandleGetImage)
+
 		// 创建需要认证的路由组
 		authRequired := v1.Group("/")
 		authRequired.Use(middleware.AuthMiddleware(jwtSecret))
@@ -50,6 +81,7 @@ func SetupRouter(
 
 			// 同步决策
 			authRequired.POST("/decisions/recognize", decisionHandler.HandleDecision)
+			authRequired.POST("/decisions/recognize/batch", decisionHandler.HandleDecisionBatch)
 
 			// 车辆
 			authRequired.GET("/vehicles", vehicleHandler.HandleListVehicles)
@@ -57,13 +89,74 @@ func SetupRouter(
 
 			// 遥测
 			authRequired.GET("/vehicles/:id/telemetry", telemetryHandler.HandleGetTelemetry)
+			authRequired.GET("/vehicles/:id/telemetry/rollups", telemetryHandler.HandleGetTelemetryRollups)
+			authRequired.GET("/vehicles/:id/telemetry/rejects", rejectHandler.HandleListRejects)
 
 			// 日志
 			authRequired.GET("/decision-logs", logHandler.HandleListAllDecisionLogs) // New global log route
 			authRequired.GET("/vehicles/:id/decision-logs", logHandler.HandleListDecisionLogs)
+			authRequired.GET("/decision-logs/hotspots", hotspotHandler.HandleGetHotspots)
+
+			// 决策标注
+			authRequired.GET("/decision-logs/:id/label", labelHandler.HandleGetLabel)
+			authRequired.PUT("/decision-logs/:id/label", labelHandler.HandlePutLabel)
+			authRequired.DELETE("/decision-logs/:id/label", labelHandler.HandleDeleteLabel)
+
+			// 决策证据包
+			authRequired.GET("/decision-logs/:id/evidence", evidenceHandler.HandleGetEvidence)
+
+			// 模型评估
+			authRequired.GET("/shadow-evaluations/report", shadowHandler.HandleGetReport)
+			authRequired.GET("/model-metrics", labelHandler.HandleGetModelMetrics)
+
+			// 训练数据集导出
+			authRequired.POST("/dataset-exports", exportHandler.HandleCreateExport)
+			authRequired.GET("/dataset-exports/:id", exportHandler.HandleGetExport)
+
+			// 垃圾分类体系与收集统计
+			authRequired.GET("/trash-categories", taxonomyHandler.HandleListCategories)
+			authRequired.GET("/trash-categories/:id", taxonomyHandler.HandleGetCategory)
+			authRequired.GET("/collection-stats", taxonomyHandler.HandleGetCollectionStats)
+
+			// 运行指标
+			authRequired.GET("/metrics", metricsHandler.HandleGetMetrics)
+
+			// 用户车辆访问授权 (仅管理员)
+			admin := authRequired.Group("/")
+			admin.Use(middleware.RequireRole(models.RoleAdmin))
+			{
+				admin.GET("/users/:id/vehicles", accessHandler.HandleListVehicleAccess)
+				admin.PUT("/users/:id/vehicles/:vehicleId", accessHandler.HandleGrantVehicleAccess)
+				admin.DELETE("/users/:id/vehicles/:vehicleId", accessHandler.HandleRevokeVehicleAccess)
+
+				// 垃圾分类体系的维护
+				admin.POST("/trash-categories", taxonomyHandler.HandleCreateCategory)
+				admin.PUT("/trash-categories/:id", taxonomyHandler.HandleUpdateCategory)
+				admin.DELETE("/trash-categories/:id", taxonomyHandler.HandleDeleteCategory)
+
+				// 数据保留策略试运行报告
+				admin.GET("/retention/report", retentionHandler.HandleGetReport)
+
+				// 后台任务队列：待执行任务与死信
+				admin.GET("/tasks", taskHandler.HandleListTasks)
+				admin.GET("/tasks/:id", taskHandler.HandleGetTask)
+				admin.POST("/tasks/requeue", taskHandler.HandleRequeueTasks)
+				admin.POST("/tasks/:id/requeue", taskHandler.HandleRequeueTask)
+				admin.DELETE("/tasks", taskHandler.HandlePurgeTasks)
+				admin.DELETE("/tasks/:id", taskHandler.HandlePurgeTask)
+
+				// 各车辆被隔离的不合法状态上报统计
+				admin.GET("/telemetry/rejects/summary", rejectHandler.HandleGetRejectSummary)
+			}
 		}
 	}
 
+	// 本地对象存储后端的签名下载链接 (由签名本身鉴权)
+	if localStore, ok := objectStore.(*storage.LocalStore); ok {
+		objectHandler := NewObjectHandler(localStore)
+		router.GET("/objects/:bucket/*name", objectHandler.HandleGetObject)
+	}
+
 	// WebSocket 实时遥测
 	router.GET("/ws/telemetry", wsHandler.HandleTelemetry)
 
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"patrol-cloud/internal/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShadowHandler 负责处理影子评估报告相关的 API 请求
+type ShadowHandler struct {
+	shadowSvc *services.ShadowService
+}
+
+// NewShadowHandler 创建一个新的 ShadowHandler
+func NewShadowHandler(svc *services.ShadowService) *ShadowHandler {
+	return &ShadowHandler{shadowSvc: svc}
+}
+
+// HandleGetReport 返回时间范围内各模型对的一致率、置信度分布和分歧样本
+func (h *ShadowHandler) HandleGetReport(c *gin.Context) {
+	startTime, endTime, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	samples, err := strconv.Atoi(c.DefaultQuery("samples", "20"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'samples' parameter: must be an integer"})
+		return
+	}
+	if samples < 0 || samples > 200 {
+		samples = 20
+	}
+
+	reports, err := h.shadowSvc.Report(c.Request.Context(), startTime, endTime, samples)
+	if err != nil {
+		log.Printf("ERROR: Failed to build shadow evaluation report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build shadow evaluation report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"model_pairs": reports})
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"patrol-cloud/internal/queue"
+	"patrol-cloud/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TaskHandler 负责后台任务队列的管理 API (仅管理员)
+type TaskHandler struct {
+	taskSvc *services.TaskAdminService
+}
+
+// NewTaskHandler 创建一个新的 TaskHandler
+func NewTaskHandler(svc *services.TaskAdminService) *TaskHandler {
+	return &TaskHandler{taskSvc: svc}
+}
+
+const invalidTaskFilterMessage = "invalid 'state' parameter: must be pending or dead"
+
+// HandleListTasks 列出任务及其错误历史，可按 state (pending / dead) 和 kind 筛选
+func (h *TaskHandler) HandleListTasks(c *gin.Context) {
+	filter, err := services.ParseTaskFilter(c.Query("state"), c.Query("kind"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidTaskFilterMessage})
+		return
+	}
+
+	tasks, counts := h.taskSvc.ListTasks(filter)
+	c.JSON(http.StatusOK, gin.H{
+		"tasks":  tasks,
+		"total":  len(tasks),
+		"counts": counts,
+	})
+}
+
+// HandleGetTask 返回任务的完整内容，包括 Payload
+func (h *TaskHandler) HandleGetTask(c *gin.Context) {
+	task, err := h.taskSvc.GetTask(c.Param("id"))
+	if err != nil {
+		writeTaskError(c, err, "failed to get task")
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// HandleRequeueTask 将单个任务重新排队立即执行
+func (h *TaskHandler) HandleRequeueTask(c *gin.Context) {
+	if err := h.taskSvc.RequeueTask(c.Param("id"), c.GetString("userID")); err != nil {
+		writeTaskError(c, err, "failed to requeue task")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// HandleRequeueTasks 将匹配 state (必填) 和 kind 的任务重新排队
+func (h *TaskHandler) HandleRequeueTasks(c *gin.Context) {
+	filter, err := services.ParseTaskFilter(c.Query("state"), c.Query("kind"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidTaskFilterMessage})
+		return
+	}
+
+	n, err := h.taskSvc.RequeueTasks(filter, c.GetString("userID"))
+	if err != nil {
+		log.Printf("ERROR: Failed to requeue tasks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to requeue tasks", "requeued": n})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requeued": n})
+}
+
+// HandlePurgeTask 删除单个任务
+func (h *TaskHandler) HandlePurgeTask(c *gin.Context) {
+	if err := h.taskSvc.PurgeTask(c.Param("id"), c.GetString("userID")); err != nil {
+		writeTaskError(c, err, "failed to purge task")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// HandlePurgeTasks 删除匹配 state (必填) 和 kind 的任务
+func (h *TaskHandler) HandlePurgeTasks(c *gin.Context) {
+	filter, err := services.ParseTaskFilter(c.Query("state"), c.Query("kind"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidTaskFilterMessage})
+		return
+	}
+
+	n, err := h.taskSvc.PurgeTasks(filter, c.GetString("userID"))
+	if err != nil {
+		log.Printf("ERROR: Failed to purge tasks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to purge tasks", "purged": n})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": n})
+}
+
+func writeTaskError(c *gin.Context, err error, message string) {
+	if errors.Is(err, queue.ErrTaskNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task with the specified ID was not found"})
+		return
+	}
+	if errors.Is(err, queue.ErrTaskInFlight) {
+		c.JSON(http.StatusConflict, gin.H{"error": "task is being processed, try again later"})
+		return
+	}
+	log.Printf("ERROR: Task %s: %s: %v", c.Param("id"), message, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TaxonomyHandler 负责处理垃圾分类体系和收集统计相关的 API 请求
+type TaxonomyHandler struct {
+	taxonomySvc *services.TaxonomyService
+}
+
+// NewTaxonomyHandler 创建一个新的 TaxonomyHandler
+func NewTaxonomyHandler(svc *services.TaxonomyService) *TaxonomyHandler {
+	return &TaxonomyHandler{taxonomySvc: svc}
+}
+
+// HandleListCategories 返回所有垃圾类别及其模型类别映射
+func (h *TaxonomyHandler) HandleListCategories(c *gin.Context) {
+	categories, err := h.taxonomySvc.ListCategories(c.Request.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to list trash categories: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve trash categories"})
+		return
+	}
+	if categories == nil {
+		categories = []*models.TrashCategory{}
+	}
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+}
+
+// HandleGetCategory 返回单个垃圾类别
+func (h *TaxonomyHandler) HandleGetCategory(c *gin.Context) {
+	category, err := h.taxonomySvc.GetCategory(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeCategoryError(c, "retrieve", err)
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+// HandleCreateCategory 创建垃圾类别
+func (h *TaxonomyHandler) HandleCreateCategory(c *gin.Context) {
+	var req models.CreateTrashCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: id, name_zh and name_en are required"})
+		return
+	}
+
+	category, err := h.taxonomySvc.CreateCategory(c.Request.Context(), req.ID, req.TrashCategoryRequest)
+	if err != nil {
+		h.writeCategoryError(c, "create", err)
+		return
+	}
+	c.JSON(http.StatusCreated, category)
+}
+
+// HandleUpdateCategory 更新垃圾类别，model_classes 会整体替换原有映射
+func (h *TaxonomyHandler) HandleUpdateCategory(c *gin.Context) {
+	var req models.TrashCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: name_zh and name_en are required"})
+		return
+	}
+
+	category, err := h.taxonomySvc.UpdateCategory(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		h.writeCategoryError(c, "update", err)
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+// HandleDeleteCategory 删除垃圾类别
+func (h *TaxonomyHandler) HandleDeleteCategory(c *gin.Context) {
+	if err := h.taxonomySvc.DeleteCategory(c.Request.Context(), c.Param("id")); err != nil {
+		h.writeCategoryError(c, "delete", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// writeCategoryError 将类别操作的错误映射为 HTTP 响应
+func (h *TaxonomyHandler) writeCategoryError(c *gin.Context, op string, err error) {
+	switch {
+	case errors.Is(err, services.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "trash category with the specified ID was not found"})
+	case errors.Is(err, services.ErrInvalidCategory):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category: id must match [a-z0-9_-]{1,64} and estimated_weight_grams must not be negative"})
+	case errors.Is(err, db.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "category ID or model class is already in use"})
+	default:
+		log.Printf("ERROR: Failed to %s trash category %s: %v", op, c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to " + op + " trash category"})
+	}
+}
+
+// HandleGetCollectionStats 按类别、车辆、区域 (geohash) 或日期统计拾取数量和估计质量
+func (h *TaxonomyHandler) HandleGetCollectionStats(c *gin.Context) {
+	startTime, endTime, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := services.CollectionStatsQuery{
+		StartTime: startTime,
+		EndTime:   endTime,
+		GroupBy:   c.DefaultQuery("group_by", services.StatsByCategory),
+	}
+	if query.ZonePrecision, err = strconv.Atoi(c.DefaultQuery("zone_precision", strconv.Itoa(services.DefaultZonePrecision))); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'zone_precision' parameter: must be an integer"})
+		return
+	}
+	if query.Location, err = time.LoadLocation(c.DefaultQuery("tz", "UTC")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'tz' parameter: must be an IANA time zone name"})
+		return
+	}
+
+	stats, err := h.taxonomySvc.CollectionStats(c.Request.Context(), query)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidStatsGroupBy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'group_by' parameter: use category, vehicle, zone (zone_precision 1-12) or day"})
+			return
+		}
+		log.Printf("ERROR: Failed to compute collection statistics: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute collection statistics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"group_by": query.GroupBy, "stats": stats})
+}
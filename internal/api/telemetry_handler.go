@@ -3,6 +3,7 @@ package api
 import (
 	"net/http"
 	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -51,3 +52,23 @@ func (h *TelemetryHandler) HandleGetTelemetry(c *gin.Context) {
 
 	c.JSON(http.StatusOK, telemetry)
 }
+
+// HandleGetTelemetryRollups 返回车辆的遥测小时汇总 (原始遥测超过保留期后仅保留汇总)
+func (h *TelemetryHandler) HandleGetTelemetryRollups(c *gin.Context) {
+	startTime, endTime, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rollups, err := h.repo.ListTelemetryRollups(c.Request.Context(), c.Param("id"), startTime, endTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get telemetry rollups"})
+		return
+	}
+	if rollups == nil {
+		rollups = []*models.TelemetryRollup{}
+	}
+
+	c.JSON(http.StatusOK, rollups)
+}
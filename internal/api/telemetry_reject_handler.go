@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"patrol-cloud/internal/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TelemetryRejectHandler 负责查询被隔离的不合法状态上报
+type TelemetryRejectHandler struct {
+	rejectSvc *services.TelemetryRejectService
+}
+
+// NewTelemetryRejectHandler 创建一个新的 TelemetryRejectHandler
+func NewTelemetryRejectHandler(svc *services.TelemetryRejectService) *TelemetryRejectHandler {
+	return &TelemetryRejectHandler{rejectSvc: svc}
+}
+
+// HandleListRejects 返回车辆在时间范围内被隔离的状态上报 (含原始 Payload)，可按 reason 筛选
+func (h *TelemetryRejectHandler) HandleListRejects(c *gin.Context) {
+	vehicleID := c.Param("id")
+	startTime, endTime, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'limit' parameter: must be an integer between 1 and 1000"})
+		return
+	}
+
+	rejects, err := h.rejectSvc.ListRejects(c.Request.Context(), c.GetString("userID"), vehicleID, c.Query("reason"), startTime, endTime, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrAccessDenied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "access to this vehicle is not permitted"})
+			return
+		}
+		log.Printf("ERROR: Failed to list telemetry rejects of vehicle %s: %v", vehicleID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list telemetry rejects"})
+		return
+	}
+	c.JSON(http.StatusOK, rejects)
+}
+
+// HandleGetRejectSummary 按车辆和原因统计时间范围内被隔离的状态上报 (仅管理员)
+func (h *TelemetryRejectHandler) HandleGetRejectSummary(c *gin.Context) {
+	startTime, endTime, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	counts, err := h.rejectSvc.CountRejects(c.Request.Context(), startTime, endTime)
+	if err != nil {
+		log.Printf("ERROR: Failed to count telemetry rejects: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count telemetry rejects"})
+		return
+	}
+	c.JSON(http.StatusOK, counts)
+}
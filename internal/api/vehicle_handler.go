@@ -4,6 +4,8 @@ import (
 	"errors"
 	"net/http"
 	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
@@ -11,12 +13,13 @@ import (
 
 // VehicleHandler 负责处理与车辆相关的 API 请求
 type VehicleHandler struct {
-	repo db.Repository
+	repo        db.Repository
+	presenceSvc *services.PresenceService
 }
 
 // NewVehicleHandler 创建一个新的 VehicleHandler
-func NewVehicleHandler(repo db.Repository) *VehicleHandler {
-	return &VehicleHandler{repo: repo}
+func NewVehicleHandler(repo db.Repository, presenceSvc *services.PresenceService) *VehicleHandler {
+	return &VehicleHandler{repo: repo, presenceSvc: presenceSvc}
 }
 
 // HandleListVehicles 处理获取车辆列表的请求
@@ -28,6 +31,7 @@ func (h *VehicleHandler) HandleListVehicles(c *gin.Context) {
 		return
 	}
 
+	h.presenceSvc.FillPresence(vehicles, time.Now())
 	c.JSON(http.StatusOK, vehicles)
 }
 
@@ -47,6 +51,11 @@ func (h *VehicleHandler) HandleGetVehicleByID(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "an internal error occurred while retrieving vehicle details"})
 		return
 	}
+	if vehicle == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "vehicle with the specified ID was not found"})
+		return
+	}
 
+	vehicle.Presence = h.presenceSvc.Presence(vehicle.ID, time.Now())
 	c.JSON(http.StatusOK, vehicle)
 }
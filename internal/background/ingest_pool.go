@@ -0,0 +1,154 @@
+package background
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"patrol-cloud/internal/metrics"
+	"sync"
+	"time"
+)
+
+// IngestOptions 是 IngestPool 的配置，零值字段使用默认值
+type IngestOptions struct {
+	Workers   int           // 分片 (worker) 数，默认 8
+	QueueSize int           // 每个分片的队列长度，默认 256
+	MaxWait   time.Duration // 分片队列满时提交方最多等待的时间，默认 100 毫秒；为负数时不等待
+}
+
+const (
+	defaultIngestWorkers   = 8
+	defaultIngestQueueSize = 256
+	defaultIngestMaxWait   = 100 * time.Millisecond
+)
+
+// ingestJob 是分片队列中的一项工作
+type ingestJob struct {
+	run        func(ctx context.Context)
+	enqueuedAt time.Time
+}
+
+// IngestPool 是按键 (车辆 ID) 分片的有界 worker 池：同一个键的工作总是进入同一分片，
+// 由该分片唯一的 worker 按提交顺序执行。分片队列满时 Submit 阻塞至多 MaxWait 向上游施加背压，
+// 仍无空位时丢弃该工作并计数。
+type IngestPool struct {
+	shards  []chan ingestJob
+	maxWait time.Duration
+
+	mu     sync.RWMutex // 保护 closed，避免向已关闭的分片发送
+	closed bool
+	wg     sync.WaitGroup
+
+	queueWait *metrics.Histogram
+	processed *metrics.Counter
+	dropped   *metrics.Counter
+}
+
+// NewIngestPool 创建池并立即启动各分片的 worker，name 作为指标名前缀
+func NewIngestPool(name string, opts IngestOptions) *IngestPool {
+	if opts.Workers <= 0 {
+		opts.Workers = defaultIngestWorkers
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultIngestQueueSize
+	}
+	if opts.MaxWait == 0 {
+		opts.MaxWait = defaultIngestMaxWait
+	}
+
+	p := &IngestPool{
+		shards:    make([]chan ingestJob, opts.Workers),
+		maxWait:   opts.MaxWait,
+		queueWait: metrics.Default.Histogram(name+".queue_wait", metrics.DefaultLatencyBounds),
+		processed: metrics.Default.Counter(name + ".processed"),
+		dropped:   metrics.Default.Counter(name + ".dropped"),
+	}
+	for i := range p.shards {
+		p.shards[i] = make(chan ingestJob, opts.QueueSize)
+		p.wg.Add(1)
+		go p.worker(p.shards[i])
+	}
+	metrics.Default.GaugeFunc(name+".queue_depth", func() interface{} { return p.QueueDepth() })
+	metrics.Default.GaugeFunc(name+".queue_capacity", func() interface{} { return len(p.shards) * opts.QueueSize })
+	return p
+}
+
+// Submit 将 fn 放入 key 所在分片的队列，返回是否被接受 (队列持续满或池已关闭时返回 false)
+func (p *IngestPool) Submit(key string, fn func(ctx context.Context)) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		p.dropped.Inc()
+		return false
+	}
+
+	shard := p.shards[shardIndex(key, len(p.shards))]
+	job := ingestJob{run: fn, enqueuedAt: time.Now()}
+	select {
+	case shard <- job:
+		return true
+	default:
+	}
+	if p.maxWait < 0 {
+		p.dropped.Inc()
+		return false
+	}
+
+	timer := time.NewTimer(p.maxWait)
+	defer timer.Stop()
+	select {
+	case shard <- job:
+		return true
+	case <-timer.C:
+		p.dropped.Inc()
+		return false
+	}
+}
+
+// QueueDepth 返回所有分片中排队的工作数
+func (p *IngestPool) QueueDepth() int {
+	depth := 0
+	for _, shard := range p.shards {
+		depth += len(shard)
+	}
+	return depth
+}
+
+// Close 停止接受新工作，等待已排队的工作全部执行完毕
+func (p *IngestPool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, shard := range p.shards {
+			close(shard)
+		}
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func (p *IngestPool) worker(jobs <-chan ingestJob) {
+	defer p.wg.Done()
+	ctx := context.Background()
+	for job := range jobs {
+		p.queueWait.Observe(time.Since(job.enqueuedAt))
+		runIngestJob(ctx, job)
+		p.processed.Inc()
+	}
+}
+
+// runIngestJob 执行一项工作，panic 只记录日志，避免拖垮整个分片
+func runIngestJob(ctx context.Context, job ingestJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("level=error msg=\"ingest job panicked\" error=\"%v\"", r)
+		}
+	}()
+	job.run(ctx)
+}
+
+func shardIndex(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
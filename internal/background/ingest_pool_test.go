@@ -0,0 +1,54 @@
+package background
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestPoolKeepsPerKeyOrder(t *testing.T) {
+	p := NewIngestPool("test.ingest_order", IngestOptions{Workers: 4, QueueSize: 1000})
+
+	var mu sync.Mutex
+	seen := make(map[string][]int)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("v%d", i%7)
+		require.True(t, p.Submit(key, func(ctx context.Context) {
+			mu.Lock()
+			seen[key] = append(seen[key], i)
+			mu.Unlock()
+		}))
+	}
+	p.Close()
+
+	total := 0
+	for key, order := range seen {
+		assert.IsIncreasing(t, order, key)
+		total += len(order)
+	}
+	assert.Equal(t, 200, total)
+	assert.False(t, p.Submit("v0", func(context.Context) {}), "closed pool rejects work")
+}
+
+func TestIngestPoolDropsWhenFull(t *testing.T) {
+	p := NewIngestPool("test.ingest_drop", IngestOptions{Workers: 1, QueueSize: 1, MaxWait: -1})
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	require.True(t, p.Submit("v1", func(context.Context) { close(started); <-release }))
+	<-started
+	require.True(t, p.Submit("v1", func(context.Context) {}))
+	assert.Equal(t, 1, p.QueueDepth())
+
+	// worker 忙且队列已满
+	assert.False(t, p.Submit("v1", func(context.Context) {}))
+	assert.EqualValues(t, 1, p.dropped.Value())
+
+	close(release)
+	p.Close()
+	assert.EqualValues(t, 2, p.processed.Value())
+}
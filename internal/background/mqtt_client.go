@@ -0,0 +1,221 @@
+package background
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"patrol-cloud/internal/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTTOptions 是 MQTT 连接的配置
+type MQTTOptions struct {
+	Broker   string
+	Username string
+	Password string
+
+	// ClientID 为空时使用 ClientIDPrefix-<主机名>，保证多个副本的客户端 ID 不冲突 (冲突时 Broker 会互相踢下线)，
+	// 同时同一副本重启后仍能恢复自己的持久会话
+	ClientID       string
+	ClientIDPrefix string
+
+	// TLS：CACertFile 用于校验 Broker 证书，ClientCertFile/ClientKeyFile 用于双向认证，均为空时不启用 TLS
+	// (除非 Broker 地址本身是 ssl:// 或 tls://，此时使用系统根证书)
+	CACertFile     string
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// CleanSession 为 false 时 Broker 保留会话，断线期间的 QoS 1 消息在重连后补发
+	CleanSession         bool
+	KeepAlive            time.Duration
+	ConnectTimeout       time.Duration
+	MaxReconnectInterval time.Duration
+}
+
+// MQTTConnection 封装 MQTT 客户端：自动重连，每次 (重新) 连接后调用已注册的 OnConnect 回调 (用于重新订阅)，
+// 并通过日志和指标报告连接状态
+type MQTTConnection struct {
+	client       mqtt.Client
+	clientID     string
+	cleanSession bool
+
+	mu        sync.Mutex
+	onConnect []func(mqtt.Client)
+
+	connected      atomic.Bool
+	connects       *metrics.Counter
+	connectionLost *metrics.Counter
+}
+
+// NewMQTTConnection 根据配置创建 MQTT 连接 (尚未连接，需调用 Connect)
+func NewMQTTConnection(opts MQTTOptions) (*MQTTConnection, error) {
+	clientID, err := resolveClientID(opts)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := newMQTTTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &MQTTConnection{
+		clientID:       clientID,
+		cleanSession:   opts.CleanSession,
+		connects:       metrics.Default.Counter("mqtt.connects"),
+		connectionLost: metrics.Default.Counter("mqtt.connection_lost"),
+	}
+	metrics.Default.GaugeFunc("mqtt.connected", func() interface{} { return c.connected.Load() })
+
+	clientOpts := mqtt.NewClientOptions().
+		AddBroker(opts.Broker).
+		SetClientID(clientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetCleanSession(opts.CleanSession).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(c.handleConnect).
+		SetConnectionLostHandler(c.handleConnectionLost).
+		SetReconnectingHandler(c.handleReconnecting)
+	if opts.KeepAlive > 0 {
+		clientOpts.SetKeepAlive(opts.KeepAlive)
+	}
+	if opts.ConnectTimeout > 0 {
+		clientOpts.SetConnectTimeout(opts.ConnectTimeout)
+	}
+	if opts.MaxReconnectInterval > 0 {
+		clientOpts.SetMaxReconnectInterval(opts.MaxReconnectInterval)
+		clientOpts.SetConnectRetryInterval(opts.MaxReconnectInterval)
+	}
+	if tlsConfig != nil {
+		clientOpts.SetTLSConfig(tlsConfig)
+	}
+
+	c.client = mqtt.NewClient(clientOpts)
+	return c, nil
+}
+
+// Client 返回底层的 MQTT 客户端
+func (c *MQTTConnection) Client() mqtt.Client {
+	return c.client
+}
+
+// ClientID 返回实际使用的客户端 ID
+func (c *MQTTConnection) ClientID() string {
+	return c.clientID
+}
+
+// CleanSession 返回是否使用清除会话 (为 false 时 Broker 在断开后保留订阅和未送达的消息)
+func (c *MQTTConnection) CleanSession() bool {
+	return c.cleanSession
+}
+
+// IsConnected 返回当前是否已连接到 Broker
+func (c *MQTTConnection) IsConnected() bool {
+	return c.connected.Load()
+}
+
+// OnConnect 注册在每次 (重新) 连接成功后调用的回调。已连接时立即调用一次。
+func (c *MQTTConnection) OnConnect(fn func(mqtt.Client)) {
+	c.mu.Lock()
+	c.onConnect = append(c.onConnect, fn)
+	c.mu.Unlock()
+	if c.connected.Load() {
+		go fn(c.client)
+	}
+}
+
+// Connect 连接到 Broker，timeout 内首次连接未成功时返回错误 (客户端仍会在后台继续重试)
+func (c *MQTTConnection) Connect(timeout time.Duration) error {
+	token := c.client.Connect()
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("timed out after %s connecting to MQTT broker", timeout)
+	}
+	return token.Error()
+}
+
+// Disconnect 断开连接，最多等待 quiesce 毫秒让未完成的工作结束
+func (c *MQTTConnection) Disconnect(quiesce uint) {
+	c.client.Disconnect(quiesce)
+	c.connected.Store(false)
+}
+
+// handleConnect 由 paho 在独立的 goroutine 中调用，依次执行已注册的回调
+func (c *MQTTConnection) handleConnect(client mqtt.Client) {
+	c.connected.Store(true)
+	c.connects.Inc()
+	log.Printf("level=info msg=\"mqtt connected\" client_id=%s", c.clientID)
+
+	c.mu.Lock()
+	handlers := append([]func(mqtt.Client){}, c.onConnect...)
+	c.mu.Unlock()
+	for _, fn := range handlers {
+		fn(client)
+	}
+}
+
+func (c *MQTTConnection) handleConnectionLost(client mqtt.Client, err error) {
+	c.connected.Store(false)
+	c.connectionLost.Inc()
+	log.Printf("level=warn msg=\"mqtt connection lost\" client_id=%s error=\"%v\"", c.clientID, err)
+}
+
+func (c *MQTTConnection) handleReconnecting(client mqtt.Client, opts *mqtt.ClientOptions) {
+	log.Printf("level=info msg=\"mqtt reconnecting\" client_id=%s", c.clientID)
+}
+
+// resolveClientID 返回配置的客户端 ID，未配置时由前缀和主机名生成 (主机名不可用时使用随机后缀)
+func resolveClientID(opts MQTTOptions) (string, error) {
+	if opts.ClientID != "" {
+		return opts.ClientID, nil
+	}
+	suffix, err := os.Hostname()
+	if err != nil || suffix == "" {
+		b := make([]byte, 4)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("failed to generate MQTT client ID: %w", err)
+		}
+		suffix = hex.EncodeToString(b)
+	}
+	return opts.ClientIDPrefix + "-" + suffix, nil
+}
+
+// newMQTTTLSConfig 根据证书配置构造 TLS 配置，未配置任何证书时返回 nil
+func newMQTTTLSConfig(opts MQTTOptions) (*tls.Config, error) {
+	if opts.CACertFile == "" && opts.ClientCertFile == "" && opts.ClientKeyFile == "" {
+		return nil, nil
+	}
+	if (opts.ClientCertFile == "") != (opts.ClientKeyFile == "") {
+		return nil, errors.New("MQTT client certificate and key must be configured together")
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CACertFile != "" {
+		pem, err := os.ReadFile(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MQTT CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in %s", opts.CACertFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if opts.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load MQTT client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,35 @@
+package background
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMQTTClientOptions(t *testing.T) {
+	// 显式配置的客户端 ID 优先，否则由前缀和主机名生成
+	id, err := resolveClientID(MQTTOptions{ClientID: "fixed", ClientIDPrefix: "patrol"})
+	require.NoError(t, err)
+	assert.Equal(t, "fixed", id)
+	id, err = resolveClientID(MQTTOptions{ClientIDPrefix: "patrol"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(id, "patrol-"))
+	assert.Greater(t, len(id), len("patrol-"))
+
+	// 未配置证书时不启用 TLS
+	cfg, err := newMQTTTLSConfig(MQTTOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	_, err = newMQTTTLSConfig(MQTTOptions{ClientCertFile: "client.pem"})
+	assert.Error(t, err, "certificate without key")
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+	_, err = newMQTTTLSConfig(MQTTOptions{CACertFile: caFile})
+	assert.Error(t, err)
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"log"
-	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/metrics"
 	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/services"
 	"strings"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -14,84 +16,174 @@ import (
 
 // MQTTListener 遵循 4.2.6 设计
 type MQTTListener struct {
-	Client     mqtt.Client
-	HubChannel chan<- []byte // (只写通道，推向 TelemetryHub)
-	repo       db.Repository
+	Conn       *MQTTConnection
+	HubChannel chan<- []byte                    // (只写通道，推向 TelemetryHub)
+	writer     *TelemetryWriter                 // 批量持久化遥测和车辆当前状态
+	rejects    *services.TelemetryRejectService // 校验状态上报并隔离不合法的上报
+	presence   *services.PresenceService        // 根据消息到达时间和遗嘱消息跟踪车辆在线状态
+	pool       *IngestPool                      // 按车辆分片处理状态消息，保证同一车辆的写入顺序
+
+	stop     chan struct{} // Stop 时关闭，结束订阅重试
+	stopOnce sync.Once
+
+	broadcastDropped *metrics.Counter
+	subscribeFailed  *metrics.Counter
 }
 
-func NewMQTTListener(client mqtt.Client, hubChannel chan<- []byte, repo db.Repository) *MQTTListener {
+func NewMQTTListener(conn *MQTTConnection, hubChannel chan<- []byte, writer *TelemetryWriter, rejects *services.TelemetryRejectService, presence *services.PresenceService, opts IngestOptions) *MQTTListener {
 	return &MQTTListener{
-		Client:     client,
-		HubChannel: hubChannel,
-		repo:       repo,
+		Conn:             conn,
+		HubChannel:       hubChannel,
+		writer:           writer,
+		rejects:          rejects,
+		presence:         presence,
+		pool:             NewIngestPool("mqtt.ingest", opts),
+		stop:             make(chan struct{}),
+		broadcastDropped: metrics.Default.Counter("mqtt.ingest.broadcast_dropped"),
+		subscribeFailed:  metrics.Default.Counter("mqtt.subscribe_failed"),
 	}
 }
 
-// StartListening 订阅主题并启动监听
+const (
+	// statusTopic 是车辆状态上报的通配符主题 (如 4.2.6 所述)
+	statusTopic = "vehicles/+/status"
+	// presenceTopic 是车辆的上下线通知：连接后发布 "online"，并将 "offline" 设为 MQTT 遗嘱消息
+	presenceTopic = "vehicles/+/presence"
+)
+
+// maxSubscribeRetryInterval 是订阅失败后重试的最长间隔
+const maxSubscribeRetryInterval = 30 * time.Second
+
+// StartListening 注册主题的处理函数，并在每次 (重新) 连接后订阅主题。应在 Connect 之前调用：
+// 持久会话在重连后会立即补发断线期间的消息，处理函数必须先于订阅就绪。
 func (l *MQTTListener) StartListening() {
-	// (订阅通配符主题，如 4.2.6 所述)
-	const topic = "vehicles/+/status"
+	client := l.Conn.Client()
+	client.AddRoute(statusTopic, l.onStatusMessage)
+	client.AddRoute(presenceTopic, l.onPresenceMessage)
+	l.Conn.OnConnect(l.subscribe)
+}
+
+// subscribe 订阅状态和上下线主题，失败时在连接保持期间按递增的间隔重试，直到 Stop 被调用
+// (Broker 重启后如果会话丢失，不重新订阅就再也收不到消息)
+func (l *MQTTListener) subscribe(client mqtt.Client) {
+	topics := map[string]byte{statusTopic: 1, presenceTopic: 1}
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-l.stop:
+			return
+		default:
+		}
+		token := client.SubscribeMultiple(topics, nil)
+		if token.Wait() && token.Error() == nil {
+			log.Printf("INFO: MQTTListener subscribed to topics: %s, %s", statusTopic, presenceTopic)
+			return
+		}
+		l.subscribeFailed.Inc()
+		log.Printf("ERROR: Failed to subscribe to MQTT topics (attempt %d): %v", attempt, token.Error())
+		if !client.IsConnectionOpen() {
+			return // 重连后 OnConnect 会再次订阅
+		}
+		select {
+		case <-l.stop:
+			return
+		case <-time.After(min(time.Duration(attempt)*time.Second, maxSubscribeRetryInterval)):
+		}
+	}
+}
+
+// Stop 停止接收消息，并等待已接收的状态消息处理完毕 (之后应关闭 TelemetryWriter 以写入剩余数据)。
+// 持久会话 (CleanSession 为 false) 时不取消订阅而是直接断开，Broker 保留订阅并暂存停机期间的消息，
+// 重启后补发；取消订阅会让这段时间的消息丢失。
+func (l *MQTTListener) Stop() {
+	l.stopOnce.Do(func() { close(l.stop) })
+	if l.Conn.CleanSession() {
+		if token := l.Conn.Client().Unsubscribe(statusTopic, presenceTopic); token.WaitTimeout(time.Second) && token.Error() != nil {
+			log.Printf("WARN: Failed to unsubscribe from MQTT topics: %v", token.Error())
+		}
+	} else {
+		l.Conn.Disconnect(250)
+	}
+	l.pool.Close()
+}
 
-	if token := l.Client.Subscribe(topic, 1, l.onStatusMessage); token.Wait() && token.Error() != nil {
-		log.Fatalf("Failed to subscribe to MQTT topic %s: %v", topic, token.Error())
+// vehicleIDFromTopic 从 vehicles/<id>/<kind> 中解析车辆 ID
+func vehicleIDFromTopic(topic string) (string, bool) {
+	parts := strings.Split(topic, "/")
+	if len(parts) < 3 || parts[1] == "" {
+		return "", false
 	}
-	log.Printf("INFO: MQTTListener subscribed to topic: %s", topic)
+	return parts[1], true
 }
 
-// onStatusMessage 是 4.2.6 的 _onStatusMessage 实现
+// onPresenceMessage 处理车辆的上下线通知，Payload 为 "online" 或 "offline"
+func (l *MQTTListener) onPresenceMessage(client mqtt.Client, msg mqtt.Message) {
+	vehicleID, ok := vehicleIDFromTopic(msg.Topic())
+	if !ok {
+		log.Printf("WARN: Received message on unexpected topic: %s", msg.Topic())
+		return
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(msg.Payload()))) {
+	case models.PresenceOnline:
+		// 保留消息在服务器重新订阅时也会收到，不能据此认为车辆当前在线
+		if !msg.Retained() {
+			l.presence.Seen(vehicleID, time.Now())
+		}
+	case models.PresenceOffline:
+		l.presence.MarkOffline(vehicleID, time.Now())
+	default:
+		log.Printf("WARN: Unknown presence payload from %s: %q", vehicleID, msg.Payload())
+	}
+}
+
+// onStatusMessage 是 4.2.6 的 _onStatusMessage 实现。
+// paho 按到达顺序逐条回调，这里只做解析并提交到车辆所在的分片，
+// 分片队列满时回调阻塞 (背压)，超时后丢弃该消息。
 func (l *MQTTListener) onStatusMessage(client mqtt.Client, msg mqtt.Message) {
 	log.Printf("DEBUG: Received MQTT message on topic: %s", msg.Topic())
 
-	// 1. 解析 vehicle_id (如 3.3.2 所需)
-	topicParts := strings.Split(msg.Topic(), "/")
-	if len(topicParts) < 3 {
+	// 1. 解析 vehicle_id (如 3.3.2 所需)，收到任何消息都说明车辆在线
+	vehicleID, ok := vehicleIDFromTopic(msg.Topic())
+	if !ok {
 		log.Printf("WARN: Received message on unexpected topic: %s", msg.Topic())
 		return
 	}
-	vehicleID := topicParts[1]
+	l.presence.Seen(vehicleID, time.Now())
 
-	// 2. 反序列化 Payload (来自 3.1.1)
-	var status models.VehicleStatus
-	if err := json.Unmarshal(msg.Payload(), &status); err != nil {
-		log.Printf("WARN: Failed to unmarshal status from %s: %v", vehicleID, err)
+	// 2. 反序列化并校验 Payload (来自 3.1.1)，不合法的上报被隔离，不进入广播和历史数据
+	status, reject := l.rejects.Inspect(vehicleID, msg.Topic(), msg.Payload())
+	if reject != nil {
+		l.pool.Submit(vehicleID, func(ctx context.Context) { l.rejects.Quarantine(ctx, reject) })
 		return
 	}
 
-	// 3. 启动 goroutine 处理实时广播和数据库持久化
-	go func() {
-		// 3a. 广播到 WebSocket Hub
-		updateMsg := models.TelemetryUpdate{
-			VehicleID:     vehicleID,
-			VehicleStatus: status,
-		}
-		updateBytes, err := json.Marshal(updateMsg)
-		if err != nil {
-			log.Printf("ERROR: Failed to marshal telemetry update for broadcast: %v", err)
-		} else {
-			l.HubChannel <- updateBytes
-		}
-	}()
-
-	// 4. 启动另一个 goroutine 处理数据库操作，与广播分离
-	go func() {
-		ctx := context.Background()
+	// 3. 交给车辆所在的分片按顺序广播和持久化
+	if !l.pool.Submit(vehicleID, func(ctx context.Context) { l.handleStatus(ctx, vehicleID, status) }) {
+		log.Printf("WARN: Ingest queue full, dropped status from %s (timestamp %d)", vehicleID, status.Timestamp)
+	}
+}
 
-		// 4a. 更新车辆当前状态
-		if err := l.repo.UpdateVehicleStatus(ctx, vehicleID, &status); err != nil {
-			log.Printf("ERROR: Failed to update vehicle current status: %v", err)
-		}
+// handleStatus 在车辆所在分片的 worker 中执行，同一车辆的状态按接收顺序处理
+func (l *MQTTListener) handleStatus(ctx context.Context, vehicleID string, status *models.VehicleStatus) {
+	// 1. 交给批量写入器持久化历史遥测和车辆当前状态。迟到或重复的状态只进入历史，不再广播
+	if !l.writer.Add(vehicleID, status) {
+		return
+	}
 
-		// 4b. 插入历史遥测数据
-		telemetryEntry := &models.VehicleTelemetry{
-			VehicleID: vehicleID,
-			Timestamp: time.Unix(status.Timestamp, 0),
-			Latitude:  status.Position.Lat,
-			Longitude: status.Position.Lng,
-			Battery:   status.Battery,
-			State:     status.State,
-		}
-		if err := l.repo.CreateTelemetryEntry(ctx, telemetryEntry); err != nil {
-			log.Printf("ERROR: Failed to create telemetry entry: %v", err)
-		}
-	}()
+	// 2. 广播到 WebSocket Hub。Hub 处理不过来时丢弃本次广播，不阻塞持久化
+	updateMsg := models.TelemetryUpdate{
+		Type:          models.UpdateTypeTelemetry,
+		VehicleID:     vehicleID,
+		VehicleStatus: *status,
+	}
+	updateBytes, err := json.Marshal(updateMsg)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal telemetry update for broadcast: %v", err)
+		return
+	}
+	select {
+	case l.HubChannel <- updateBytes:
+	default:
+		l.broadcastDropped.Inc()
+	}
 }
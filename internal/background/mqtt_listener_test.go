@@ -0,0 +1,64 @@
+package background
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+)
+
+// failedToken 是立即完成并返回错误的 MQTT token
+type failedToken struct{ err error }
+
+func (t failedToken) Wait() bool                     { return true }
+func (t failedToken) WaitTimeout(time.Duration) bool { return true }
+func (t failedToken) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+func (t failedToken) Error() error { return t.err }
+
+// refusingClient 保持连接，但每次订阅都失败，并记录是否取消过订阅
+type refusingClient struct {
+	mqtt.Client
+	attempts     chan struct{}
+	unsubscribed bool
+}
+
+func (c *refusingClient) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.attempts <- struct{}{}
+	return failedToken{err: errors.New("not authorized")}
+}
+
+func (c *refusingClient) Unsubscribe(topics ...string) mqtt.Token {
+	c.unsubscribed = true
+	return failedToken{}
+}
+
+func (c *refusingClient) IsConnectionOpen() bool { return true }
+
+func TestMQTTListenerSubscribeStops(t *testing.T) {
+	client := &refusingClient{attempts: make(chan struct{}, 1)}
+	conn := &MQTTConnection{client: client, cleanSession: true}
+	l := NewMQTTListener(conn, nil, nil, nil, nil, IngestOptions{})
+
+	done := make(chan struct{})
+	go func() {
+		l.subscribe(client)
+		close(done)
+	}()
+	<-client.attempts
+
+	// 订阅失败后等待重试期间停止，重试循环立即结束
+	l.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscribe retry loop did not stop")
+	}
+	assert.Empty(t, client.attempts)
+	assert.True(t, client.unsubscribed, "clean sessions unsubscribe on stop")
+}
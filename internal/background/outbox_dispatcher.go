@@ -0,0 +1,165 @@
+package background
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/queue"
+	"sync"
+	"time"
+)
+
+// OutboxHandler 处理一种发件箱消息，返回 nil 表示完成 (消息被删除)，返回错误则按退避重试。
+// 消息可能被重复处理，OutboxHandler 必须是幂等的。
+type OutboxHandler func(ctx context.Context, msg *models.OutboxMessage) error
+
+// OutboxOptions 是分发器的配置，零值字段使用默认值
+type OutboxOptions struct {
+	MaxAttempts  int                              // 标记为死信前的最大失败次数，默认 10
+	BatchSize    int                              // 每次领取的消息数，默认 10
+	Lease        time.Duration                    // 领取的消息在该时间内不会被再次领取，应大于处理一批消息的时间，默认 5 分钟
+	PollInterval time.Duration                    // 发件箱为空时的轮询间隔，默认 1 秒
+	Backoff      func(attempts int) time.Duration // 第 attempts 次失败后的重试间隔，默认与任务队列相同
+}
+
+const (
+	defaultOutboxMaxAttempts  = 10
+	defaultOutboxBatchSize    = 10
+	defaultOutboxLease        = 5 * time.Minute
+	defaultOutboxPollInterval = time.Second
+)
+
+// OutboxDispatcher 轮询数据库中的发件箱，将到期的消息交给按 kind 注册的处理函数。
+// 消息以 FOR UPDATE SKIP LOCKED 领取并获得租约，多个服务副本可同时运行分发器而不会重复处理；
+// 处理函数在事务之外执行，不占用数据库连接。
+type OutboxDispatcher struct {
+	repo     db.Repository
+	opts     OutboxOptions
+	handlers map[string]OutboxHandler
+}
+
+func NewOutboxDispatcher(repo db.Repository, opts OutboxOptions) *OutboxDispatcher {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultOutboxMaxAttempts
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultOutboxBatchSize
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = defaultOutboxLease
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultOutboxPollInterval
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = queue.DefaultBackoff
+	}
+	return &OutboxDispatcher{repo: repo, opts: opts, handlers: make(map[string]OutboxHandler)}
+}
+
+// Register 为一种消息注册处理函数，须在 Start 之前调用
+func (d *OutboxDispatcher) Register(kind string, handler OutboxHandler) {
+	d.handlers[kind] = handler
+}
+
+// Start 启动 workers 个 worker 处理发件箱，直到 ctx 被取消。
+// 返回的 WaitGroup 在所有 worker 退出后完成。
+func (d *OutboxDispatcher) Start(ctx context.Context, workers int) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for i := 0; i < max(1, workers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+	log.Printf("INFO: Outbox dispatcher started with %d workers (batch size %d)", max(1, workers), d.opts.BatchSize)
+	return &wg
+}
+
+func (d *OutboxDispatcher) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := d.DispatchOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("level=error msg=\"outbox: dispatch failed\" error=\"%v\"", err)
+		}
+		// 领满一批说明可能还有积压，立即领取下一批
+		if err == nil && n == d.opts.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(d.opts.PollInterval):
+		}
+	}
+}
+
+// DispatchOnce 领取并处理一批到期的消息，返回领取的条数。
+// 某条消息的结果写回失败时继续处理其余消息，该消息在租约到期后重新领取。
+func (d *OutboxDispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	messages, err := d.repo.ClaimOutboxMessages(ctx, d.opts.BatchSize, d.opts.Lease)
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			// 停机时未处理的消息在租约到期后由其他副本 (或重启后) 领取
+			break
+		}
+		if err := d.dispatch(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("outbox message %d: %w", msg.ID, err))
+		}
+	}
+	return len(messages), errors.Join(errs...)
+}
+
+// dispatch 处理一条消息并写回结果：成功时删除，失败时更新重试时间或标记为死信
+func (d *OutboxDispatcher) dispatch(ctx context.Context, msg *models.OutboxMessage) error {
+	if err := d.handle(ctx, msg); err != nil {
+		if ctx.Err() != nil {
+			// 停机导致的失败不计入失败次数，消息保持原样，租约到期后重新领取
+			return nil
+		}
+		return d.repo.UpdateOutboxMessage(ctx, msg)
+	}
+	return d.repo.DeleteOutboxMessage(ctx, msg.ID)
+}
+
+// handle 执行消息的处理函数，失败时在 msg 中更新重试时间或将其标记为死信
+func (d *OutboxDispatcher) handle(ctx context.Context, msg *models.OutboxMessage) error {
+	var err error
+	if handler, ok := d.handlers[msg.Kind]; !ok {
+		err = fmt.Errorf("no handler registered for outbox kind %q", msg.Kind)
+	} else {
+		err = runOutboxHandler(ctx, handler, msg)
+	}
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	now := time.Now()
+	msg.Attempts++
+	msg.LastError = err.Error()
+	if msg.Attempts >= d.opts.MaxAttempts {
+		msg.DeadAt = &now
+		log.Printf("level=critical msg=\"outbox: message dead-lettered\" outbox_id=%d kind=%s attempts=%d error=\"%v\"", msg.ID, msg.Kind, msg.Attempts, err)
+		return err
+	}
+	msg.AvailableAt = now.Add(d.opts.Backoff(msg.Attempts))
+	log.Printf("level=warn msg=\"outbox: message failed\" outbox_id=%d kind=%s attempt=%d error=\"%v\"", msg.ID, msg.Kind, msg.Attempts, err)
+	return err
+}
+
+// runOutboxHandler 执行处理函数，并将 panic 转换为错误，避免一条消息拖垮 worker
+func runOutboxHandler(ctx context.Context, handler OutboxHandler, msg *models.OutboxMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, msg)
+}
@@ -0,0 +1,97 @@
+package background
+
+import (
+	"context"
+	"errors"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outboxRepo 在内存中模拟发件箱：领取时推迟 AvailableAt 作为租约，记录删除和写回的消息
+type outboxRepo struct {
+	db.Repository
+	messages map[int64]*models.OutboxMessage
+	deleted  []int64
+}
+
+func (r *outboxRepo) ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxMessage, error) {
+	now := time.Now()
+	var claimed []*models.OutboxMessage
+	for _, msg := range r.messages {
+		if len(claimed) == limit || msg.DeadAt != nil || msg.AvailableAt.After(now) {
+			continue
+		}
+		msg.AvailableAt = now.Add(lease)
+		c := *msg
+		claimed = append(claimed, &c)
+	}
+	return claimed, nil
+}
+
+func (r *outboxRepo) DeleteOutboxMessage(ctx context.Context, id int64) error {
+	delete(r.messages, id)
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func (r *outboxRepo) UpdateOutboxMessage(ctx context.Context, msg *models.OutboxMessage) error {
+	c := *msg
+	r.messages[msg.ID] = &c
+	return nil
+}
+
+func TestOutboxDispatcher(t *testing.T) {
+	repo := &outboxRepo{messages: map[int64]*models.OutboxMessage{
+		1: {ID: 1, Kind: "ok"},
+		2: {ID: 2, Kind: "fail"},
+		3: {ID: 3, Kind: "unknown"},
+	}}
+	d := NewOutboxDispatcher(repo, OutboxOptions{MaxAttempts: 2, Lease: time.Hour, Backoff: func(int) time.Duration { return time.Minute }})
+	d.Register("ok", func(ctx context.Context, msg *models.OutboxMessage) error { return nil })
+	d.Register("fail", func(ctx context.Context, msg *models.OutboxMessage) error { return errors.New("boom") })
+
+	n, err := d.DispatchOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []int64{1}, repo.deleted)
+
+	failed := repo.messages[2]
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "boom", failed.LastError)
+	assert.Nil(t, failed.DeadAt)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), failed.AvailableAt, 5*time.Second, "backoff replaces the lease")
+
+	// 未到期的消息不会被再次领取；达到次数上限后标记为死信
+	n, err = d.DispatchOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	failed.AvailableAt = time.Now()
+	_, err = d.DispatchOnce(context.Background())
+	require.NoError(t, err)
+	assert.NotNil(t, repo.messages[2].DeadAt)
+}
+
+func TestOutboxDispatcherShutdown(t *testing.T) {
+	repo := &outboxRepo{messages: map[int64]*models.OutboxMessage{1: {ID: 1, Kind: "slow"}}}
+	d := NewOutboxDispatcher(repo, OutboxOptions{Lease: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	d.Register("slow", func(ctx context.Context, msg *models.OutboxMessage) error {
+		cancel()
+		return ctx.Err()
+	})
+
+	_, err := d.DispatchOnce(ctx)
+	require.NoError(t, err)
+
+	// 停机导致的失败不计入失败次数，消息在租约到期后重新领取
+	msg := repo.messages[1]
+	require.NotNil(t, msg)
+	assert.Zero(t, msg.Attempts)
+	assert.Empty(t, repo.deleted)
+	assert.True(t, msg.AvailableAt.After(time.Now()))
+}
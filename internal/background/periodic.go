@@ -0,0 +1,21 @@
+package background
+
+import (
+	"context"
+	"time"
+)
+
+// runPeriodically 立即执行一次 fn，之后每隔 interval 执行一次，直到 ctx 被取消
+func runPeriodically(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package background
+
+import (
+	"context"
+	"log"
+	"patrol-cloud/internal/services"
+	"time"
+)
+
+// PresenceJob 定期重新计算车辆的在线状态，推送变化并持久化最后在线时间
+type PresenceJob struct {
+	svc      *services.PresenceService
+	interval time.Duration
+}
+
+func NewPresenceJob(svc *services.PresenceService, interval time.Duration) *PresenceJob {
+	return &PresenceJob{svc: svc, interval: interval}
+}
+
+// Start 在后台按 interval 执行，直到 ctx 被取消
+func (j *PresenceJob) Start(ctx context.Context) {
+	go runPeriodically(ctx, j.interval, j.runOnce)
+	log.Printf("INFO: Presence job started (interval %s)", j.interval)
+}
+
+func (j *PresenceJob) runOnce(ctx context.Context) {
+	if err := j.svc.Sweep(ctx, time.Now()); err != nil && ctx.Err() == nil {
+		log.Printf("level=error msg=\"presence sweep failed\" error=\"%v\"", err)
+	}
+}
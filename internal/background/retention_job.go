@@ -0,0 +1,39 @@
+package background
+
+import (
+	"context"
+	"log"
+	"patrol-cloud/internal/services"
+	"time"
+)
+
+// RetentionJob 定期执行数据保留策略
+type RetentionJob struct {
+	svc      *services.RetentionService
+	interval time.Duration
+}
+
+func NewRetentionJob(svc *services.RetentionService, interval time.Duration) *RetentionJob {
+	return &RetentionJob{svc: svc, interval: interval}
+}
+
+// Start 在后台按 interval 执行保留策略 (启动后立即执行一次)，直到 ctx 被取消
+func (j *RetentionJob) Start(ctx context.Context) {
+	go runPeriodically(ctx, j.interval, j.runOnce)
+	log.Printf("INFO: Retention job started (interval %s)", j.interval)
+}
+
+func (j *RetentionJob) runOnce(ctx context.Context) {
+	run := j.svc.Run(ctx, time.Now())
+	if run.Error != "" {
+		log.Printf(
+			"level=error msg=\"retention run failed\" images_deleted=%d objects_deleted=%d telemetry_rolled_up=%d rollups_deleted=%d error=\"%s\"",
+			run.ImagesDeleted, run.ObjectsDeleted, run.TelemetryRolled, run.RollupsDeleted, run.Error,
+		)
+		return
+	}
+	log.Printf(
+		"level=info msg=\"retention run complete\" images_deleted=%d objects_deleted=%d telemetry_rolled_up=%d rollups_deleted=%d duration=%s",
+		run.ImagesDeleted, run.ObjectsDeleted, run.TelemetryRolled, run.RollupsDeleted, run.FinishedAt.Sub(run.StartedAt),
+	)
+}
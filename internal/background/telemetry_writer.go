@@ -0,0 +1,254 @@
+package background
+
+import (
+	"context"
+	"errors"
+	"log"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/metrics"
+	"patrol-cloud/internal/models"
+	"sync"
+	"time"
+)
+
+// TelemetryWriterOptions 是 TelemetryWriter 的配置，零值字段使用默认值
+type TelemetryWriterOptions struct {
+	BatchSize     int           // 缓冲的遥测点达到该数量时立即写入，默认 500
+	FlushInterval time.Duration // 最长写入间隔，默认 1 秒
+	MaxPending    int           // 缓冲上限 (例如数据库不可用时)，超出后丢弃新到的遥测点，写入失败重新排队时丢弃最旧的，默认 20000
+}
+
+const (
+	defaultTelemetryBatchSize     = 500
+	defaultTelemetryFlushInterval = time.Second
+	defaultTelemetryMaxPending    = 20000
+	// telemetryFlushTimeout 是单次写入的时限
+	telemetryFlushTimeout = 10 * time.Second
+)
+
+// TelemetryWriter 缓冲车辆状态，按数量或时间间隔批量写入：
+// 历史遥测用 COPY 一次写入 (重复的遥测点由数据库去重)，
+// 车辆当前状态只保留每辆车最新的一条并合并为一条 UPDATE，迟到的旧状态只进入历史。
+type TelemetryWriter struct {
+	repo db.Repository
+	opts TelemetryWriterOptions
+
+	mu       sync.Mutex
+	entries  []*models.VehicleTelemetry
+	statuses map[string]*models.VehicleStatus
+	latest   map[string]int64 // 每辆车已接收的最新时间戳，用于识别迟到的状态
+
+	flushMu sync.Mutex // 保证同一时刻只有一次写入
+	full    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+
+	written       *metrics.Counter
+	failed        *metrics.Counter
+	dropped       *metrics.Counter
+	evicted       *metrics.Counter
+	duplicates    *metrics.Counter
+	late          *metrics.Counter
+	flushDuration *metrics.Histogram
+}
+
+func NewTelemetryWriter(repo db.Repository, opts TelemetryWriterOptions) *TelemetryWriter {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultTelemetryBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultTelemetryFlushInterval
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = defaultTelemetryMaxPending
+	}
+
+	w := &TelemetryWriter{
+		repo:          repo,
+		opts:          opts,
+		statuses:      make(map[string]*models.VehicleStatus),
+		latest:        make(map[string]int64),
+		full:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		written:       metrics.Default.Counter("telemetry_writer.written"),
+		failed:        metrics.Default.Counter("telemetry_writer.failed"),
+		dropped:       metrics.Default.Counter("telemetry_writer.dropped"),
+		evicted:       metrics.Default.Counter("telemetry_writer.evicted"),
+		duplicates:    metrics.Default.Counter("telemetry_writer.duplicates"),
+		late:          metrics.Default.Counter("telemetry_writer.late"),
+		flushDuration: metrics.Default.Histogram("telemetry_writer.flush_duration", metrics.DefaultLatencyBounds),
+	}
+	metrics.Default.GaugeFunc("telemetry_writer.pending", func() interface{} { return w.Pending() })
+	return w
+}
+
+// Start 启动后台写入，直到 Close 被调用
+func (w *TelemetryWriter) Start() {
+	go w.run()
+	log.Printf("INFO: Telemetry writer started (batch size %d, flush interval %s)", w.opts.BatchSize, w.opts.FlushInterval)
+}
+
+// Add 缓冲一条车辆状态，返回它是否比该车辆此前的状态都新 (为 false 时是迟到或重复的状态，
+// 不应再作为当前状态广播)。缓冲已满时丢弃并计数。
+func (w *TelemetryWriter) Add(vehicleID string, status *models.VehicleStatus) bool {
+	w.mu.Lock()
+	latest, seen := w.latest[vehicleID]
+	current := !seen || status.Timestamp > latest
+	if current {
+		w.latest[vehicleID] = status.Timestamp
+	} else if status.Timestamp < latest {
+		w.late.Inc()
+	}
+
+	if len(w.entries) >= w.opts.MaxPending {
+		w.mu.Unlock()
+		w.dropped.Inc()
+		return current
+	}
+	w.entries = append(w.entries, &models.VehicleTelemetry{
+		VehicleID: vehicleID,
+		Timestamp: time.Unix(status.Timestamp, 0),
+		Latitude:  status.Position.Lat,
+		Longitude: status.Position.Lng,
+		Battery:   status.Battery,
+		State:     status.State,
+	})
+	// 当前状态只保留时间戳最新的一条，数据库中的状态同样不会被更旧的覆盖
+	if prev, ok := w.statuses[vehicleID]; !ok || status.Timestamp > prev.Timestamp {
+		w.statuses[vehicleID] = status
+	}
+	reached := len(w.entries) >= w.opts.BatchSize
+	w.mu.Unlock()
+
+	if reached {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+	return current
+}
+
+// Pending 返回尚未写入的遥测点数
+func (w *TelemetryWriter) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.entries)
+}
+
+// Close 停止后台写入，并将缓冲中剩余的数据写入数据库
+func (w *TelemetryWriter) Close() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *TelemetryWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			w.flushWithTimeout()
+			return
+		case <-ticker.C:
+		case <-w.full:
+		}
+		w.flushWithTimeout()
+	}
+}
+
+func (w *TelemetryWriter) flushWithTimeout() {
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryFlushTimeout)
+	defer cancel()
+	w.Flush(ctx)
+}
+
+// Flush 立即写入缓冲中的全部数据。
+// COPY 失败时 (通常是某辆车不存在) 退回到逐条插入，只丢弃引用了不存在车辆的遥测点；
+// 其他错误 (例如数据库不可用) 时未写入的数据重新放回缓冲，下次写入时重试。
+// 每次失败的写入只记录一行汇总日志。
+func (w *TelemetryWriter) Flush(ctx context.Context) {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	entries, statuses := w.entries, w.statuses
+	w.entries, w.statuses = nil, make(map[string]*models.VehicleStatus)
+	w.mu.Unlock()
+	if len(entries) == 0 && len(statuses) == 0 {
+		return
+	}
+
+	start := time.Now()
+	var retry []*models.VehicleTelemetry
+	var rejected int
+	var copyErr, flushErr error
+	if len(entries) > 0 {
+		var n int64
+		if n, copyErr = w.repo.CopyTelemetryEntries(ctx, entries); copyErr == nil {
+			w.written.Add(n)
+			w.duplicates.Add(int64(len(entries)) - n)
+		} else {
+			for i, entry := range entries {
+				inserted, err := w.repo.CreateTelemetryEntry(ctx, entry)
+				switch {
+				case errors.Is(err, db.ErrReferenceNotFound):
+					rejected++
+					w.failed.Inc()
+				case err != nil:
+					// 数据库不可用时不再逐条尝试剩余的遥测点
+					flushErr = err
+					retry = entries[i:]
+				case inserted:
+					w.written.Inc()
+				default:
+					w.duplicates.Inc()
+				}
+				if flushErr != nil {
+					break
+				}
+			}
+		}
+	}
+	statusErr := w.repo.UpdateVehicleStatuses(ctx, statuses)
+	if statusErr == nil {
+		statuses = nil
+	} else if flushErr == nil {
+		flushErr = statusErr
+	}
+	w.flushDuration.Observe(time.Since(start))
+
+	if copyErr == nil && flushErr == nil {
+		return
+	}
+	evicted := w.requeue(retry, statuses)
+	if flushErr == nil {
+		flushErr = copyErr
+	}
+	log.Printf(
+		"level=warn msg=\"telemetry flush failed\" entries=%d rejected=%d requeued=%d evicted=%d statuses_requeued=%d error=\"%v\"",
+		len(entries), rejected, len(retry), evicted, len(statuses), flushErr,
+	)
+}
+
+// requeue 将写入失败的遥测点放回缓冲 (排在写入期间新到的遥测点之前)，超出 MaxPending 时丢弃最旧的，
+// 返回丢弃的数量。写入失败的当前状态与新到的状态合并，保留较新的一条。
+func (w *TelemetryWriter) requeue(entries []*models.VehicleTelemetry, statuses map[string]*models.VehicleStatus) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	merged := append(append(make([]*models.VehicleTelemetry, 0, len(entries)+len(w.entries)), entries...), w.entries...)
+	evicted := max(0, len(merged)-w.opts.MaxPending)
+	w.entries = merged[evicted:]
+	w.evicted.Add(int64(evicted))
+
+	for id, status := range statuses {
+		if prev, ok := w.statuses[id]; !ok || status.Timestamp > prev.Timestamp {
+			w.statuses[id] = status
+		}
+	}
+	return evicted
+}
@@ -0,0 +1,155 @@
+package background
+
+import (
+	"context"
+	"errors"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// telemetryRepo 模拟 vehicle_telemetry 的唯一约束和 current_status 的时间戳保护，
+// unknown 中的车辆在写入时报错 (模拟外键冲突)，down 为 true 时所有写入失败 (模拟数据库不可用)
+type telemetryRepo struct {
+	db.Repository
+	mu       sync.Mutex
+	unknown  map[string]bool
+	down     bool
+	during   func() // (可选) 在 COPY 时调用，模拟写入期间新到的遥测点
+	copies   int
+	rows     []*models.VehicleTelemetry
+	statuses map[string]*models.VehicleStatus
+}
+
+// insert 写入一行，同一车辆同一时刻已存在时跳过，调用方需持有锁
+func (r *telemetryRepo) insert(entry *models.VehicleTelemetry) bool {
+	for _, row := range r.rows {
+		if row.VehicleID == entry.VehicleID && row.Timestamp.Equal(entry.Timestamp) {
+			return false
+		}
+	}
+	r.rows = append(r.rows, entry)
+	return true
+}
+
+func (r *telemetryRepo) CopyTelemetryEntries(ctx context.Context, entries []*models.VehicleTelemetry) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.copies++
+	if r.during != nil {
+		r.during()
+	}
+	if r.down {
+		return 0, errDatabaseDown
+	}
+	for _, e := range entries {
+		if r.unknown[e.VehicleID] {
+			return 0, errors.New("foreign key violation")
+		}
+	}
+	var n int64
+	for _, e := range entries {
+		if r.insert(e) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *telemetryRepo) CreateTelemetryEntry(ctx context.Context, entry *models.VehicleTelemetry) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.down {
+		return false, errDatabaseDown
+	}
+	if r.unknown[entry.VehicleID] {
+		return false, db.ErrReferenceNotFound
+	}
+	return r.insert(entry), nil
+}
+
+func (r *telemetryRepo) UpdateVehicleStatuses(ctx context.Context, statuses map[string]*models.VehicleStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.down {
+		return errDatabaseDown
+	}
+	for id, s := range statuses {
+		if prev, ok := r.statuses[id]; !ok || prev.Timestamp < s.Timestamp {
+			r.statuses[id] = s
+		}
+	}
+	return nil
+}
+
+var errDatabaseDown = errors.New("connection refused")
+
+func TestTelemetryWriter(t *testing.T) {
+	repo := &telemetryRepo{unknown: map[string]bool{"ghost": true}, statuses: map[string]*models.VehicleStatus{}}
+	w := NewTelemetryWriter(repo, TelemetryWriterOptions{BatchSize: 1000, FlushInterval: time.Hour})
+
+	assert.True(t, w.Add("v1", &models.VehicleStatus{Timestamp: 100, State: "IDLE"}))
+	assert.True(t, w.Add("v1", &models.VehicleStatus{Timestamp: 102, State: "OPERATING"}))
+	assert.False(t, w.Add("v1", &models.VehicleStatus{Timestamp: 101, State: "NAVIGATING"}), "late status is not current")
+	assert.True(t, w.Add("v2", &models.VehicleStatus{Timestamp: 100, State: "IDLE"}))
+	w.Flush(context.Background())
+
+	// 迟到的状态仍进入历史，但不覆盖当前状态
+	assert.Len(t, repo.rows, 4)
+	assert.Equal(t, "OPERATING", repo.statuses["v1"].State)
+	assert.Equal(t, "IDLE", repo.statuses["v2"].State)
+	assert.Zero(t, w.Pending())
+	assert.EqualValues(t, 1, w.late.Value())
+
+	// 重连补发的旧状态既不重复写入历史，也不使当前状态倒退
+	assert.False(t, w.Add("v1", &models.VehicleStatus{Timestamp: 100, State: "IDLE"}))
+	w.Flush(context.Background())
+	assert.Len(t, repo.rows, 4)
+	assert.EqualValues(t, 1, w.duplicates.Value())
+	assert.Equal(t, "OPERATING", repo.statuses["v1"].State)
+
+	// 一辆未知车辆使整批 COPY 失败，退回逐条写入后其他车辆的数据不受影响
+	w.Add("ghost", &models.VehicleStatus{Timestamp: 200})
+	w.Add("v2", &models.VehicleStatus{Timestamp: 200, State: "NAVIGATING"})
+	w.Start()
+	w.Close() // 停止时写入剩余数据
+
+	assert.Equal(t, 3, repo.copies)
+	require.Len(t, repo.rows, 5)
+	assert.Equal(t, "v2", repo.rows[4].VehicleID)
+	assert.Equal(t, "NAVIGATING", repo.statuses["v2"].State)
+}
+
+func TestTelemetryWriterRequeuesWhenDatabaseDown(t *testing.T) {
+	repo := &telemetryRepo{down: true, statuses: map[string]*models.VehicleStatus{}}
+	w := NewTelemetryWriter(repo, TelemetryWriterOptions{BatchSize: 1000, FlushInterval: time.Hour, MaxPending: 3})
+	failed, evicted := w.failed.Value(), w.evicted.Value()
+
+	w.Add("v1", &models.VehicleStatus{Timestamp: 100})
+	w.Add("v1", &models.VehicleStatus{Timestamp: 101})
+	w.Flush(context.Background())
+	assert.Equal(t, 2, w.Pending(), "failed entries are requeued")
+	assert.Equal(t, failed, w.failed.Value())
+
+	// 写入期间新到的遥测点排在重新排队的之后，超出上限时丢弃最旧的
+	repo.during = func() {
+		w.Add("v1", &models.VehicleStatus{Timestamp: 102})
+		w.Add("v1", &models.VehicleStatus{Timestamp: 103})
+	}
+	w.Flush(context.Background())
+	assert.Equal(t, 3, w.Pending())
+	assert.Equal(t, evicted+1, w.evicted.Value())
+
+	// 数据库恢复后写入缓冲中的数据和最新的当前状态
+	repo.down, repo.during = false, nil
+	w.Flush(context.Background())
+	assert.Zero(t, w.Pending())
+	require.Len(t, repo.rows, 3)
+	assert.Equal(t, int64(101), repo.rows[0].Timestamp.Unix())
+	assert.Equal(t, int64(103), repo.statuses["v1"].Timestamp)
+}
@@ -2,37 +2,270 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"runtime"
+	"strconv"
+	"time"
 )
 
 // Config 保存了应用的所有配置
 // 字段标签 `env` 用于指定对应的环境变量名
 type Config struct {
-	PGDsn          string
-	EMQXHost       string
-	MinIOEndpoint  string
-	MinIOAccessKey string
-	MinIOSecretKey string
-	LLMApiKey      string
-	LLMBaseURL     string
-	ONNXModelPath  string
-	JWTSecret      string
+	PGDsn                   string
+	EMQXHost                string
+	MinIOEndpoint           string
+	MinIOAccessKey          string
+	MinIOSecretKey          string
+	LLMApiKey               string
+	LLMBaseURL              string
+	ONNXModelPath           string
+	ShadowModelPath         string // (可选) 影子模式下评估的候选模型
+	JWTSecret               string
 	WebsocketAllowedOrigins string
+
+	// 决策请求去重 (可选)
+	DedupEnabled     bool
+	DedupMaxDistance int
+	DedupWindow      time.Duration
+
+	// 推理池、图片解码并发与决策请求时限
+	InferenceWorkers       int
+	InferenceQueueSize     int
+	DecodeWorkers          int
+	DecisionDefaultTimeout time.Duration
+	DecisionMaxTimeout     time.Duration
+
+	// 对象存储后端："minio" (默认) 或 "local"
+	StorageBackend      string
+	LocalStorageDir     string
+	LocalStorageBaseURL string
+
+	// 决策图片 URL："presign" (默认，短期预签名链接) 或 "proxy" (经 /api/v1/images/:id 鉴权代理)
+	ImageURLMode   string
+	ImageURLExpiry time.Duration
+
+	// 决策上传校验
+	DecisionMaxImageBytes int64
+	DecisionMaxDimension  int
+
+	// 数据保留策略，保留天数为 0 表示永久保留
+	RetentionEnabled            bool
+	RetentionInterval           time.Duration
+	RetentionImageDays          int
+	RetentionKeepLabelledImages bool
+	RetentionTelemetryDays      int
+	RetentionRollupDays         int
+	RetentionRejectDays         int
+	RetentionBatchSize          int
+
+	// 持久化后台任务队列
+	TaskQueueDir         string
+	TaskQueueWorkers     int
+	TaskQueueMaxAttempts int
+
+	// 上传失败的决策图片的本地暂存目录
+	ImageSpoolDir string
+
+	// 数据库事务性发件箱：决策日志与后续工作在响应前同一事务写入，由各副本共同分发
+	OutboxEnabled      bool
+	OutboxWorkers      int
+	OutboxBatchSize    int
+	OutboxMaxAttempts  int
+	OutboxLease        time.Duration
+	OutboxPollInterval time.Duration
+
+	// MQTT 连接：认证、TLS 证书、客户端 ID (为空时由前缀和主机名生成)、持久会话和重连
+	MQTTUsername             string
+	MQTTPassword             string
+	MQTTClientID             string
+	MQTTClientIDPrefix       string
+	MQTTCACertFile           string
+	MQTTClientCertFile       string
+	MQTTClientKeyFile        string
+	MQTTCleanSession         bool
+	MQTTKeepAlive            time.Duration
+	MQTTConnectTimeout       time.Duration
+	MQTTMaxReconnectInterval time.Duration
+
+	// MQTT 状态消息处理：按车辆分片的 worker 数、每个分片的队列长度和队列满时的最长等待
+	MQTTIngestWorkers   int
+	MQTTIngestQueueSize int
+	MQTTIngestMaxWait   time.Duration
+
+	// 遥测批量写入：缓冲达到 TelemetryBatchSize 条或每隔 TelemetryFlushInterval 写入一次
+	TelemetryBatchSize     int
+	TelemetryFlushInterval time.Duration
+	TelemetryMaxPending    int
+
+	// 车辆在线状态：超过 PresenceStaleAfter 没有消息视为 stale，超过 PresenceOfflineAfter 视为 offline
+	// PresenceSweepInterval 是重新计算状态并推送变化的间隔，最后在线时间每隔 PresenceStaleAfter 写入一次数据库
+	PresenceStaleAfter    time.Duration
+	PresenceOfflineAfter  time.Duration
+	PresenceSweepInterval time.Duration
 }
 
 // LoadConfig 从环境变量加载配置
 func LoadConfig() (*Config, error) {
 	cfg := &Config{
-		PGDsn:          os.Getenv("PG_DSN"),
-		EMQXHost:       os.Getenv("EMQX_HOST"),
-		MinIOEndpoint:  os.Getenv("MINIO_ENDPOINT"),
-		MinIOAccessKey: os.Getenv("MINIO_ACCESS_KEY"),
-		MinIOSecretKey: os.Getenv("MINIO_SECRET_KEY"),
-		LLMApiKey:      os.Getenv("LLM_API_KEY"),
-		LLMBaseURL:     os.Getenv("LLM_BASE_URL"),
-		ONNXModelPath:  os.Getenv("ONNX_MODEL_PATH"),
-		JWTSecret:      os.Getenv("JWT_SECRET"),
+		PGDsn:                   os.Getenv("PG_DSN"),
+		EMQXHost:                os.Getenv("EMQX_HOST"),
+		MinIOEndpoint:           os.Getenv("MINIO_ENDPOINT"),
+		MinIOAccessKey:          os.Getenv("MINIO_ACCESS_KEY"),
+		MinIOSecretKey:          os.Getenv("MINIO_SECRET_KEY"),
+		LLMApiKey:               os.Getenv("LLM_API_KEY"),
+		LLMBaseURL:              os.Getenv("LLM_BASE_URL"),
+		ONNXModelPath:           os.Getenv("ONNX_MODEL_PATH"),
+		ShadowModelPath:         os.Getenv("SHADOW_MODEL_PATH"),
+		JWTSecret:               os.Getenv("JWT_SECRET"),
 		WebsocketAllowedOrigins: os.Getenv("WEBSOCKET_ALLOWED_ORIGINS"),
+		StorageBackend:          getEnv("STORAGE_BACKEND", "minio"),
+		LocalStorageDir:         getEnv("LOCAL_STORAGE_DIR", "data/objects"),
+		LocalStorageBaseURL:     getEnv("LOCAL_STORAGE_BASE_URL", "http://localhost:8888/objects"),
+		ImageURLMode:            getEnv("IMAGE_URL_MODE", "presign"),
+		TaskQueueDir:            getEnv("TASK_QUEUE_DIR", "data/queue"),
+		ImageSpoolDir:           getEnv("IMAGE_SPOOL_DIR", "data/spool"),
+		MQTTUsername:            os.Getenv("MQTT_USERNAME"),
+		MQTTPassword:            os.Getenv("MQTT_PASSWORD"),
+		MQTTClientID:            os.Getenv("MQTT_CLIENT_ID"),
+		MQTTClientIDPrefix:      getEnv("MQTT_CLIENT_ID_PREFIX", "patrol-cloud-server"),
+		MQTTCACertFile:          os.Getenv("MQTT_CA_CERT_FILE"),
+		MQTTClientCertFile:      os.Getenv("MQTT_CLIENT_CERT_FILE"),
+		MQTTClientKeyFile:       os.Getenv("MQTT_CLIENT_KEY_FILE"),
+	}
+
+	var err error
+	if cfg.DedupEnabled, err = getEnvBool("DEDUP_ENABLED", false); err != nil {
+		return nil, err
+	}
+	if cfg.DedupMaxDistance, err = getEnvInt("DEDUP_MAX_DISTANCE", 6); err != nil {
+		return nil, err
+	}
+	if cfg.DedupWindow, err = getEnvDuration("DEDUP_WINDOW", 30*time.Second); err != nil {
+		return nil, err
+	}
+
+	if cfg.ImageURLExpiry, err = getEnvDuration("IMAGE_URL_EXPIRY", 15*time.Minute); err != nil {
+		return nil, err
+	}
+
+	if cfg.RetentionEnabled, err = getEnvBool("RETENTION_ENABLED", false); err != nil {
+		return nil, err
+	}
+	if cfg.RetentionInterval, err = getEnvDuration("RETENTION_INTERVAL", time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.RetentionImageDays, err = getEnvInt("RETENTION_IMAGE_DAYS", 90); err != nil {
+		return nil, err
+	}
+	if cfg.RetentionKeepLabelledImages, err = getEnvBool("RETENTION_KEEP_LABELLED_IMAGES", true); err != nil {
+		return nil, err
+	}
+	if cfg.RetentionTelemetryDays, err = getEnvInt("RETENTION_TELEMETRY_DAYS", 30); err != nil {
+		return nil, err
+	}
+	if cfg.RetentionRollupDays, err = getEnvInt("RETENTION_ROLLUP_DAYS", 730); err != nil {
+		return nil, err
+	}
+	if cfg.RetentionRejectDays, err = getEnvInt("RETENTION_REJECT_DAYS", 30); err != nil {
+		return nil, err
+	}
+	if cfg.RetentionBatchSize, err = getEnvInt("RETENTION_BATCH_SIZE", 500); err != nil {
+		return nil, err
+	}
+
+	if cfg.TaskQueueWorkers, err = getEnvInt("TASK_QUEUE_WORKERS", 2); err != nil {
+		return nil, err
+	}
+	if cfg.TaskQueueMaxAttempts, err = getEnvInt("TASK_QUEUE_MAX_ATTEMPTS", 10); err != nil {
+		return nil, err
+	}
+
+	if cfg.OutboxEnabled, err = getEnvBool("OUTBOX_ENABLED", true); err != nil {
+		return nil, err
+	}
+	if cfg.OutboxWorkers, err = getEnvInt("OUTBOX_WORKERS", 2); err != nil {
+		return nil, err
+	}
+	if cfg.OutboxBatchSize, err = getEnvInt("OUTBOX_BATCH_SIZE", 10); err != nil {
+		return nil, err
+	}
+	if cfg.OutboxMaxAttempts, err = getEnvInt("OUTBOX_MAX_ATTEMPTS", 10); err != nil {
+		return nil, err
+	}
+	if cfg.OutboxLease, err = getEnvDuration("OUTBOX_LEASE", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.OutboxPollInterval, err = getEnvDuration("OUTBOX_POLL_INTERVAL", time.Second); err != nil {
+		return nil, err
+	}
+
+	if cfg.MQTTCleanSession, err = getEnvBool("MQTT_CLEAN_SESSION", false); err != nil {
+		return nil, err
+	}
+	if cfg.MQTTKeepAlive, err = getEnvDuration("MQTT_KEEP_ALIVE", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.MQTTConnectTimeout, err = getEnvDuration("MQTT_CONNECT_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.MQTTMaxReconnectInterval, err = getEnvDuration("MQTT_MAX_RECONNECT_INTERVAL", time.Minute); err != nil {
+		return nil, err
+	}
+
+	if cfg.MQTTIngestWorkers, err = getEnvInt("MQTT_INGEST_WORKERS", 8); err != nil {
+		return nil, err
+	}
+	if cfg.MQTTIngestQueueSize, err = getEnvInt("MQTT_INGEST_QUEUE_SIZE", 256); err != nil {
+		return nil, err
+	}
+	if cfg.MQTTIngestMaxWait, err = getEnvDuration("MQTT_INGEST_MAX_WAIT", 100*time.Millisecond); err != nil {
+		return nil, err
+	}
+
+	if cfg.TelemetryBatchSize, err = getEnvInt("TELEMETRY_BATCH_SIZE", 500); err != nil {
+		return nil, err
+	}
+	if cfg.TelemetryFlushInterval, err = getEnvDuration("TELEMETRY_FLUSH_INTERVAL", time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.TelemetryMaxPending, err = getEnvInt("TELEMETRY_MAX_PENDING", 20000); err != nil {
+		return nil, err
+	}
+
+	if cfg.PresenceStaleAfter, err = getEnvDuration("PRESENCE_STALE_AFTER", 15*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.PresenceOfflineAfter, err = getEnvDuration("PRESENCE_OFFLINE_AFTER", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.PresenceSweepInterval, err = getEnvDuration("PRESENCE_SWEEP_INTERVAL", time.Second); err != nil {
+		return nil, err
+	}
+
+	if cfg.InferenceWorkers, err = getEnvInt("INFERENCE_WORKERS", runtime.NumCPU()); err != nil {
+		return nil, err
+	}
+	if cfg.InferenceQueueSize, err = getEnvInt("INFERENCE_QUEUE_SIZE", 64); err != nil {
+		return nil, err
+	}
+	if cfg.DecodeWorkers, err = getEnvInt("DECODE_WORKERS", runtime.NumCPU()); err != nil {
+		return nil, err
+	}
+	if cfg.DecisionDefaultTimeout, err = getEnvDuration("DECISION_DEFAULT_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.DecisionMaxTimeout, err = getEnvDuration("DECISION_MAX_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+
+	maxImageBytes, err := getEnvInt("DECISION_MAX_IMAGE_BYTES", 10<<20)
+	if err != nil {
+		return nil, err
+	}
+	cfg.DecisionMaxImageBytes = int64(maxImageBytes)
+	if cfg.DecisionMaxDimension, err = getEnvInt("DECISION_MAX_DIMENSION", 8192); err != nil {
+		return nil, err
 	}
 
 	// 验证必须的配置项
@@ -42,14 +275,36 @@ func LoadConfig() (*Config, error) {
 	if cfg.EMQXHost == "" {
 		return nil, errors.New("missing required environment variable: EMQX_HOST")
 	}
-	if cfg.MinIOEndpoint == "" {
-		return nil, errors.New("missing required environment variable: MINIO_ENDPOINT")
+	if (cfg.MQTTClientCertFile == "") != (cfg.MQTTClientKeyFile == "") {
+		return nil, errors.New("MQTT_CLIENT_CERT_FILE and MQTT_CLIENT_KEY_FILE must be set together")
+	}
+	switch cfg.StorageBackend {
+	case "minio":
+		if cfg.MinIOEndpoint == "" {
+			return nil, errors.New("missing required environment variable: MINIO_ENDPOINT")
+		}
+		if cfg.MinIOAccessKey == "" {
+			return nil, errors.New("missing required environment variable: MINIO_ACCESS_KEY")
+		}
+		if cfg.MinIOSecretKey == "" {
+			return nil, errors.New("missing required environment variable: MINIO_SECRET_KEY")
+		}
+	case "local":
+		// 本地目录后端无需额外的必填项
+	default:
+		return nil, fmt.Errorf("invalid environment variable STORAGE_BACKEND: %q (use minio or local)", cfg.StorageBackend)
+	}
+	if cfg.ImageURLMode != "presign" && cfg.ImageURLMode != "proxy" {
+		return nil, fmt.Errorf("invalid environment variable IMAGE_URL_MODE: %q (use presign or proxy)", cfg.ImageURLMode)
+	}
+	if cfg.RetentionInterval <= 0 {
+		return nil, fmt.Errorf("invalid environment variable RETENTION_INTERVAL: %s (must be positive)", cfg.RetentionInterval)
 	}
-	if cfg.MinIOAccessKey == "" {
-		return nil, errors.New("missing required environment variable: MINIO_ACCESS_KEY")
+	if cfg.PresenceStaleAfter <= 0 || cfg.PresenceOfflineAfter <= cfg.PresenceStaleAfter {
+		return nil, fmt.Errorf("invalid presence thresholds: PRESENCE_OFFLINE_AFTER (%s) must be greater than PRESENCE_STALE_AFTER (%s)", cfg.PresenceOfflineAfter, cfg.PresenceStaleAfter)
 	}
-	if cfg.MinIOSecretKey == "" {
-		return nil, errors.New("missing required environment variable: MINIO_SECRET_KEY")
+	if cfg.PresenceSweepInterval <= 0 {
+		return nil, fmt.Errorf("invalid environment variable PRESENCE_SWEEP_INTERVAL: %s (must be positive)", cfg.PresenceSweepInterval)
 	}
 	if cfg.JWTSecret == "" {
 		return nil, errors.New("missing required environment variable: JWT_SECRET")
@@ -67,3 +322,50 @@ func LoadConfig() (*Config, error) {
 
 	return cfg, nil
 }
+
+// getEnv 读取字符串类型的环境变量，未设置时返回默认值
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvInt 读取整数类型的环境变量，未设置时返回默认值
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid environment variable %s: must be an integer", key)
+	}
+	return n, nil
+}
+
+// getEnvBool 读取布尔类型的环境变量，未设置时返回默认值
+func getEnvBool(key string, defaultValue bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid environment variable %s: must be a boolean", key)
+	}
+	return b, nil
+}
+
+// getEnvDuration 读取时长类型的环境变量 (如 "30s", "5m")，未设置时返回默认值
+func getEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid environment variable %s: must be a duration such as 30s", key)
+	}
+	return d, nil
+}
@@ -3,34 +3,139 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"patrol-cloud/internal/models"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrConflict 表示写入违反了唯一性约束 (例如 ID 或映射已存在)
+var ErrConflict = errors.New("conflicting record already exists")
+
+// uniqueViolation 是 PostgreSQL 唯一约束冲突的错误码
+const uniqueViolation = "23505"
+
+// translateConflict 将唯一约束冲突转换为 ErrConflict
+func translateConflict(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return fmt.Errorf("%w: %s", ErrConflict, pgErr.Detail)
+	}
+	return err
+}
+
+// ErrReferenceNotFound 表示写入引用了不存在的记录 (例如不存在的用户或车辆)
+var ErrReferenceNotFound = errors.New("referenced record does not exist")
+
+// foreignKeyViolation 是 PostgreSQL 外键约束冲突的错误码
+const foreignKeyViolation = "23503"
+
+// translateForeignKey 将外键约束冲突转换为 ErrReferenceNotFound
+func translateForeignKey(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+		return fmt.Errorf("%w: %s", ErrReferenceNotFound, pgErr.Detail)
+	}
+	return err
+}
+
 // Repository 定义了数据库操作接口
 type Repository interface {
 	// User methods
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 	CreateUser(ctx context.Context, user *models.User) error
 
+	// Vehicle access methods
+	UserCanAccessVehicle(ctx context.Context, userID, vehicleID string) (bool, error)
+	ListAccessibleVehicleIDs(ctx context.Context, userID string) (vehicleIDs []string, all bool, err error)
+	GrantVehicleAccess(ctx context.Context, userID, vehicleID string) error
+	RevokeVehicleAccess(ctx context.Context, userID, vehicleID string) (bool, error)
+
 	// Decision Log methods
-	LogDecision(ctx context.Context, result *models.DecisionResult, imageURL string, metadata models.DecisionRequestMetadata) error
+	LogDecision(ctx context.Context, entry *models.DecisionLogEntry) error
+	ListRecentHashedDecisions(ctx context.Context, vehicleID string, since time.Time) ([]*models.RecentDecision, error)
+	LogDecisionWithOutbox(ctx context.Context, entry *models.DecisionLogEntry, messages ...*models.OutboxMessage) error
+	UpdateDecisionImageKeys(ctx context.Context, decisionID, imageKey, thumbnailKey, previewKey string) (bool, error)
+	UpdateDecisionLocation(ctx context.Context, decisionID string, location *models.DecisionLocation) (bool, error)
 	ListDecisionLogsByVehicleID(ctx context.Context, vehicleID string, page, pageSize int) ([]*models.DecisionLog, int, error)
 	ListAllDecisionLogs(ctx context.Context) ([]*models.DecisionLog, error)
+	GetDecisionLogByID(ctx context.Context, id string) (*models.DecisionLog, error)
+	ListDecisionPoints(ctx context.Context, startTime, endTime time.Time, action string) ([]*models.DecisionPoint, error)
+
+	// Decision label methods
+	UpsertDecisionLabel(ctx context.Context, label *models.DecisionLabel) error
+	GetDecisionLabel(ctx context.Context, decisionID string) (*models.DecisionLabel, error)
+	DeleteDecisionLabel(ctx context.Context, decisionID string) (bool, error)
+	ListLabelledDecisions(ctx context.Context, startTime, endTime time.Time) ([]*models.LabelledDecision, error)
 
 	// Vehicle methods
 	CreateVehicle(ctx context.Context, vehicle *models.Vehicle) error
 	GetVehicleByID(ctx context.Context, id string) (*models.Vehicle, error)
 	ListVehicles(ctx context.Context) ([]*models.Vehicle, error)
 	UpdateVehicleStatus(ctx context.Context, vehicleID string, status *models.VehicleStatus) error
+	UpdateVehicleStatuses(ctx context.Context, statuses map[string]*models.VehicleStatus) error
+	ListVehicleLastSeen(ctx context.Context) (map[string]time.Time, error)
+	UpdateVehicleLastSeen(ctx context.Context, lastSeen map[string]time.Time) error
 
 	// Telemetry methods
-	CreateTelemetryEntry(ctx context.Context, telemetry *models.VehicleTelemetry) error
+	CreateTelemetryEntry(ctx context.Context, telemetry *models.VehicleTelemetry) (bool, error)
+	CopyTelemetryEntries(ctx context.Context, entries []*models.VehicleTelemetry) (int64, error)
 	GetTelemetryByVehicleID(ctx context.Context, vehicleID string, startTime, endTime time.Time) ([]*models.VehicleTelemetry, error)
+	GetTelemetryAround(ctx context.Context, vehicleID string, t time.Time) (before, after *models.VehicleTelemetry, err error)
+	ListTelemetryRollups(ctx context.Context, vehicleID string, startTime, endTime time.Time) ([]*models.TelemetryRollup, error)
+	CreateTelemetryReject(ctx context.Context, reject *models.TelemetryReject) error
+	ListTelemetryRejects(ctx context.Context, vehicleID, reason string, startTime, endTime time.Time, limit int) ([]*models.TelemetryReject, error)
+	CountTelemetryRejects(ctx context.Context, startTime, endTime time.Time) ([]*models.TelemetryRejectCount, error)
+
+	// Retention methods
+	ListExpiredDecisionImages(ctx context.Context, before time.Time, keepLabelled bool, limit int) ([]*models.DecisionImageKeys, error)
+	CountExpiredDecisionImages(ctx context.Context, before time.Time, keepLabelled bool) (expired, keptLabelled int64, err error)
+	ClearDecisionImageKeys(ctx context.Context, decisionIDs []string) error
+	RollupAndDeleteTelemetry(ctx context.Context, before time.Time, limit int) (int64, error)
+	CountTelemetryBefore(ctx context.Context, before time.Time) (int64, error)
+	DeleteTelemetryRollupsBefore(ctx context.Context, before time.Time, limit int) (int64, error)
+	CountTelemetryRollupsBefore(ctx context.Context, before time.Time) (int64, error)
+	DeleteTelemetryRejectsBefore(ctx context.Context, before time.Time, limit int) (int64, error)
+	CountTelemetryRejectsBefore(ctx context.Context, before time.Time) (int64, error)
+
+	// Command log methods
+	CreateCommandLog(ctx context.Context, cmd *models.CommandLog) error
+	ListCommandLogs(ctx context.Context, vehicleID string, startTime, endTime time.Time) ([]*models.CommandLog, error)
+
+	// Dataset export methods
+	CreateDatasetExport(ctx context.Context, export *models.DatasetExport) error
+	UpdateDatasetExport(ctx context.Context, export *models.DatasetExport) error
+	GetDatasetExport(ctx context.Context, id string) (*models.DatasetExport, error)
+	FailUnfinishedDatasetExports(ctx context.Context, reason string) (int64, error)
+	ListDatasetRecords(ctx context.Context, filter models.DatasetExportFilter) ([]*models.DatasetRecord, error)
+
+	// Trash taxonomy methods
+	ListTrashCategories(ctx context.Context) ([]*models.TrashCategory, error)
+	GetTrashCategory(ctx context.Context, id string) (*models.TrashCategory, error)
+	CreateTrashCategory(ctx context.Context, category *models.TrashCategory) error
+	UpdateTrashCategory(ctx context.Context, category *models.TrashCategory) (bool, error)
+	DeleteTrashCategory(ctx context.Context, id string) (bool, error)
+	ListCollectionRecords(ctx context.Context, startTime, endTime time.Time) ([]*models.CollectionRecord, error)
+
+	// Shadow evaluation methods
+	CreateShadowEvaluation(ctx context.Context, eval *models.ShadowEvaluation) error
+	ListShadowEvaluations(ctx context.Context, startTime, endTime time.Time) ([]*models.ShadowEvaluation, error)
+
+	// Outbox methods
+	ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxMessage, error)
+	DeleteOutboxMessage(ctx context.Context, id int64) error
+	UpdateOutboxMessage(ctx context.Context, msg *models.OutboxMessage) error
+}
+
+// execer 是 *pgxpool.Pool 和 pgx.Tx 共有的执行接口，使同一条写入既可单独执行也可放入事务
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
 }
 
 // postgresRepository 是 Repository 的 PG 实现
@@ -51,8 +156,11 @@ func NewRepository(dsn string) (Repository, error) {
 // --- User Methods ---
 
 func (r *postgresRepository) CreateUser(ctx context.Context, user *models.User) error {
-	query := `INSERT INTO users (id, username, hashed_password) VALUES ($1, $2, $3)`
-	_, err := r.pool.Exec(ctx, query, user.ID, user.Username, user.HashedPassword)
+	if user.Role == "" {
+		user.Role = models.RoleOperator
+	}
+	query := `INSERT INTO users (id, username, hashed_password, role) VALUES ($1, $2, $3, $4)`
+	_, err := r.pool.Exec(ctx, query, user.ID, user.Username, user.HashedPassword, user.Role)
 	if err != nil {
 		log.Printf("ERROR: Failed to create user: %v", err)
 	}
@@ -60,11 +168,11 @@ func (r *postgresRepository) CreateUser(ctx context.Context, user *models.User)
 }
 
 func (r *postgresRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
-	query := `SELECT id, username, hashed_password FROM users WHERE username = $1`
+	query := `SELECT id, username, hashed_password, role FROM users WHERE username = $1`
 	row := r.pool.QueryRow(ctx, query, username)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.Username, &user.HashedPassword)
+	err := row.Scan(&user.ID, &user.Username, &user.HashedPassword, &user.Role)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil // 用户不存在，不视为错误
@@ -76,28 +184,152 @@ func (r *postgresRepository) GetUserByUsername(ctx context.Context, username str
 	return &user, nil
 }
 
+// --- Vehicle Access Methods ---
+
+// UserCanAccessVehicle 判断用户是否可访问车辆：管理员可访问所有车辆，其他用户需要显式授权
+func (r *postgresRepository) UserCanAccessVehicle(ctx context.Context, userID, vehicleID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM users u
+			WHERE u.id = $1 AND (
+				u.role = 'admin'
+				OR EXISTS (SELECT 1 FROM user_vehicle_access a WHERE a.user_id = u.id AND a.vehicle_id = $2)
+			)
+		)
+	`
+	var ok bool
+	err := r.pool.QueryRow(ctx, query, userID, vehicleID).Scan(&ok)
+	return ok, err
+}
+
+// ListAccessibleVehicleIDs 返回用户被授权的车辆，管理员返回 all = true
+func (r *postgresRepository) ListAccessibleVehicleIDs(ctx context.Context, userID string) ([]string, bool, error) {
+	var role string
+	if err := r.pool.QueryRow(ctx, `SELECT role FROM users WHERE id = $1`, userID).Scan(&role); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	if role == models.RoleAdmin {
+		return nil, true, nil
+	}
+
+	rows, err := r.pool.Query(ctx, `SELECT vehicle_id FROM user_vehicle_access WHERE user_id = $1 ORDER BY vehicle_id`, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var vehicleIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, false, err
+		}
+		vehicleIDs = append(vehicleIDs, id)
+	}
+	return vehicleIDs, false, rows.Err()
+}
+
+// GrantVehicleAccess 授权用户访问车辆 (重复授权不报错)，用户或车辆不存在时返回 ErrReferenceNotFound
+func (r *postgresRepository) GrantVehicleAccess(ctx context.Context, userID, vehicleID string) error {
+	query := `
+		INSERT INTO user_vehicle_access (user_id, vehicle_id) VALUES ($1, $2)
+		ON CONFLICT (user_id, vehicle_id) DO NOTHING
+	`
+	_, err := r.pool.Exec(ctx, query, userID, vehicleID)
+	return translateForeignKey(err)
+}
+
+// RevokeVehicleAccess 撤销授权，返回授权此前是否存在
+func (r *postgresRepository) RevokeVehicleAccess(ctx context.Context, userID, vehicleID string) (bool, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM user_vehicle_access WHERE user_id = $1 AND vehicle_id = $2`, userID, vehicleID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
 // --- Decision Log Methods ---
 
-func (r *postgresRepository) LogDecision(ctx context.Context, result *models.DecisionResult, imageURL string, metadata models.DecisionRequestMetadata) error {
-	metadataBytes, _ := json.Marshal(metadata)
-	decisionBytes, _ := json.Marshal(result)
+// UpdateDecisionImageKeys 在图片补传成功后写回对象名，返回决策是否存在
+func (r *postgresRepository) UpdateDecisionImageKeys(ctx context.Context, decisionID, imageKey, thumbnailKey, previewKey string) (bool, error) {
+	query := `UPDATE decision_logs SET image_key = $2, thumbnail_key = $3, preview_key = $4 WHERE id = $1`
+	tag, err := r.pool.Exec(ctx, query, decisionID, imageKey, thumbnailKey, previewKey)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// LogDecision 写入一条决策日志，决策 ID 已存在时返回 ErrConflict
+func (r *postgresRepository) LogDecision(ctx context.Context, entry *models.DecisionLogEntry) error {
+	err := insertDecisionLog(ctx, r.pool, entry)
+	if err != nil {
+		log.Printf("ERROR: Failed to execute LogDecision query: %v", err)
+	}
+	// 决策 ID 已存在时返回 ErrConflict，重放失败任务时据此判断该决策已写入
+	return translateConflict(err)
+}
+
+// LogDecisionWithOutbox 在同一事务中写入决策日志及其后续工作的发件箱消息，
+// 两者要么都写入、要么都不写入。决策 ID 已存在时返回 ErrConflict。
+func (r *postgresRepository) LogDecisionWithOutbox(ctx context.Context, entry *models.DecisionLogEntry, messages ...*models.OutboxMessage) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertDecisionLog(ctx, tx, entry); err != nil {
+		return translateConflict(err)
+	}
+	if err := insertOutboxMessages(ctx, tx, messages); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func insertDecisionLog(ctx context.Context, db execer, entry *models.DecisionLogEntry) error {
+	metadataBytes, _ := json.Marshal(entry.Metadata)
+	decisionBytes, _ := json.Marshal(entry.Result)
+
+	var lat, lng *float64
+	var locationSource *string
+	if entry.Location != nil {
+		lat, lng, locationSource = &entry.Location.Lat, &entry.Location.Lng, &entry.Location.Source
+	}
 
 	query := `
-		INSERT INTO decision_logs (id, vehicle_id, image_url, server_decision, request_metadata)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO decision_logs
+			(id, vehicle_id, image_key, thumbnail_key, preview_key, server_decision, request_metadata, image_hash, latitude, longitude, location_source)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
-	_, err := r.pool.Exec(ctx, query,
-		result.ImageID,
-		metadata.VehicleID,
-		imageURL,
+	_, err := db.Exec(ctx, query,
+		entry.Result.ImageID,
+		entry.Metadata.VehicleID,
+		entry.ImageKey,
+		entry.ThumbnailKey,
+		entry.PreviewKey,
 		decisionBytes,
 		metadataBytes,
+		entry.ImageHash,
+		lat,
+		lng,
+		locationSource,
 	)
+	return err
+}
 
+// UpdateDecisionLocation 写回后台定位得到的决策位置，返回决策是否存在
+func (r *postgresRepository) UpdateDecisionLocation(ctx context.Context, decisionID string, location *models.DecisionLocation) (bool, error) {
+	query := `UPDATE decision_logs SET latitude = $2, longitude = $3, location_source = $4 WHERE id = $1`
+	tag, err := r.pool.Exec(ctx, query, decisionID, location.Lat, location.Lng, location.Source)
 	if err != nil {
-		log.Printf("ERROR: Failed to execute LogDecision query: %v", err)
+		return false, err
 	}
-	return err
+	return tag.RowsAffected() > 0, nil
 }
 
 func (r *postgresRepository) ListDecisionLogsByVehicleID(ctx context.Context, vehicleID string, page, pageSize int) ([]*models.DecisionLog, int, error) {
@@ -110,7 +342,7 @@ func (r *postgresRepository) ListDecisionLogsByVehicleID(ctx context.Context, ve
 
 	// 2. Get paginated results
 	query := `
-		SELECT id, vehicle_id, timestamp, image_url, server_decision, request_metadata
+		SELECT id, vehicle_id, timestamp, image_key, thumbnail_key, preview_key, server_decision, request_metadata
 		FROM decision_logs
 		WHERE vehicle_id = $1
 		ORDER BY "timestamp" DESC
@@ -126,7 +358,7 @@ func (r *postgresRepository) ListDecisionLogsByVehicleID(ctx context.Context, ve
 	var logs []*models.DecisionLog
 	for rows.Next() {
 		var log models.DecisionLog
-		if err := rows.Scan(&log.ID, &log.VehicleID, &log.Timestamp, &log.ImageURL, &log.ServerDecision, &log.RequestMetadata); err != nil {
+		if err := rows.Scan(&log.ID, &log.VehicleID, &log.Timestamp, &log.ImageKey, &log.ThumbnailKey, &log.PreviewKey, &log.ServerDecision, &log.RequestMetadata); err != nil {
 			return nil, 0, err
 		}
 		logs = append(logs, &log)
@@ -137,7 +369,7 @@ func (r *postgresRepository) ListDecisionLogsByVehicleID(ctx context.Context, ve
 
 func (r *postgresRepository) ListAllDecisionLogs(ctx context.Context) ([]*models.DecisionLog, error) {
 	query := `
-		SELECT id, vehicle_id, timestamp, image_url, server_decision, request_metadata
+		SELECT id, vehicle_id, timestamp, image_key, thumbnail_key, preview_key, server_decision, request_metadata
 		FROM decision_logs
 		ORDER BY "timestamp" DESC
 	`
@@ -150,7 +382,7 @@ func (r *postgresRepository) ListAllDecisionLogs(ctx context.Context) ([]*models
 	var logs []*models.DecisionLog
 	for rows.Next() {
 		var log models.DecisionLog
-		if err := rows.Scan(&log.ID, &log.VehicleID, &log.Timestamp, &log.ImageURL, &log.ServerDecision, &log.RequestMetadata); err != nil {
+		if err := rows.Scan(&log.ID, &log.VehicleID, &log.Timestamp, &log.ImageKey, &log.ThumbnailKey, &log.PreviewKey, &log.ServerDecision, &log.RequestMetadata); err != nil {
 			return nil, err
 		}
 		logs = append(logs, &log)
@@ -159,6 +391,300 @@ func (r *postgresRepository) ListAllDecisionLogs(ctx context.Context) ([]*models
 	return logs, nil
 }
 
+func (r *postgresRepository) ListRecentHashedDecisions(ctx context.Context, vehicleID string, since time.Time) ([]*models.RecentDecision, error) {
+	query := `
+		SELECT id, image_hash, server_decision, "timestamp"
+		FROM decision_logs
+		WHERE vehicle_id = $1 AND "timestamp" >= $2 AND image_hash IS NOT NULL
+		ORDER BY "timestamp" DESC
+	`
+	rows, err := r.pool.Query(ctx, query, vehicleID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decisions []*models.RecentDecision
+	for rows.Next() {
+		var d models.RecentDecision
+		if err := rows.Scan(&d.ID, &d.ImageHash, &d.Decision, &d.Timestamp); err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, &d)
+	}
+	return decisions, nil
+}
+
+func (r *postgresRepository) GetDecisionLogByID(ctx context.Context, id string) (*models.DecisionLog, error) {
+	query := `
+		SELECT id, vehicle_id, timestamp, image_key, thumbnail_key, preview_key, server_decision, request_metadata
+		FROM decision_logs
+		WHERE id = $1
+	`
+	var log models.DecisionLog
+	err := r.pool.QueryRow(ctx, query, id).Scan(&log.ID, &log.VehicleID, &log.Timestamp, &log.ImageKey, &log.ThumbnailKey, &log.PreviewKey, &log.ServerDecision, &log.RequestMetadata)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &log, nil
+}
+
+// ListDecisionPoints 返回时间范围内已定位的决策，action 非空时只返回该动作的决策
+func (r *postgresRepository) ListDecisionPoints(ctx context.Context, startTime, endTime time.Time, action string) ([]*models.DecisionPoint, error) {
+	query := `
+		SELECT id, vehicle_id, "timestamp", COALESCE(server_decision->>'action', ''), COALESCE(server_decision->>'class', ''), latitude, longitude
+		FROM decision_logs
+		WHERE "timestamp" >= $1 AND "timestamp" <= $2
+			AND latitude IS NOT NULL AND longitude IS NOT NULL
+			AND ($3 = '' OR server_decision->>'action' = $3)
+		ORDER BY "timestamp" ASC
+	`
+	rows, err := r.pool.Query(ctx, query, startTime, endTime, action)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []*models.DecisionPoint
+	for rows.Next() {
+		var p models.DecisionPoint
+		if err := rows.Scan(&p.ID, &p.VehicleID, &p.Timestamp, &p.Action, &p.Class, &p.Lat, &p.Lng); err != nil {
+			return nil, err
+		}
+		points = append(points, &p)
+	}
+	return points, rows.Err()
+}
+
+// --- Decision Label Methods ---
+
+func (r *postgresRepository) UpsertDecisionLabel(ctx context.Context, label *models.DecisionLabel) error {
+	boxes := label.BoundingBoxes
+	if boxes == nil {
+		boxes = []models.BoundingBox{}
+	}
+	boxesBytes, err := json.Marshal(boxes)
+	if err != nil {
+		return err
+	}
+
+	// 重复标注时覆盖内容并记录最后一次标注人，保留首次标注时间
+	query := `
+		INSERT INTO decision_labels (decision_id, correct_action, corrected_class, bounding_boxes, notes, labelled_by)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), $6)
+		ON CONFLICT (decision_id) DO UPDATE SET
+			correct_action = EXCLUDED.correct_action,
+			corrected_class = EXCLUDED.corrected_class,
+			bounding_boxes = EXCLUDED.bounding_boxes,
+			notes = EXCLUDED.notes,
+			labelled_by = EXCLUDED.labelled_by,
+			updated_at = NOW()
+		RETURNING labelled_at, updated_at
+	`
+	err = r.pool.QueryRow(ctx, query,
+		label.DecisionID,
+		label.CorrectAction,
+		label.CorrectedClass,
+		boxesBytes,
+		label.Notes,
+		label.LabelledBy,
+	).Scan(&label.LabelledAt, &label.UpdatedAt)
+	if err != nil {
+		log.Printf("ERROR: Failed to upsert decision label: %v", err)
+	}
+	return err
+}
+
+func (r *postgresRepository) GetDecisionLabel(ctx context.Context, decisionID string) (*models.DecisionLabel, error) {
+	query := `
+		SELECT decision_id, correct_action, COALESCE(corrected_class, ''), bounding_boxes,
+			COALESCE(notes, ''), labelled_by, labelled_at, updated_at
+		FROM decision_labels
+		WHERE decision_id = $1
+	`
+	var l models.DecisionLabel
+	err := r.pool.QueryRow(ctx, query, decisionID).Scan(&l.DecisionID, &l.CorrectAction, &l.CorrectedClass,
+		&l.BoundingBoxes, &l.Notes, &l.LabelledBy, &l.LabelledAt, &l.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (r *postgresRepository) DeleteDecisionLabel(ctx context.Context, decisionID string) (bool, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM decision_labels WHERE decision_id = $1`, decisionID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *postgresRepository) ListLabelledDecisions(ctx context.Context, startTime, endTime time.Time) ([]*models.LabelledDecision, error) {
+	query := `
+		SELECT d.server_decision, l.decision_id, l.correct_action, COALESCE(l.corrected_class, ''),
+			l.bounding_boxes, COALESCE(l.notes, ''), l.labelled_by, l.labelled_at, l.updated_at
+		FROM decision_labels l
+		JOIN decision_logs d ON d.id = l.decision_id
+		WHERE d."timestamp" >= $1 AND d."timestamp" <= $2
+	`
+	rows, err := r.pool.Query(ctx, query, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var labelled []*models.LabelledDecision
+	for rows.Next() {
+		var decision models.DecisionResult
+		var l models.DecisionLabel
+		if err := rows.Scan(&decision, &l.DecisionID, &l.CorrectAction, &l.CorrectedClass,
+			&l.BoundingBoxes, &l.Notes, &l.LabelledBy, &l.LabelledAt, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		labelled = append(labelled, &models.LabelledDecision{Decision: &decision, Label: &l})
+	}
+	return labelled, nil
+}
+
+// --- Dataset Export Methods ---
+
+func (r *postgresRepository) CreateDatasetExport(ctx context.Context, export *models.DatasetExport) error {
+	filterBytes, err := json.Marshal(export.Filter)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO dataset_exports (id, status, filter, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`
+	err = r.pool.QueryRow(ctx, query, export.ID, export.Status, filterBytes, export.CreatedBy).Scan(&export.CreatedAt)
+	if err != nil {
+		log.Printf("ERROR: Failed to create dataset export: %v", err)
+	}
+	return err
+}
+
+func (r *postgresRepository) UpdateDatasetExport(ctx context.Context, export *models.DatasetExport) error {
+	query := `
+		UPDATE dataset_exports
+		SET status = $2, object_name = NULLIF($3, ''), image_count = $4, error = NULLIF($5, ''), completed_at = $6
+		WHERE id = $1
+	`
+	_, err := r.pool.Exec(ctx, query,
+		export.ID,
+		export.Status,
+		export.ObjectName,
+		export.ImageCount,
+		export.Error,
+		export.CompletedAt,
+	)
+	return err
+}
+
+// FailUnfinishedDatasetExports 将仍处于 pending 或 running 的导出任务标记为失败，返回更新的行数
+func (r *postgresRepository) FailUnfinishedDatasetExports(ctx context.Context, reason string) (int64, error) {
+	query := `
+		UPDATE dataset_exports
+		SET status = 'failed', error = $1, completed_at = NOW()
+		WHERE status IN ('pending', 'running')
+	`
+	tag, err := r.pool.Exec(ctx, query, reason)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *postgresRepository) GetDatasetExport(ctx context.Context, id string) (*models.DatasetExport, error) {
+	query := `
+		SELECT id, status, filter, COALESCE(object_name, ''), image_count, COALESCE(error, ''),
+			created_by, created_at, completed_at
+		FROM dataset_exports
+		WHERE id = $1
+	`
+	var e models.DatasetExport
+	err := r.pool.QueryRow(ctx, query, id).Scan(&e.ID, &e.Status, &e.Filter, &e.ObjectName, &e.ImageCount,
+		&e.Error, &e.CreatedBy, &e.CreatedAt, &e.CompletedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *postgresRepository) ListDatasetRecords(ctx context.Context, filter models.DatasetExportFilter) ([]*models.DatasetRecord, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	conditions = append(conditions, "d.image_key <> ''")
+	if filter.StartTime != nil {
+		addCondition(`d."timestamp" >= $%d`, *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		addCondition(`d."timestamp" <= $%d`, *filter.EndTime)
+	}
+	if filter.VehicleID != "" {
+		addCondition("d.vehicle_id = $%d", filter.VehicleID)
+	}
+	if filter.LabelledOnly {
+		conditions = append(conditions, "l.decision_id IS NOT NULL")
+	}
+	if filter.Class != "" {
+		addCondition("COALESCE(NULLIF(l.corrected_class, ''), d.server_decision->>'class') = $%d", filter.Class)
+	}
+
+	query := `
+		SELECT d.id, d.vehicle_id, d."timestamp", d.image_key, d.server_decision, d.request_metadata,
+			l.decision_id, COALESCE(l.correct_action, ''), COALESCE(l.corrected_class, ''),
+			COALESCE(l.bounding_boxes, '[]'), COALESCE(l.notes, ''), COALESCE(l.labelled_by, ''),
+			l.labelled_at, l.updated_at
+		FROM decision_logs d
+		LEFT JOIN decision_labels l ON l.decision_id = d.id
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY d."timestamp" ASC
+	`
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*models.DatasetRecord
+	for rows.Next() {
+		var d models.DecisionLog
+		var l models.DecisionLabel
+		var labelID *string
+		var labelledAt, updatedAt *time.Time
+		if err := rows.Scan(&d.ID, &d.VehicleID, &d.Timestamp, &d.ImageKey, &d.ServerDecision, &d.RequestMetadata,
+			&labelID, &l.CorrectAction, &l.CorrectedClass, &l.BoundingBoxes, &l.Notes, &l.LabelledBy,
+			&labelledAt, &updatedAt); err != nil {
+			return nil, err
+		}
+
+		record := &models.DatasetRecord{Log: &d}
+		if labelID != nil {
+			l.DecisionID = *labelID
+			l.LabelledAt, l.UpdatedAt = *labelledAt, *updatedAt
+			record.Label = &l
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
 // --- Vehicle Methods ---
 
 func (r *postgresRepository) CreateVehicle(ctx context.Context, vehicle *models.Vehicle) error {
@@ -204,24 +730,95 @@ func (r *postgresRepository) ListVehicles(ctx context.Context) ([]*models.Vehicl
 	return vehicles, nil
 }
 
+// newerStatusCondition 限定只有时间戳更新的状态才能覆盖 current_status，
+// 避免重复投递或重连补发的旧状态使车辆的当前状态倒退
+const newerStatusCondition = `(current_status IS NULL OR COALESCE((current_status->>'timestamp')::bigint, 0) < (%s::jsonb->>'timestamp')::bigint)`
+
+// UpdateVehicleStatus 更新车辆的当前状态，状态比已保存的旧时不做任何事
 func (r *postgresRepository) UpdateVehicleStatus(ctx context.Context, vehicleID string, status *models.VehicleStatus) error {
 	statusJSON, err := json.Marshal(status)
 	if err != nil {
 		return err
 	}
-	query := `UPDATE vehicles SET current_status = $1 WHERE id = $2`
-	_, err = r.pool.Exec(ctx, query, statusJSON, vehicleID)
+	query := `UPDATE vehicles SET current_status = $1::jsonb WHERE id = $2 AND ` + fmt.Sprintf(newerStatusCondition, "$1")
+	_, err = r.pool.Exec(ctx, query, string(statusJSON), vehicleID)
+	return err
+}
+
+// UpdateVehicleStatuses 用一条语句更新多辆车的当前状态，不存在的车辆和比已保存状态旧的状态被忽略
+func (r *postgresRepository) UpdateVehicleStatuses(ctx context.Context, statuses map[string]*models.VehicleStatus) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(statuses))
+	docs := make([]string, 0, len(statuses))
+	for id, status := range statuses {
+		statusJSON, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		docs = append(docs, string(statusJSON))
+	}
+	query := `
+		UPDATE vehicles AS v SET current_status = s.status::jsonb
+		FROM unnest($1::text[], $2::text[]) AS s(id, status)
+		WHERE v.id = s.id AND ` + fmt.Sprintf(newerStatusCondition, "s.status")
+	_, err := r.pool.Exec(ctx, query, ids, docs)
+	return err
+}
+
+// ListVehicleLastSeen 返回有过上报的车辆最后一次被看到的时间
+func (r *postgresRepository) ListVehicleLastSeen(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := r.pool.Query(ctx, `SELECT id, last_seen_at FROM vehicles WHERE last_seen_at IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lastSeen := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var t time.Time
+		if err := rows.Scan(&id, &t); err != nil {
+			return nil, err
+		}
+		lastSeen[id] = t
+	}
+	return lastSeen, rows.Err()
+}
+
+// UpdateVehicleLastSeen 批量更新车辆最后一次被看到的时间，只会向后推进
+func (r *postgresRepository) UpdateVehicleLastSeen(ctx context.Context, lastSeen map[string]time.Time) error {
+	if len(lastSeen) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(lastSeen))
+	times := make([]time.Time, 0, len(lastSeen))
+	for id, t := range lastSeen {
+		ids = append(ids, id)
+		times = append(times, t)
+	}
+	query := `
+		UPDATE vehicles AS v SET last_seen_at = GREATEST(v.last_seen_at, s.seen_at)
+		FROM unnest($1::text[], $2::timestamptz[]) AS s(id, seen_at)
+		WHERE v.id = s.id
+	`
+	_, err := r.pool.Exec(ctx, query, ids, times)
 	return err
 }
 
 // --- Telemetry Methods ---
 
-func (r *postgresRepository) CreateTelemetryEntry(ctx context.Context, telemetry *models.VehicleTelemetry) error {
+// CreateTelemetryEntry 写入一个遥测点，返回是否写入 (同一车辆同一时刻的遥测已存在时视为重复，不写入)。
+// 车辆不存在时返回 ErrReferenceNotFound。
+func (r *postgresRepository) CreateTelemetryEntry(ctx context.Context, telemetry *models.VehicleTelemetry) (bool, error) {
 	query := `
 		INSERT INTO vehicle_telemetry (vehicle_id, "timestamp", latitude, longitude, battery, state)
 		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (vehicle_id, "timestamp") DO NOTHING
 	`
-	_, err := r.pool.Exec(ctx, query,
+	tag, err := r.pool.Exec(ctx, query,
 		telemetry.VehicleID,
 		telemetry.Timestamp,
 		telemetry.Latitude,
@@ -229,24 +826,78 @@ func (r *postgresRepository) CreateTelemetryEntry(ctx context.Context, telemetry
 		telemetry.Battery,
 		telemetry.State,
 	)
-	return err
+	if err != nil {
+		return false, translateForeignKey(err)
+	}
+	return tag.RowsAffected() > 0, nil
 }
 
-func (r *postgresRepository) GetTelemetryByVehicleID(ctx context.Context, vehicleID string, startTime, endTime time.Time) ([]*models.VehicleTelemetry, error) {
-	query := `
-		SELECT id, vehicle_id, "timestamp", latitude, longitude, battery, state
-		FROM vehicle_telemetry
-		WHERE vehicle_id = $1 AND "timestamp" >= $2 AND "timestamp" <= $3
-		ORDER BY "timestamp" ASC
-	`
-	rows, err := r.pool.Query(ctx, query, vehicleID, startTime, endTime)
+// CopyTelemetryEntries 批量写入遥测点，返回实际写入的行数 (重复的遥测点被跳过)。
+// COPY 不支持 ON CONFLICT，因此先 COPY 到临时表再去重插入；
+// 任一行失败 (例如引用了不存在的车辆) 时整批都不会写入。
+func (r *postgresRepository) CopyTelemetryEntries(ctx context.Context, entries []*models.VehicleTelemetry) (int64, error) {
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
+	defer tx.Rollback(ctx)
 
-	var telemetryEntries []*models.VehicleTelemetry
-	for rows.Next() {
+	staging := `
+		CREATE TEMP TABLE vehicle_telemetry_staging (
+			vehicle_id VARCHAR(255),
+			"timestamp" TIMESTAMPTZ,
+			latitude DOUBLE PRECISION,
+			longitude DOUBLE PRECISION,
+			battery DOUBLE PRECISION,
+			state VARCHAR(255)
+		) ON COMMIT DROP
+	`
+	if _, err := tx.Exec(ctx, staging); err != nil {
+		return 0, err
+	}
+
+	rows := make([][]any, len(entries))
+	for i, e := range entries {
+		rows[i] = []any{e.VehicleID, e.Timestamp, e.Latitude, e.Longitude, e.Battery, e.State}
+	}
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"vehicle_telemetry_staging"},
+		[]string{"vehicle_id", "timestamp", "latitude", "longitude", "battery", "state"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	insert := `
+		INSERT INTO vehicle_telemetry (vehicle_id, "timestamp", latitude, longitude, battery, state)
+		SELECT DISTINCT ON (vehicle_id, "timestamp") vehicle_id, "timestamp", latitude, longitude, battery, state
+		FROM vehicle_telemetry_staging
+		ORDER BY vehicle_id, "timestamp"
+		ON CONFLICT (vehicle_id, "timestamp") DO NOTHING
+	`
+	tag, err := tx.Exec(ctx, insert)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), tx.Commit(ctx)
+}
+
+func (r *postgresRepository) GetTelemetryByVehicleID(ctx context.Context, vehicleID string, startTime, endTime time.Time) ([]*models.VehicleTelemetry, error) {
+	query := `
+		SELECT id, vehicle_id, "timestamp", latitude, longitude, battery, state
+		FROM vehicle_telemetry
+		WHERE vehicle_id = $1 AND "timestamp" >= $2 AND "timestamp" <= $3
+		ORDER BY "timestamp" ASC
+	`
+	rows, err := r.pool.Query(ctx, query, vehicleID, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var telemetryEntries []*models.VehicleTelemetry
+	for rows.Next() {
 		var entry models.VehicleTelemetry
 		if err := rows.Scan(&entry.ID, &entry.VehicleID, &entry.Timestamp, &entry.Latitude, &entry.Longitude, &entry.Battery, &entry.State); err != nil {
 			return nil, err
@@ -255,3 +906,632 @@ func (r *postgresRepository) GetTelemetryByVehicleID(ctx context.Context, vehicl
 	}
 	return telemetryEntries, nil
 }
+
+// GetTelemetryAround 返回车辆在 t 之前 (含) 和之后最近的遥测点，不存在时对应返回值为 nil
+func (r *postgresRepository) GetTelemetryAround(ctx context.Context, vehicleID string, t time.Time) (*models.VehicleTelemetry, *models.VehicleTelemetry, error) {
+	beforeQuery := `
+		SELECT id, vehicle_id, "timestamp", latitude, longitude, battery, state
+		FROM vehicle_telemetry
+		WHERE vehicle_id = $1 AND "timestamp" <= $2
+		ORDER BY "timestamp" DESC
+		LIMIT 1
+	`
+	afterQuery := `
+		SELECT id, vehicle_id, "timestamp", latitude, longitude, battery, state
+		FROM vehicle_telemetry
+		WHERE vehicle_id = $1 AND "timestamp" > $2
+		ORDER BY "timestamp" ASC
+		LIMIT 1
+	`
+
+	before, err := r.queryTelemetryEntry(ctx, beforeQuery, vehicleID, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := r.queryTelemetryEntry(ctx, afterQuery, vehicleID, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
+
+// queryTelemetryEntry 执行返回单个遥测点的查询，没有结果时返回 nil
+func (r *postgresRepository) queryTelemetryEntry(ctx context.Context, query string, args ...interface{}) (*models.VehicleTelemetry, error) {
+	var entry models.VehicleTelemetry
+	err := r.pool.QueryRow(ctx, query, args...).Scan(
+		&entry.ID, &entry.VehicleID, &entry.Timestamp, &entry.Latitude, &entry.Longitude, &entry.Battery, &entry.State,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// CreateTelemetryReject 隔离一条未通过校验的状态上报
+func (r *postgresRepository) CreateTelemetryReject(ctx context.Context, reject *models.TelemetryReject) error {
+	query := `
+		INSERT INTO telemetry_rejects (vehicle_id, topic, reason, detail, payload)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, received_at
+	`
+	return r.pool.QueryRow(ctx, query,
+		reject.VehicleID, reject.Topic, reject.Reason, reject.Detail, reject.Payload,
+	).Scan(&reject.ID, &reject.ReceivedAt)
+}
+
+// ListTelemetryRejects 按时间倒序返回车辆被隔离的状态上报，reason 为空时不按原因筛选
+func (r *postgresRepository) ListTelemetryRejects(ctx context.Context, vehicleID, reason string, startTime, endTime time.Time, limit int) ([]*models.TelemetryReject, error) {
+	query := `
+		SELECT id, vehicle_id, topic, reason, detail, payload, received_at
+		FROM telemetry_rejects
+		WHERE vehicle_id = $1 AND received_at >= $2 AND received_at <= $3 AND ($4 = '' OR reason = $4)
+		ORDER BY received_at DESC
+		LIMIT $5
+	`
+	rows, err := r.pool.Query(ctx, query, vehicleID, startTime, endTime, reason, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rejects []*models.TelemetryReject
+	for rows.Next() {
+		var rj models.TelemetryReject
+		if err := rows.Scan(&rj.ID, &rj.VehicleID, &rj.Topic, &rj.Reason, &rj.Detail, &rj.Payload, &rj.ReceivedAt); err != nil {
+			return nil, err
+		}
+		rejects = append(rejects, &rj)
+	}
+	return rejects, rows.Err()
+}
+
+// CountTelemetryRejects 按车辆和原因统计时间范围内的隔离次数，次数多的在前
+func (r *postgresRepository) CountTelemetryRejects(ctx context.Context, startTime, endTime time.Time) ([]*models.TelemetryRejectCount, error) {
+	query := `
+		SELECT vehicle_id, reason, COUNT(*), MAX(received_at)
+		FROM telemetry_rejects
+		WHERE received_at >= $1 AND received_at <= $2
+		GROUP BY vehicle_id, reason
+		ORDER BY COUNT(*) DESC, vehicle_id, reason
+	`
+	rows, err := r.pool.Query(ctx, query, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*models.TelemetryRejectCount
+	for rows.Next() {
+		var c models.TelemetryRejectCount
+		if err := rows.Scan(&c.VehicleID, &c.Reason, &c.Count, &c.LastReceivedAt); err != nil {
+			return nil, err
+		}
+		counts = append(counts, &c)
+	}
+	return counts, rows.Err()
+}
+
+// --- Command Log Methods ---
+
+func (r *postgresRepository) CreateCommandLog(ctx context.Context, cmd *models.CommandLog) error {
+	query := `
+		INSERT INTO command_logs (id, vehicle_id, command, task_id, issued_by, status, error)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, NULLIF($7, ''))
+		RETURNING created_at
+	`
+	return r.pool.QueryRow(ctx, query,
+		cmd.ID, cmd.VehicleID, cmd.Command, cmd.TaskID, cmd.IssuedBy, cmd.Status, cmd.Error,
+	).Scan(&cmd.CreatedAt)
+}
+
+func (r *postgresRepository) ListCommandLogs(ctx context.Context, vehicleID string, startTime, endTime time.Time) ([]*models.CommandLog, error) {
+	query := `
+		SELECT id, vehicle_id, command, COALESCE(task_id, ''), COALESCE(issued_by, ''), status, COALESCE(error, ''), created_at
+		FROM command_logs
+		WHERE vehicle_id = $1 AND created_at >= $2 AND created_at <= $3
+		ORDER BY created_at ASC
+	`
+	rows, err := r.pool.Query(ctx, query, vehicleID, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commands []*models.CommandLog
+	for rows.Next() {
+		var cmd models.CommandLog
+		if err := rows.Scan(&cmd.ID, &cmd.VehicleID, &cmd.Command, &cmd.TaskID, &cmd.IssuedBy, &cmd.Status, &cmd.Error, &cmd.CreatedAt); err != nil {
+			return nil, err
+		}
+		commands = append(commands, &cmd)
+	}
+	return commands, rows.Err()
+}
+
+// --- Shadow Evaluation Methods ---
+
+func (r *postgresRepository) CreateShadowEvaluation(ctx context.Context, eval *models.ShadowEvaluation) error {
+	activeBytes, err := json.Marshal(eval.ActiveResult)
+	if err != nil {
+		return err
+	}
+	var candidateBytes []byte
+	if eval.CandidateResult != nil {
+		if candidateBytes, err = json.Marshal(eval.CandidateResult); err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO shadow_evaluations
+			(decision_id, vehicle_id, active_model, candidate_model, active_result, candidate_result, candidate_error, agreed)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8)
+		RETURNING id, created_at
+	`
+	err = r.pool.QueryRow(ctx, query,
+		eval.DecisionID,
+		eval.VehicleID,
+		eval.ActiveModel,
+		eval.CandidateModel,
+		activeBytes,
+		candidateBytes,
+		eval.CandidateError,
+		eval.Agreed,
+	).Scan(&eval.ID, &eval.CreatedAt)
+	if err != nil {
+		log.Printf("ERROR: Failed to create shadow evaluation: %v", err)
+	}
+	return err
+}
+
+func (r *postgresRepository) ListShadowEvaluations(ctx context.Context, startTime, endTime time.Time) ([]*models.ShadowEvaluation, error) {
+	query := `
+		SELECT id, decision_id, vehicle_id, active_model, candidate_model,
+			active_result, candidate_result, COALESCE(candidate_error, ''), agreed, created_at
+		FROM shadow_evaluations
+		WHERE created_at >= $1 AND created_at <= $2
+		ORDER BY created_at DESC
+	`
+	rows, err := r.pool.Query(ctx, query, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var evals []*models.ShadowEvaluation
+	for rows.Next() {
+		var e models.ShadowEvaluation
+		if err := rows.Scan(&e.ID, &e.DecisionID, &e.VehicleID, &e.ActiveModel, &e.CandidateModel,
+			&e.ActiveResult, &e.CandidateResult, &e.CandidateError, &e.Agreed, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		evals = append(evals, &e)
+	}
+	return evals, nil
+}
+
+// --- Trash Taxonomy Methods ---
+
+const trashCategoryColumns = `
+	c.id, c.name_zh, c.name_en, c.recyclable, c.estimated_weight_grams,
+	COALESCE(array_agg(m.model_class ORDER BY m.model_class) FILTER (WHERE m.model_class IS NOT NULL), '{}'),
+	c.created_at, c.updated_at
+`
+
+func scanTrashCategory(row pgx.Row) (*models.TrashCategory, error) {
+	var c models.TrashCategory
+	err := row.Scan(&c.ID, &c.NameZh, &c.NameEn, &c.Recyclable, &c.EstimatedWeightGrams, &c.ModelClasses, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *postgresRepository) ListTrashCategories(ctx context.Context) ([]*models.TrashCategory, error) {
+	query := `
+		SELECT ` + trashCategoryColumns + `
+		FROM trash_categories c
+		LEFT JOIN trash_class_mappings m ON m.category_id = c.id
+		GROUP BY c.id
+		ORDER BY c.id
+	`
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []*models.TrashCategory
+	for rows.Next() {
+		c, err := scanTrashCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+func (r *postgresRepository) GetTrashCategory(ctx context.Context, id string) (*models.TrashCategory, error) {
+	query := `
+		SELECT ` + trashCategoryColumns + `
+		FROM trash_categories c
+		LEFT JOIN trash_class_mappings m ON m.category_id = c.id
+		WHERE c.id = $1
+		GROUP BY c.id
+	`
+	c, err := scanTrashCategory(r.pool.QueryRow(ctx, query, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// CreateTrashCategory 创建类别及其模型类别映射，ID 或模型类别已被占用时返回 ErrConflict
+func (r *postgresRepository) CreateTrashCategory(ctx context.Context, category *models.TrashCategory) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO trash_categories (id, name_zh, name_en, recyclable, estimated_weight_grams)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at, updated_at
+	`
+	err = tx.QueryRow(ctx, query,
+		category.ID, category.NameZh, category.NameEn, category.Recyclable, category.EstimatedWeightGrams,
+	).Scan(&category.CreatedAt, &category.UpdatedAt)
+	if err != nil {
+		return translateConflict(err)
+	}
+	if err := replaceClassMappings(ctx, tx, category.ID, category.ModelClasses); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// UpdateTrashCategory 更新类别属性并整体替换其模型类别映射，类别不存在时返回 false
+func (r *postgresRepository) UpdateTrashCategory(ctx context.Context, category *models.TrashCategory) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE trash_categories
+		SET name_zh = $2, name_en = $3, recyclable = $4, estimated_weight_grams = $5, updated_at = NOW()
+		WHERE id = $1
+		RETURNING created_at, updated_at
+	`
+	err = tx.QueryRow(ctx, query,
+		category.ID, category.NameZh, category.NameEn, category.Recyclable, category.EstimatedWeightGrams,
+	).Scan(&category.CreatedAt, &category.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := replaceClassMappings(ctx, tx, category.ID, category.ModelClasses); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// replaceClassMappings 将类别的模型类别映射替换为 classes
+func replaceClassMappings(ctx context.Context, tx pgx.Tx, categoryID string, classes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM trash_class_mappings WHERE category_id = $1`, categoryID); err != nil {
+		return err
+	}
+	for _, class := range classes {
+		_, err := tx.Exec(ctx, `INSERT INTO trash_class_mappings (model_class, category_id) VALUES ($1, $2)`, class, categoryID)
+		if err != nil {
+			return translateConflict(err)
+		}
+	}
+	return nil
+}
+
+func (r *postgresRepository) DeleteTrashCategory(ctx context.Context, id string) (bool, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM trash_categories WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListCollectionRecords 返回时间范围内动作为 pickup 的决策，按模型类别关联到分类体系
+func (r *postgresRepository) ListCollectionRecords(ctx context.Context, startTime, endTime time.Time) ([]*models.CollectionRecord, error) {
+	query := `
+		SELECT d.vehicle_id, d."timestamp", COALESCE(d.server_decision->>'class', ''),
+			COALESCE(c.id, ''), COALESCE(c.recyclable, FALSE), COALESCE(c.estimated_weight_grams, 0),
+			d.latitude, d.longitude
+		FROM decision_logs d
+		LEFT JOIN trash_class_mappings m ON m.model_class = d.server_decision->>'class'
+		LEFT JOIN trash_categories c ON c.id = m.category_id
+		WHERE d."timestamp" >= $1 AND d."timestamp" <= $2
+			AND d.server_decision->>'action' = 'pickup'
+		ORDER BY d."timestamp" ASC
+	`
+	rows, err := r.pool.Query(ctx, query, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*models.CollectionRecord
+	for rows.Next() {
+		var rec models.CollectionRecord
+		var lat, lng *float64
+		if err := rows.Scan(&rec.VehicleID, &rec.Timestamp, &rec.Class, &rec.CategoryID, &rec.Recyclable, &rec.EstimatedWeightGrams, &lat, &lng); err != nil {
+			return nil, err
+		}
+		if lat != nil && lng != nil {
+			rec.Location = &models.Position{Lat: *lat, Lng: *lng}
+		}
+		records = append(records, &rec)
+	}
+	return records, rows.Err()
+}
+
+// ListTelemetryRollups 返回车辆在时间范围内的小时汇总
+func (r *postgresRepository) ListTelemetryRollups(ctx context.Context, vehicleID string, startTime, endTime time.Time) ([]*models.TelemetryRollup, error) {
+	query := `
+		SELECT vehicle_id, bucket_start, sample_count, avg_latitude, avg_longitude,
+		       avg_battery, min_battery, max_battery, last_state, last_seen_at
+		FROM telemetry_rollups_hourly
+		WHERE vehicle_id = $1 AND bucket_start >= $2 AND bucket_start <= $3
+		ORDER BY bucket_start ASC
+	`
+	rows, err := r.pool.Query(ctx, query, vehicleID, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollups []*models.TelemetryRollup
+	for rows.Next() {
+		var ru models.TelemetryRollup
+		if err := rows.Scan(&ru.VehicleID, &ru.BucketStart, &ru.SampleCount, &ru.AvgLatitude, &ru.AvgLongitude,
+			&ru.AvgBattery, &ru.MinBattery, &ru.MaxBattery, &ru.LastState, &ru.LastSeenAt); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, &ru)
+	}
+	return rollups, rows.Err()
+}
+
+// --- Retention Methods ---
+
+// expiredImagesCondition 选出早于 $1 且仍保存有图片的决策，$2 为 true 时排除已标注的决策
+const expiredImagesCondition = `
+	d."timestamp" < $1 AND d.image_key <> ''
+	AND NOT ($2 AND EXISTS (SELECT 1 FROM decision_labels l WHERE l.decision_id = d.id))
+`
+
+// ListExpiredDecisionImages 返回最多 limit 条图片已过保留期的决策
+func (r *postgresRepository) ListExpiredDecisionImages(ctx context.Context, before time.Time, keepLabelled bool, limit int) ([]*models.DecisionImageKeys, error) {
+	query := `
+		SELECT d.id, d.image_key, d.thumbnail_key, d.preview_key
+		FROM decision_logs d
+		WHERE ` + expiredImagesCondition + `
+		ORDER BY d."timestamp" ASC
+		LIMIT $3
+	`
+	rows, err := r.pool.Query(ctx, query, before, keepLabelled, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []*models.DecisionImageKeys
+	for rows.Next() {
+		var k models.DecisionImageKeys
+		if err := rows.Scan(&k.DecisionID, &k.ImageKey, &k.ThumbnailKey, &k.PreviewKey); err != nil {
+			return nil, err
+		}
+		images = append(images, &k)
+	}
+	return images, rows.Err()
+}
+
+// CountExpiredDecisionImages 统计图片已过保留期的决策数，以及因已标注而保留的决策数
+func (r *postgresRepository) CountExpiredDecisionImages(ctx context.Context, before time.Time, keepLabelled bool) (int64, int64, error) {
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE l.decision_id IS NULL OR NOT $2),
+			COUNT(*) FILTER (WHERE l.decision_id IS NOT NULL AND $2)
+		FROM decision_logs d
+		LEFT JOIN decision_labels l ON l.decision_id = d.id
+		WHERE d."timestamp" < $1 AND d.image_key <> ''
+	`
+	var expired, kept int64
+	err := r.pool.QueryRow(ctx, query, before, keepLabelled).Scan(&expired, &kept)
+	return expired, kept, err
+}
+
+// ClearDecisionImageKeys 在图片对象删除后清空决策的图片字段，决策记录本身保留
+func (r *postgresRepository) ClearDecisionImageKeys(ctx context.Context, decisionIDs []string) error {
+	query := `UPDATE decision_logs SET image_key = '', thumbnail_key = '', preview_key = '' WHERE id = ANY($1)`
+	_, err := r.pool.Exec(ctx, query, decisionIDs)
+	return err
+}
+
+// RollupAndDeleteTelemetry 删除最多 limit 条早于 before 的原始遥测，并在同一语句中将其并入小时汇总，
+// 因此重复执行或迟到的数据不会被重复计数。返回删除的行数。
+func (r *postgresRepository) RollupAndDeleteTelemetry(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `
+		WITH doomed AS (
+			DELETE FROM vehicle_telemetry
+			WHERE id IN (
+				SELECT id FROM vehicle_telemetry WHERE "timestamp" < $1 ORDER BY "timestamp" LIMIT $2
+			)
+			RETURNING vehicle_id, "timestamp", latitude, longitude, battery, state
+		),
+		buckets AS (
+			SELECT
+				vehicle_id,
+				date_trunc('hour', "timestamp") AS bucket_start,
+				COUNT(*) AS sample_count,
+				AVG(latitude) AS avg_latitude,
+				AVG(longitude) AS avg_longitude,
+				AVG(battery) AS avg_battery,
+				MIN(battery) AS min_battery,
+				MAX(battery) AS max_battery,
+				(array_agg(state ORDER BY "timestamp" DESC))[1] AS last_state,
+				MAX("timestamp") AS last_seen_at
+			FROM doomed
+			GROUP BY vehicle_id, date_trunc('hour', "timestamp")
+		),
+		merged AS (
+			INSERT INTO telemetry_rollups_hourly AS t (
+				vehicle_id, bucket_start, sample_count, avg_latitude, avg_longitude,
+				avg_battery, min_battery, max_battery, last_state, last_seen_at
+			)
+			SELECT vehicle_id, bucket_start, sample_count, avg_latitude, avg_longitude,
+			       avg_battery, min_battery, max_battery, last_state, last_seen_at
+			FROM buckets
+			ON CONFLICT (vehicle_id, bucket_start) DO UPDATE SET
+				sample_count = t.sample_count + EXCLUDED.sample_count,
+				avg_latitude = (t.avg_latitude * t.sample_count + EXCLUDED.avg_latitude * EXCLUDED.sample_count) / (t.sample_count + EXCLUDED.sample_count),
+				avg_longitude = (t.avg_longitude * t.sample_count + EXCLUDED.avg_longitude * EXCLUDED.sample_count) / (t.sample_count + EXCLUDED.sample_count),
+				avg_battery = (t.avg_battery * t.sample_count + EXCLUDED.avg_battery * EXCLUDED.sample_count) / (t.sample_count + EXCLUDED.sample_count),
+				min_battery = LEAST(t.min_battery, EXCLUDED.min_battery),
+				max_battery = GREATEST(t.max_battery, EXCLUDED.max_battery),
+				last_state = CASE WHEN EXCLUDED.last_seen_at >= t.last_seen_at THEN EXCLUDED.last_state ELSE t.last_state END,
+				last_seen_at = GREATEST(t.last_seen_at, EXCLUDED.last_seen_at)
+		)
+		SELECT COUNT(*) FROM doomed
+	`
+	var deleted int64
+	err := r.pool.QueryRow(ctx, query, before, limit).Scan(&deleted)
+	return deleted, err
+}
+
+func (r *postgresRepository) CountTelemetryBefore(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM vehicle_telemetry WHERE "timestamp" < $1`, before).Scan(&n)
+	return n, err
+}
+
+// DeleteTelemetryRollupsBefore 删除最多 limit 条早于 before 的小时汇总，返回删除的行数
+func (r *postgresRepository) DeleteTelemetryRollupsBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM telemetry_rollups_hourly
+		WHERE (vehicle_id, bucket_start) IN (
+			SELECT vehicle_id, bucket_start FROM telemetry_rollups_hourly
+			WHERE bucket_start < $1
+			ORDER BY bucket_start
+			LIMIT $2
+		)
+	`
+	tag, err := r.pool.Exec(ctx, query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *postgresRepository) CountTelemetryRollupsBefore(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM telemetry_rollups_hourly WHERE bucket_start < $1`, before).Scan(&n)
+	return n, err
+}
+
+// DeleteTelemetryRejectsBefore 删除最多 limit 条早于 before 被隔离的状态上报，返回删除的行数
+func (r *postgresRepository) DeleteTelemetryRejectsBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM telemetry_rejects
+		WHERE id IN (
+			SELECT id FROM telemetry_rejects
+			WHERE received_at < $1
+			ORDER BY received_at
+			LIMIT $2
+		)
+	`
+	tag, err := r.pool.Exec(ctx, query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *postgresRepository) CountTelemetryRejectsBefore(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM telemetry_rejects WHERE received_at < $1`, before).Scan(&n)
+	return n, err
+}
+
+// --- Outbox Methods ---
+
+func insertOutboxMessages(ctx context.Context, db execer, messages []*models.OutboxMessage) error {
+	query := `INSERT INTO outbox (kind, payload) VALUES ($1, $2)`
+	for _, msg := range messages {
+		if _, err := db.Exec(ctx, query, msg.Kind, []byte(msg.Payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClaimOutboxMessages 领取至多 limit 条到期的发件箱消息，并将其 available_at 推迟 lease 作为租约。
+// 领取是单条自动提交的语句 (子查询使用 FOR UPDATE SKIP LOCKED)，多个副本可同时调用而不会领取同一条消息，
+// 处理消息期间也不持有任何事务或行锁。处理者在租约到期前未删除或更新消息 (例如进程崩溃) 时，
+// 消息会被重新领取，因此处理必须幂等。
+func (r *postgresRepository) ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxMessage, error) {
+	query := `
+		UPDATE outbox SET available_at = NOW() + $2 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE dead_at IS NULL AND available_at <= NOW()
+			ORDER BY available_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, payload, attempts, available_at, COALESCE(last_error, ''), created_at
+	`
+	rows, err := r.pool.Query(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.OutboxMessage
+	for rows.Next() {
+		var msg models.OutboxMessage
+		var payload []byte
+		if err := rows.Scan(&msg.ID, &msg.Kind, &payload, &msg.Attempts, &msg.AvailableAt, &msg.LastError, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		msg.Payload = payload
+		messages = append(messages, &msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// DeleteOutboxMessage 删除处理完成的发件箱消息
+func (r *postgresRepository) DeleteOutboxMessage(ctx context.Context, id int64) error {
+	_, err := r.pool.Exec(ctx, `DELETE FROM outbox WHERE id = $1`, id)
+	return err
+}
+
+// UpdateOutboxMessage 写回处理失败的消息的 Attempts / AvailableAt / LastError / DeadAt
+func (r *postgresRepository) UpdateOutboxMessage(ctx context.Context, msg *models.OutboxMessage) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE outbox SET attempts = $2, available_at = $3, last_error = $4, dead_at = $5 WHERE id = $1`,
+		msg.ID, msg.Attempts, msg.AvailableAt, msg.LastError, msg.DeadAt,
+	)
+	return err
+}
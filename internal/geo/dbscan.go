@@ -0,0 +1,109 @@
+package geo
+
+import (
+	"math"
+	"patrol-cloud/internal/models"
+)
+
+// Noise 是 DBSCAN 中不属于任何簇的点的标签
+const Noise = -1
+
+// DBSCAN 对点进行基于密度的聚类：半径 epsMeters 内 (含自身) 至少有 minPoints 个点的点为核心点，
+// 从核心点可达的点归入同一簇。返回每个点的簇编号 (从 0 开始)，噪声点为 Noise。
+//
+// 邻域查询使用边长为 epsMeters 的网格索引，点在局部等距投影下分桶，再以大圆距离精确判断。
+func DBSCAN(points []models.Position, epsMeters float64, minPoints int) []int {
+	labels := make([]int, len(points))
+	if len(points) == 0 || epsMeters <= 0 {
+		for i := range labels {
+			labels[i] = Noise
+		}
+		return labels
+	}
+
+	idx := newGridIndex(points, epsMeters)
+
+	const unvisited = -2
+	for i := range labels {
+		labels[i] = unvisited
+	}
+
+	cluster := 0
+	for i := range points {
+		if labels[i] != unvisited {
+			continue
+		}
+		neighbors := idx.neighbors(i)
+		if len(neighbors) < minPoints {
+			labels[i] = Noise
+			continue
+		}
+
+		labels[i] = cluster
+		queue := neighbors
+		for len(queue) > 0 {
+			j := queue[0]
+			queue = queue[1:]
+
+			if labels[j] == Noise {
+				// 边界点：归入簇但不继续扩展
+				labels[j] = cluster
+			}
+			if labels[j] != unvisited {
+				continue
+			}
+			labels[j] = cluster
+			if jNeighbors := idx.neighbors(j); len(jNeighbors) >= minPoints {
+				queue = append(queue, jNeighbors...)
+			}
+		}
+		cluster++
+	}
+	return labels
+}
+
+type cellKey struct{ x, y int64 }
+
+// gridIndex 将点按等距投影后的坐标放入边长为 eps 的网格
+type gridIndex struct {
+	points []models.Position
+	eps    float64
+	cells  map[cellKey][]int
+	keys   []cellKey
+}
+
+func newGridIndex(points []models.Position, eps float64) *gridIndex {
+	// 以所有点的平均纬度作为投影基准，城市尺度下误差可以忽略
+	cosLat := math.Cos(radians(Centroid(points).Lat))
+
+	g := &gridIndex{
+		points: points,
+		eps:    eps,
+		cells:  make(map[cellKey][]int),
+		keys:   make([]cellKey, len(points)),
+	}
+	for i, p := range points {
+		x := radians(p.Lng) * earthRadiusMeters * cosLat
+		y := radians(p.Lat) * earthRadiusMeters
+		key := cellKey{int64(math.Floor(x / eps)), int64(math.Floor(y / eps))}
+		g.keys[i] = key
+		g.cells[key] = append(g.cells[key], i)
+	}
+	return g
+}
+
+// neighbors 返回距离点 i 不超过 eps 的所有点 (含 i 本身)
+func (g *gridIndex) neighbors(i int) []int {
+	key := g.keys[i]
+	var result []int
+	for dx := int64(-1); dx <= 1; dx++ {
+		for dy := int64(-1); dy <= 1; dy++ {
+			for _, j := range g.cells[cellKey{key.x + dx, key.y + dy}] {
+				if Distance(g.points[i], g.points[j]) <= g.eps {
+					result = append(result, j)
+				}
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package geo
+
+import (
+	"patrol-cloud/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// offset 返回在 origin 基础上向北 north 米、向东 east 米的位置 (近似)
+func offset(origin models.Position, north, east float64) models.Position {
+	const metersPerDegree = 111320.0
+	return models.Position{
+		Lat: origin.Lat + north/metersPerDegree,
+		Lng: origin.Lng + east/(metersPerDegree*0.857), // cos(31°)
+	}
+}
+
+func TestDBSCAN(t *testing.T) {
+	origin := models.Position{Lat: 31.0, Lng: 121.0}
+
+	var points []models.Position
+	// 簇 A：原点附近 5 个点，间距约 10 米
+	for i := 0; i < 5; i++ {
+		points = append(points, offset(origin, float64(i)*10, 0))
+	}
+	// 簇 B：1 公里外的 4 个点
+	for i := 0; i < 4; i++ {
+		points = append(points, offset(origin, 1000, float64(i)*10))
+	}
+	// 孤立点
+	points = append(points, offset(origin, 500, 500))
+
+	labels := DBSCAN(points, 25, 3)
+
+	for i := 1; i < 5; i++ {
+		assert.Equal(t, labels[0], labels[i])
+	}
+	for i := 6; i < 9; i++ {
+		assert.Equal(t, labels[5], labels[i])
+	}
+	assert.NotEqual(t, labels[0], labels[5])
+	assert.NotEqual(t, Noise, labels[0])
+	assert.NotEqual(t, Noise, labels[5])
+	assert.Equal(t, Noise, labels[9])
+}
+
+func TestInterpolate(t *testing.T) {
+	a := models.Position{Lat: 31.0, Lng: 121.0}
+	b := models.Position{Lat: 31.002, Lng: 121.004}
+	ta := time.Unix(1000, 0)
+	tb := ta.Add(10 * time.Second)
+
+	mid := Interpolate(a, ta, b, tb, ta.Add(5*time.Second))
+	assert.InDelta(t, 31.001, mid.Lat, 1e-9)
+	assert.InDelta(t, 121.002, mid.Lng, 1e-9)
+
+	assert.Equal(t, a, Interpolate(a, ta, b, tb, ta.Add(-time.Second)))
+	assert.Equal(t, b, Interpolate(a, ta, b, tb, tb.Add(time.Second)))
+	assert.InDelta(t, 2*Distance(a, mid), Distance(a, b), 0.5)
+}
@@ -0,0 +1,56 @@
+// Package geo 提供轨迹插值、距离计算和基于密度的聚类 (DBSCAN)，用于决策定位和垃圾热点地图
+package geo
+
+import (
+	"math"
+	"patrol-cloud/internal/models"
+	"time"
+)
+
+// earthRadiusMeters 是地球平均半径
+const earthRadiusMeters = 6371000.0
+
+// Distance 返回两点间的大圆距离 (米)
+func Distance(a, b models.Position) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat := lat2 - lat1
+	dLng := radians(b.Lng - a.Lng)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Interpolate 按时间在 a (时刻 ta) 与 b (时刻 tb) 之间线性插值出 t 时刻的位置，t 超出区间时取端点
+func Interpolate(a models.Position, ta time.Time, b models.Position, tb time.Time, t time.Time) models.Position {
+	span := tb.Sub(ta)
+	if span <= 0 || !t.After(ta) {
+		return a
+	}
+	if !t.Before(tb) {
+		return b
+	}
+	f := float64(t.Sub(ta)) / float64(span)
+	return models.Position{
+		Lat: a.Lat + (b.Lat-a.Lat)*f,
+		Lng: a.Lng + (b.Lng-a.Lng)*f,
+	}
+}
+
+// Centroid 返回一组点的平均位置 (适用于城市尺度的小范围聚类)
+func Centroid(points []models.Position) models.Position {
+	var c models.Position
+	if len(points) == 0 {
+		return c
+	}
+	for _, p := range points {
+		c.Lat += p.Lat
+		c.Lng += p.Lng
+	}
+	c.Lat /= float64(len(points))
+	c.Lng /= float64(len(points))
+	return c
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
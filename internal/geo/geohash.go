@@ -0,0 +1,47 @@
+package geo
+
+import "patrol-cloud/internal/models"
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Geohash 返回位置的 geohash 编码，precision 为字符数 (1-12)。
+// 6 位约对应 1.2km × 0.6km 的网格，用作统计时的区域划分。
+func Geohash(p models.Position, precision int) string {
+	if precision < 1 {
+		precision = 1
+	}
+	if precision > 12 {
+		precision = 12
+	}
+
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+	hash := make([]byte, 0, precision)
+	bit, ch := 0, 0
+	even := true // 偶数位编码经度
+	for len(hash) < precision {
+		var r *[2]float64
+		var v float64
+		if even {
+			r, v = &lngRange, p.Lng
+		} else {
+			r, v = &latRange, p.Lat
+		}
+		mid := (r[0] + r[1]) / 2
+		if v >= mid {
+			ch |= 1 << (4 - bit)
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+
+		if bit < 4 {
+			bit++
+		} else {
+			hash = append(hash, geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
@@ -0,0 +1,14 @@
+package geo
+
+import (
+	"patrol-cloud/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeohash(t *testing.T) {
+	// 参考值来自 geohash.org
+	assert.Equal(t, "ezs42", Geohash(models.Position{Lat: 42.6, Lng: -5.6}, 5))
+	assert.Equal(t, "wtw3sjq6q", Geohash(models.Position{Lat: 31.2304, Lng: 121.4737}, 9))
+}
@@ -0,0 +1,36 @@
+package geo
+
+import "patrol-cloud/internal/models"
+
+// FeatureCollection 是 GeoJSON (RFC 7946) 的要素集合
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+// Feature 是 GeoJSON 要素
+type Feature struct {
+	Type       string                 `json:"type"`
+	Geometry   Geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Geometry 是 GeoJSON 几何对象，目前只使用 Point
+type Geometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// NewFeatureCollection 创建一个空的要素集合
+func NewFeatureCollection() *FeatureCollection {
+	return &FeatureCollection{Type: "FeatureCollection", Features: []*Feature{}}
+}
+
+// NewPointFeature 创建一个点要素，GeoJSON 坐标顺序为 [经度, 纬度]
+func NewPointFeature(p models.Position, properties map[string]interface{}) *Feature {
+	return &Feature{
+		Type:       "Feature",
+		Geometry:   Geometry{Type: "Point", Coordinates: []float64{p.Lng, p.Lat}},
+		Properties: properties,
+	}
+}
@@ -0,0 +1,41 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Box 是要绘制到图片上的一个矩形框 (像素坐标)
+type Box struct {
+	Rect  image.Rectangle
+	Color color.Color
+}
+
+// DrawBoxes 返回在原图上绘制了矩形框边线的副本，thickness 为边线宽度 (像素)
+func DrawBoxes(img image.Image, boxes []Box, thickness int) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+
+	if thickness < 1 {
+		thickness = 1
+	}
+	for _, box := range boxes {
+		r := box.Rect.Intersect(dst.Bounds())
+		if r.Empty() {
+			continue
+		}
+		src := image.NewUniform(box.Color)
+		edges := []image.Rectangle{
+			image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+thickness), // 上
+			image.Rect(r.Min.X, r.Max.Y-thickness, r.Max.X, r.Max.Y), // 下
+			image.Rect(r.Min.X, r.Min.Y, r.Min.X+thickness, r.Max.Y), // 左
+			image.Rect(r.Max.X-thickness, r.Min.Y, r.Max.X, r.Max.Y), // 右
+		}
+		for _, e := range edges {
+			draw.Draw(dst, e.Intersect(r), src, image.Point{}, draw.Src)
+		}
+	}
+	return dst
+}
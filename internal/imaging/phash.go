@@ -0,0 +1,128 @@
+// Package imaging 提供与决策图片相关的纯 Go 图像处理工具
+package imaging
+
+import (
+	"bytes"
+	"image"
+	_ "image/jpeg" // 注册解码器
+	_ "image/png"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// phashSampleSize 是计算 DCT 前将图片缩放到的边长
+	phashSampleSize = 32
+	// phashLowFreqSize 是参与哈希的低频系数区域边长 (8x8 = 64 位)
+	phashLowFreqSize = 8
+)
+
+// PerceptualHash 解码图片并计算其 64 位 DCT 感知哈希 (pHash)。
+// 同一物体在轻微的角度、缩放或重新压缩下，哈希的汉明距离通常很小。
+func PerceptualHash(data []byte) (uint64, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	return HashImage(img), nil
+}
+
+// HashImage 计算已解码图片的感知哈希
+func HashImage(img image.Image) uint64 {
+	pixels := grayscaleSample(img, phashSampleSize)
+	coeffs := dct2D(pixels, phashSampleSize)
+
+	// 取左上角的低频系数，跳过代表平均亮度的直流分量来计算中位数
+	lowFreq := make([]float64, 0, phashLowFreqSize*phashLowFreqSize)
+	for y := 0; y < phashLowFreqSize; y++ {
+		for x := 0; x < phashLowFreqSize; x++ {
+			lowFreq = append(lowFreq, coeffs[y*phashSampleSize+x])
+		}
+	}
+	sorted := append([]float64(nil), lowFreq[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, c := range lowFreq {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// HammingDistance 返回两个哈希之间不同的位数
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// grayscaleSample 以区域平均的方式将图片缩放为 size x size 的灰度矩阵
+func grayscaleSample(img image.Image, size int) []float64 {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	out := make([]float64, size*size)
+	if w == 0 || h == 0 {
+		return out
+	}
+
+	for sy := 0; sy < size; sy++ {
+		y0 := bounds.Min.Y + sy*h/size
+		y1 := bounds.Min.Y + (sy+1)*h/size
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for sx := 0; sx < size; sx++ {
+			x0 := bounds.Min.X + sx*w/size
+			x1 := bounds.Min.X + (sx+1)*w/size
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					r, g, b, _ := img.At(x, y).RGBA()
+					// ITU-R BT.601 亮度
+					sum += 0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(b>>8)
+				}
+			}
+			out[sy*size+sx] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+	return out
+}
+
+// dct2D 对 n x n 矩阵做二维 DCT-II (先行后列)
+func dct2D(in []float64, n int) []float64 {
+	cos := make([]float64, n*n)
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			cos[k*n+i] = math.Cos(math.Pi * float64(k) * (2*float64(i) + 1) / float64(2*n))
+		}
+	}
+
+	tmp := make([]float64, n*n)
+	for y := 0; y < n; y++ {
+		for k := 0; k < n; k++ {
+			var sum float64
+			for x := 0; x < n; x++ {
+				sum += in[y*n+x] * cos[k*n+x]
+			}
+			tmp[y*n+k] = sum
+		}
+	}
+
+	out := make([]float64, n*n)
+	for x := 0; x < n; x++ {
+		for k := 0; k < n; k++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				sum += tmp[y*n+x] * cos[k*n+y]
+			}
+			out[k*n+x] = sum
+		}
+	}
+	return out
+}
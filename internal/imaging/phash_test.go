@@ -0,0 +1,58 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scene 绘制一张平滑的测试图片 (一个亮斑叠加在渐变背景上)，
+// shift 以图片宽度的比例模拟轻微的视角偏移
+func scene(w, h int, shift float64, invert bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			u := float64(x)/float64(w) + shift
+			v := float64(y) / float64(h)
+			blob := math.Exp(-((u-0.35)*(u-0.35) + (v-0.6)*(v-0.6)) / 0.02)
+			l := 60 + 80*u + 40*math.Sin(v*5) + 110*blob
+			if invert {
+				l = 255 - l
+			}
+			g := uint8(math.Max(0, math.Min(255, l)))
+			img.Set(x, y, color.RGBA{g, g, g, 255})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 70}))
+	return buf.Bytes()
+}
+
+func TestPerceptualHash(t *testing.T) {
+	original, err := PerceptualHash(encodeJPEG(t, scene(320, 240, 0, false)))
+	require.NoError(t, err)
+
+	// 不同分辨率 + 轻微偏移 + 重新压缩，应被视为同一场景
+	similar, err := PerceptualHash(encodeJPEG(t, scene(640, 480, 0.02, false)))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, HammingDistance(original, similar), 8)
+
+	different, err := PerceptualHash(encodeJPEG(t, scene(320, 240, 0, true)))
+	require.NoError(t, err)
+	assert.Greater(t, HammingDistance(original, different), 20)
+}
+
+func TestPerceptualHashRejectsNonImage(t *testing.T) {
+	_, err := PerceptualHash([]byte("not an image"))
+	assert.Error(t, err)
+}
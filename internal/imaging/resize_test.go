@@ -0,0 +1,30 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFit(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			if x >= 200 {
+				src.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+
+	dst := Fit(src, 100)
+	assert.Equal(t, image.Rect(0, 0, 100, 50), dst.Bounds())
+	r, _, _, _ := dst.At(10, 10).RGBA()
+	assert.Equal(t, uint32(0), r)
+	r, _, _, _ = dst.At(90, 10).RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+
+	// 不超过上限的图片原样返回
+	assert.Same(t, src, Fit(src, 400).(*image.Gray))
+}
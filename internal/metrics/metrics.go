@@ -0,0 +1,190 @@
+// Package metrics 提供进程内的简单计数器、直方图和瞬时值，并通过 /api/v1/metrics 以 JSON 形式暴露
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default 是应用使用的全局指标注册表
+var Default = NewRegistry()
+
+// Registry 按名称保存所有指标，Snapshot 时读取它们的当前值
+type Registry struct {
+	mu    sync.RWMutex
+	items map[string]func() interface{}
+}
+
+// NewRegistry 创建一个空的注册表
+func NewRegistry() *Registry {
+	return &Registry{items: make(map[string]func() interface{})}
+}
+
+// Counter 注册 (或返回已存在的) 计数器
+func (r *Registry) Counter(name string) *Counter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.lookup(name).(*Counter); ok {
+		return c
+	}
+	c := &Counter{}
+	r.items[name] = func() interface{} { return c }
+	return c
+}
+
+// Histogram 注册 (或返回已存在的) 时长直方图，bounds 为各桶的上界
+func (r *Registry) Histogram(name string, bounds []time.Duration) *Histogram {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok := r.lookup(name).(*Histogram); ok {
+		return h
+	}
+	h := newHistogram(bounds)
+	r.items[name] = func() interface{} { return h }
+	return h
+}
+
+// GaugeFunc 注册一个在读取时才计算的瞬时值 (例如队列长度)，同名时覆盖
+func (r *Registry) GaugeFunc(name string, fn func() interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[name] = fn
+}
+
+// lookup 返回已注册指标对象本身 (仅适用于 Counter 和 Histogram)，调用方需持有锁
+func (r *Registry) lookup(name string) interface{} {
+	if fn, ok := r.items[name]; ok {
+		return fn()
+	}
+	return nil
+}
+
+// Snapshot 返回所有指标的当前值，键为指标名
+func (r *Registry) Snapshot() map[string]interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snapshot := make(map[string]interface{}, len(r.items))
+	for name, fn := range r.items {
+		switch v := fn().(type) {
+		case *Counter:
+			snapshot[name] = v.Value()
+		case *Histogram:
+			snapshot[name] = v.Snapshot()
+		default:
+			snapshot[name] = v
+		}
+	}
+	return snapshot
+}
+
+// Counter 是一个只增的并发安全计数器
+type Counter struct {
+	v atomic.Int64
+}
+
+// Inc 将计数加一
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add 将计数增加 n
+func (c *Counter) Add(n int64) { c.v.Add(n) }
+
+// Value 返回当前计数
+func (c *Counter) Value() int64 { return c.v.Load() }
+
+// DefaultLatencyBounds 是适用于请求级耗时的默认桶上界
+var DefaultLatencyBounds = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Histogram 统计时长分布
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []time.Duration
+	counts []int64 // 比 bounds 多一个溢出桶
+	count  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func newHistogram(bounds []time.Duration) *Histogram {
+	sorted := append([]time.Duration(nil), bounds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return &Histogram{bounds: sorted, counts: make([]int64, len(sorted)+1)}
+}
+
+// Observe 记录一次观测值
+func (h *Histogram) Observe(d time.Duration) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return d <= h.bounds[i] })
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// Mean 返回平均观测值，没有观测时返回 0
+func (h *Histogram) Mean() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// HistogramBucket 是落在一个桶内的观测次数 (非累计，即上一个上界 < 值 <= LessOrEqualMs)，LessOrEqualMs 为 -1 表示溢出桶
+type HistogramBucket struct {
+	LessOrEqualMs float64 `json:"le_ms"`
+	Count         int64   `json:"count"`
+}
+
+// HistogramSnapshot 是直方图在某一时刻的值 (时长均以毫秒表示)
+type HistogramSnapshot struct {
+	Count   int64             `json:"count"`
+	MeanMs  float64           `json:"mean_ms"`
+	MaxMs   float64           `json:"max_ms"`
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// Snapshot 返回直方图的当前值
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := HistogramSnapshot{
+		Count:   h.count,
+		MaxMs:   toMs(h.max),
+		Buckets: make([]HistogramBucket, 0, len(h.counts)),
+	}
+	if h.count > 0 {
+		s.MeanMs = toMs(h.sum) / float64(h.count)
+	}
+	for i, c := range h.counts {
+		le := -1.0
+		if i < len(h.bounds) {
+			le = toMs(h.bounds[i])
+		}
+		s.Buckets = append(s.Buckets, HistogramBucket{LessOrEqualMs: le, Count: c})
+	}
+	return s
+}
+
+func toMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
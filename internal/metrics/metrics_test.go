@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	h := newHistogram([]time.Duration{10 * time.Millisecond, time.Millisecond})
+	for _, d := range []time.Duration{
+		500 * time.Microsecond, // <= 1ms
+		time.Millisecond,       // 上界属于该桶
+		5 * time.Millisecond,   // <= 10ms
+		20 * time.Millisecond,  // 溢出桶
+	} {
+		h.Observe(d)
+	}
+
+	s := h.Snapshot()
+	assert.EqualValues(t, 4, s.Count)
+	assert.InDelta(t, 6.625, s.MeanMs, 1e-9)
+	assert.Equal(t, 20.0, s.MaxMs)
+	assert.Equal(t, []HistogramBucket{
+		{LessOrEqualMs: 1, Count: 2},
+		{LessOrEqualMs: 10, Count: 1},
+		{LessOrEqualMs: -1, Count: 1},
+	}, s.Buckets)
+	assert.Equal(t, 6625*time.Microsecond, h.Mean())
+}
+
+func TestRegistrySnapshot(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("requests")
+	c.Add(2)
+	r.Counter("requests").Inc()
+	r.Histogram("latency", DefaultLatencyBounds).Observe(3 * time.Millisecond)
+	r.GaugeFunc("depth", func() interface{} { return 7 })
+
+	snapshot := r.Snapshot()
+	assert.EqualValues(t, 3, snapshot["requests"])
+	assert.Equal(t, 7, snapshot["depth"])
+	latency, ok := snapshot["latency"].(HistogramSnapshot)
+	require.True(t, ok)
+	assert.EqualValues(t, 1, latency.Count)
+	assert.EqualValues(t, 1, latency.Buckets[0].Count)
+	assert.Len(t, latency.Buckets, len(DefaultLatencyBounds)+1)
+
+	// 同名注册返回同一个指标
+	assert.Same(t, c, r.Counter("requests"))
+}
@@ -18,13 +18,41 @@ type Position struct {
 	Lng float64 `json:"lng"`
 }
 
+// WebSocket 推送的消息类型，客户端据此区分 TelemetryUpdate 和 PresenceUpdate
+const (
+	UpdateTypeTelemetry = "telemetry"
+	UpdateTypePresence  = "presence"
+)
+
 // 基于 design.md 3.3.2 的 WebSocket 遥测 (云端 -> 客户端)
 // 注意：这个结构在发送给客户端时，由云端动态添加了 vehicle_id
 type TelemetryUpdate struct {
+	Type      string `json:"type"` // 恒为 UpdateTypeTelemetry
 	VehicleID string `json:"vehicle_id"`
 	VehicleStatus
 }
 
+// 车辆在线状态
+const (
+	PresenceOnline  = "online"  // 最近仍在上报状态
+	PresenceStale   = "stale"   // 上报中断了一段时间，可能只是网络抖动
+	PresenceOffline = "offline" // 长时间没有上报，或 MQTT 遗嘱消息宣告离线
+)
+
+// VehiclePresence 是车辆的在线状态，LastSeenAt 为服务器最后一次收到该车辆消息的时间
+type VehiclePresence struct {
+	State      string     `json:"state"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+}
+
+// PresenceUpdate 是车辆在线状态变化时通过 WebSocket 推送的消息。
+// 在线状态放在 presence 字段中，避免与 TelemetryUpdate 的 state (车辆运行状态) 混淆。
+type PresenceUpdate struct {
+	Type      string          `json:"type"` // 恒为 UpdateTypePresence
+	VehicleID string          `json:"vehicle_id"`
+	Presence  VehiclePresence `json:"presence"`
+}
+
 // 基于 design.md 3.1.2 的宏观指令 (云端 -> 边缘端)
 type Command struct {
 	CommandID string `json:"command_id"`
@@ -34,16 +62,81 @@ type Command struct {
 
 // 基于 design.md 3.2.1 的决策请求元数据
 type DecisionRequestMetadata struct {
-	VehicleID string `json:"vehicle_id"`
-	Timestamp int64  `json:"timestamp"`
+	VehicleID string    `json:"vehicle_id"`
+	Timestamp int64     `json:"timestamp"`
+	Position  *Position `json:"position,omitempty"` // (可选) 边缘端拍摄时的定位
 }
 
 // 基于 design.md 3.2.1 的决策响应
 type DecisionResult struct {
-	ImageID    string  `json:"image_id"`
-	Action     string  `json:"action"`
-	Confidence float64 `json:"confidence"`
-	Reason     string  `json:"reason,omitempty"`
+	ImageID      string  `json:"image_id"`
+	Action       string  `json:"action"`
+	Confidence   float64 `json:"confidence"`
+	Reason       string  `json:"reason,omitempty"`
+	Class        string  `json:"class,omitempty"`         // 模型输出的类别标签
+	ModelVersion string  `json:"model_version,omitempty"` // 产出该决策的模型版本
+	Deduplicated bool    `json:"deduplicated,omitempty"`  // 为 true 时表示返回的是同一车辆近期的相似决策
+
+	Detections []BoundingBox `json:"detections,omitempty"` // 模型检测到的目标框 (像素坐标)
+}
+
+// DecisionLogEntry 是写入 'decision_logs' 表的一条新记录
+type DecisionLogEntry struct {
+	Result       *DecisionResult         `json:"result"`
+	ImageKey     string                  `json:"image_key"` // decisions Bucket 中的对象名，上传失败时为空
+	ThumbnailKey string                  `json:"thumbnail_key,omitempty"`
+	PreviewKey   string                  `json:"preview_key,omitempty"`
+	Metadata     DecisionRequestMetadata `json:"metadata"`
+	ImageHash    *int64                  `json:"image_hash,omitempty"` // 图片的感知哈希 (按位存储为 BIGINT)
+	Location     *DecisionLocation       `json:"location,omitempty"`   // 决策发生的位置，无法确定时为 nil
+}
+
+// 决策位置的来源
+const (
+	LocationSourceMetadata  = "metadata"  // 边缘端在请求元数据中上报
+	LocationSourceTelemetry = "telemetry" // 由车辆遥测轨迹插值得到
+)
+
+// DecisionLocation 是决策发生的位置及其来源
+type DecisionLocation struct {
+	Position
+	Source string `json:"source"`
+}
+
+// DecisionPoint 是带位置的一条决策，用于热点聚类
+type DecisionPoint struct {
+	ID        string    `json:"id"`
+	VehicleID string    `json:"vehicle_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	Class     string    `json:"class,omitempty"`
+	Position
+}
+
+// RecentDecision 是用于去重比对的近期决策
+type RecentDecision struct {
+	ID        string
+	ImageHash int64
+	Decision  *DecisionResult
+	Timestamp time.Time
+}
+
+// 指令的发布状态
+const (
+	CommandPublished = "published"
+	CommandFailed    = "failed"
+)
+
+// CommandLog 对应于 'command_logs' 表，记录一次下发给车辆的指令
+type CommandLog struct {
+	ID        string    `json:"id"`
+	VehicleID string    `json:"vehicle_id"`
+	Command   string    `json:"command"`
+	TaskID    string    `json:"task_id,omitempty"`
+	IssuedBy  string    `json:"issued_by,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // 基于 design.md 3.3.1 的客户端指令请求
@@ -57,14 +150,23 @@ type User struct {
 	ID             string `json:"id"`
 	Username       string `json:"username"`
 	HashedPassword string `json:"-"` // (密码哈希不应被序列化到 JSON 中)
+	Role           string `json:"role"`
 }
 
+// 用户角色
+const (
+	RoleAdmin    = "admin"    // 可访问所有车辆并管理授权
+	RoleOperator = "operator" // 只能访问 'user_vehicle_access' 中授权的车辆
+)
+
 // Vehicle 对应于数据库中的 'vehicles' 表
 type Vehicle struct {
 	ID            string         `json:"id"`
 	Name          string         `json:"name"`
 	Model         string         `json:"model"`
 	CurrentStatus *VehicleStatus `json:"current_status"` // 使用指针以允许 null
+
+	Presence *VehiclePresence `json:"presence,omitempty"` // 由 PresenceService 在响应时填充
 }
 
 // VehicleTelemetry 对应于 'vehicle_telemetry' 表，用于存储历史轨迹点
@@ -83,7 +185,266 @@ type DecisionLog struct {
 	ID              string          `json:"id"`
 	VehicleID       string          `json:"vehicle_id"`
 	Timestamp       time.Time       `json:"timestamp"`
+	ImageKey        string          `json:"-"` // 数据库中保存的是对象名，URL 在响应时生成
+	ThumbnailKey    string          `json:"-"`
+	PreviewKey      string          `json:"-"`
 	ImageURL        string          `json:"image_url"`
+	ThumbnailURL    string          `json:"thumbnail_url,omitempty"` // 列表展示用的小图，生成失败或历史数据时为空
+	PreviewURL      string          `json:"preview_url,omitempty"`   // 详情展示用的中等尺寸预览图
 	ServerDecision  json.RawMessage `json:"server_decision"`
 	RequestMetadata json.RawMessage `json:"request_metadata"`
 }
+
+// ShadowEvaluation 对应于 'shadow_evaluations' 表，记录候选模型在影子模式下的一次对比结果
+type ShadowEvaluation struct {
+	ID              int64           `json:"id"`
+	DecisionID      string          `json:"decision_id"`
+	VehicleID       string          `json:"vehicle_id"`
+	ActiveModel     string          `json:"active_model"`
+	CandidateModel  string          `json:"candidate_model"`
+	ActiveResult    *DecisionResult `json:"active_result"`
+	CandidateResult *DecisionResult `json:"candidate_result,omitempty"` // 候选模型推理失败时为 null
+	CandidateError  string          `json:"candidate_error,omitempty"`
+	Agreed          bool            `json:"agreed"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+// ConfidenceDistribution 描述一组置信度的分布，Buckets 按 0.1 为步长划分 [0, 1]
+type ConfidenceDistribution struct {
+	Count   int     `json:"count"`
+	Mean    float64 `json:"mean"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Buckets [10]int `json:"buckets"`
+}
+
+// ShadowPairReport 汇总一对 (生效模型, 候选模型) 的影子评估结果
+type ShadowPairReport struct {
+	ActiveModel         string                 `json:"active_model"`
+	CandidateModel      string                 `json:"candidate_model"`
+	Total               int                    `json:"total"`
+	Agreements          int                    `json:"agreements"`
+	AgreementRate       float64                `json:"agreement_rate"`
+	CandidateErrors     int                    `json:"candidate_errors"`
+	ActiveConfidence    ConfidenceDistribution `json:"active_confidence"`
+	CandidateConfidence ConfidenceDistribution `json:"candidate_confidence"`
+	Disagreements       []*ShadowEvaluation    `json:"disagreements"` // 最近的分歧样本
+}
+
+// BoundingBox 以像素坐标描述图片中的一个目标框 (X, Y 为左上角)
+type BoundingBox struct {
+	Class  string  `json:"class"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// DecisionLabel 对应于 'decision_labels' 表，是操作员为一条决策标注的真实结果
+type DecisionLabel struct {
+	DecisionID     string        `json:"decision_id"`
+	CorrectAction  string        `json:"correct_action"`
+	CorrectedClass string        `json:"corrected_class,omitempty"` // 为空表示模型给出的类别正确
+	BoundingBoxes  []BoundingBox `json:"bounding_boxes"`
+	Notes          string        `json:"notes,omitempty"`
+	LabelledBy     string        `json:"labelled_by"`
+	LabelledAt     time.Time     `json:"labelled_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// LabelDecisionRequest 是客户端提交标注的请求体
+type LabelDecisionRequest struct {
+	CorrectAction  string        `json:"correct_action" binding:"required"`
+	CorrectedClass string        `json:"corrected_class"`
+	BoundingBoxes  []BoundingBox `json:"bounding_boxes"`
+	Notes          string        `json:"notes"`
+}
+
+// LabelledDecision 将模型的决策与其人工标注放在一起，用于评估模型表现
+type LabelledDecision struct {
+	Decision *DecisionResult
+	Label    *DecisionLabel
+}
+
+// LabelMetrics 是某一取值 (动作或类别) 的精确率与召回率
+type LabelMetrics struct {
+	Label          string  `json:"label"`
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+}
+
+// ModelMetrics 汇总一个模型版本在已标注决策上的表现
+type ModelMetrics struct {
+	ModelVersion   string          `json:"model_version"`
+	Labelled       int             `json:"labelled"`
+	ActionAccuracy float64         `json:"action_accuracy"`
+	Actions        []*LabelMetrics `json:"actions"`
+	Classes        []*LabelMetrics `json:"classes"`
+}
+
+// DatasetExportFilter 描述从决策日志中挑选训练样本的条件
+type DatasetExportFilter struct {
+	StartTime    *time.Time `json:"start_time,omitempty"`
+	EndTime      *time.Time `json:"end_time,omitempty"`
+	VehicleID    string     `json:"vehicle_id,omitempty"`
+	LabelledOnly bool       `json:"labelled_only"`
+	Class        string     `json:"class,omitempty"` // 匹配更正类别，未更正时匹配模型类别
+	// IncludeBackground 为 true 时将未标注的决策作为背景样本 (空标注) 写入，默认跳过，
+	// 以免把未标注的目标当作负样本
+	IncludeBackground bool `json:"include_background"`
+}
+
+// 数据集导出任务的状态
+const (
+	DatasetExportPending   = "pending"
+	DatasetExportRunning   = "running"
+	DatasetExportCompleted = "completed"
+	DatasetExportFailed    = "failed"
+)
+
+// DatasetExport 对应于 'dataset_exports' 表，记录一次数据集导出任务
+type DatasetExport struct {
+	ID          string              `json:"id"`
+	Status      string              `json:"status"`
+	Filter      DatasetExportFilter `json:"filter"`
+	ObjectName  string              `json:"-"`
+	DownloadURL string              `json:"download_url,omitempty"` // 仅在完成后生成，短期有效
+	ImageCount  int                 `json:"image_count"`
+	Error       string              `json:"error,omitempty"`
+	CreatedBy   string              `json:"created_by"`
+	CreatedAt   time.Time           `json:"created_at"`
+	CompletedAt *time.Time          `json:"completed_at,omitempty"`
+}
+
+// DatasetRecord 是导出时的一条样本：决策日志及其标注 (可能为空)
+type DatasetRecord struct {
+	Log   *DecisionLog
+	Label *DecisionLabel
+}
+
+// TrashCategory 对应于 'trash_categories' 表，是受管理的垃圾分类体系中的一个类别
+type TrashCategory struct {
+	ID                   string    `json:"id"`
+	NameZh               string    `json:"name_zh"`
+	NameEn               string    `json:"name_en"`
+	Recyclable           bool      `json:"recyclable"`
+	EstimatedWeightGrams float64   `json:"estimated_weight_grams"` // 单件垃圾的估计质量，用于估算收集量
+	ModelClasses         []string  `json:"model_classes"`          // 映射到该类别的模型输出类别 ('trash_class_mappings')
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+// TrashCategoryRequest 是创建或更新垃圾类别的请求体
+type TrashCategoryRequest struct {
+	NameZh               string   `json:"name_zh" binding:"required"`
+	NameEn               string   `json:"name_en" binding:"required"`
+	Recyclable           bool     `json:"recyclable"`
+	EstimatedWeightGrams float64  `json:"estimated_weight_grams" binding:"gte=0"`
+	ModelClasses         []string `json:"model_classes"`
+}
+
+// CreateTrashCategoryRequest 是创建垃圾类别的请求体
+type CreateTrashCategoryRequest struct {
+	ID string `json:"id" binding:"required"`
+	TrashCategoryRequest
+}
+
+// CollectionRecord 是一条被拾取的决策及其映射到的垃圾类别 (未映射时 CategoryID 为空)
+type CollectionRecord struct {
+	VehicleID            string
+	Timestamp            time.Time
+	Class                string
+	CategoryID           string
+	Recyclable           bool
+	EstimatedWeightGrams float64
+	Location             *Position
+}
+
+// CollectionStat 是按某一维度分组的收集统计
+type CollectionStat struct {
+	Key             string         `json:"key"`
+	Count           int            `json:"count"`
+	RecyclableCount int            `json:"recyclable_count"`
+	EstimatedMassKg float64        `json:"estimated_mass_kg"`
+	Categories      map[string]int `json:"categories"` // 类别 ID -> 数量，未映射的类别记为 "unclassified"
+}
+
+// TelemetryRollup 对应于 'telemetry_rollups_hourly' 表，是一辆车一小时内原始遥测的汇总
+type TelemetryRollup struct {
+	VehicleID    string    `json:"vehicle_id"`
+	BucketStart  time.Time `json:"bucket_start"`
+	SampleCount  int       `json:"sample_count"`
+	AvgLatitude  float64   `json:"avg_latitude"`
+	AvgLongitude float64   `json:"avg_longitude"`
+	AvgBattery   float64   `json:"avg_battery"`
+	MinBattery   float64   `json:"min_battery"`
+	MaxBattery   float64   `json:"max_battery"`
+	LastState    string    `json:"last_state"`
+	LastSeenAt   time.Time `json:"last_seen_at"`
+}
+
+// DecisionImageKeys 是一条决策在对象存储中的全部图片
+type DecisionImageKeys struct {
+	DecisionID   string
+	ImageKey     string
+	ThumbnailKey string
+	PreviewKey   string
+}
+
+// OutboxMessage 对应于 'outbox' 表，是与领域数据在同一事务中写入的一项后台工作
+type OutboxMessage struct {
+	ID          int64
+	Kind        string
+	Payload     json.RawMessage
+	Attempts    int
+	AvailableAt time.Time
+	LastError   string
+	DeadAt      *time.Time
+	CreatedAt   time.Time
+}
+
+// NewOutboxMessage 将 payload 编码为 JSON，创建一条待写入发件箱的消息
+func NewOutboxMessage(kind string, payload any) (*OutboxMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxMessage{Kind: kind, Payload: data}, nil
+}
+
+// Decode 将消息的 Payload 解码到 v
+func (m *OutboxMessage) Decode(v any) error {
+	return json.Unmarshal(m.Payload, v)
+}
+
+// 车辆状态枚举 (design.md 3.1.1)
+const (
+	VehicleStateIdle                 = "IDLE"
+	VehicleStatePlanning             = "PLANNING"
+	VehicleStateNavigating           = "NAVIGATING"
+	VehicleStateOperating            = "OPERATING"
+	VehicleStateAwaitingConfirmation = "AWAITING_CONFIRMATION"
+	VehicleStateError                = "ERROR"
+)
+
+// TelemetryReject 对应于 'telemetry_rejects' 表，是一条未通过校验而被隔离的状态上报
+type TelemetryReject struct {
+	ID         int64     `json:"id"`
+	VehicleID  string    `json:"vehicle_id"`
+	Topic      string    `json:"topic"`
+	Reason     string    `json:"reason"` // 校验错误码，如 battery_out_of_range
+	Detail     string    `json:"detail"`
+	Payload    string    `json:"payload"` // 原始 Payload (过长时被截断)
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// TelemetryRejectCount 是某辆车某一原因的隔离次数
+type TelemetryRejectCount struct {
+	VehicleID      string    `json:"vehicle_id"`
+	Reason         string    `json:"reason"`
+	Count          int64     `json:"count"`
+	LastReceivedAt time.Time `json:"last_received_at"`
+}
@@ -0,0 +1,482 @@
+// Package queue 实现了一个基于本地段文件的持久化任务队列。
+//
+// 任务以带类型的信封保存，每次写入都会 fsync；投递语义为至少一次：
+// 任务在 Handler 返回成功 (Ack) 前一直保留在磁盘上，进程崩溃后会重新投递，
+// 因此 Handler 必须是幂等的。失败的任务按指数退避重试，超过次数上限后进入死信。
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrTaskNotFound 表示任务不存在 (可能已被确认或清除)
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrQueueClosed 表示队列已关闭
+	ErrQueueClosed = errors.New("queue is closed")
+	// ErrTaskInFlight 表示任务正在执行，不能重新排队或清除
+	ErrTaskInFlight = errors.New("task is being processed")
+)
+
+// Options 是队列的配置，零值字段使用默认值
+type Options struct {
+	MaxAttempts    int                              // 进入死信前的最大失败次数，默认 10
+	Backoff        func(attempts int) time.Duration // 第 attempts 次失败后的重试间隔，默认指数退避
+	SegmentSize    int64                            // 段文件超过该大小后切换到新段，默认 4 MiB
+	CompactGarbage int                              // 已失效的记录超过该数量 (且多于存活任务) 时压缩，默认 1000
+}
+
+const (
+	defaultMaxAttempts    = 10
+	defaultSegmentSize    = 4 << 20
+	defaultCompactGarbage = 1000
+	backoffBase           = 5 * time.Second
+	backoffMax            = 10 * time.Minute
+)
+
+// DefaultBackoff 从 5 秒开始每次翻倍，最长 10 分钟
+func DefaultBackoff(attempts int) time.Duration {
+	d := backoffBase
+	for i := 1; i < attempts && d < backoffMax; i++ {
+		d *= 2
+	}
+	return min(d, backoffMax)
+}
+
+// Queue 是持久化任务队列，可被多个 goroutine 并发使用
+type Queue struct {
+	dir  string
+	opts Options
+
+	mu       sync.Mutex
+	tasks    map[string]*Task
+	inflight map[string]bool // 已投递、尚未 Ack/Nack 的任务 (仅在内存中)
+	writer   *segmentWriter
+	garbage  int // 自上次压缩以来被覆盖或删除的记录数
+	closed   bool
+
+	handlers map[string]Handler
+	notify   chan struct{} // 有新任务可执行时唤醒 worker
+}
+
+// Open 打开 (或创建) dir 中的队列，并通过重放段文件恢复状态
+func Open(dir string, opts Options) (*Queue, error) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if opts.CompactGarbage <= 0 {
+		opts.CompactGarbage = defaultCompactGarbage
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		dir:      dir,
+		opts:     opts,
+		tasks:    make(map[string]*Task),
+		inflight: make(map[string]bool),
+		handlers: make(map[string]Handler),
+		notify:   make(chan struct{}, 1),
+	}
+
+	seqs, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range seqs {
+		if _, err := readSegment(filepath.Join(dir, segmentName(seq)), q.apply); err != nil {
+			return nil, fmt.Errorf("failed to read queue segment %d: %w", seq, err)
+		}
+	}
+
+	// 启动时总是压缩一次：丢弃旧记录，并保证不会在崩溃时写了一半的行后继续追加
+	lastSeq := 0
+	if len(seqs) > 0 {
+		lastSeq = seqs[len(seqs)-1]
+	}
+	if err := q.compactLocked(lastSeq + 1); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// apply 将一条记录应用到内存状态 (仅在 Open 时调用)
+func (q *Queue) apply(rec record) {
+	switch rec.Op {
+	case opPut:
+		q.tasks[rec.Task.ID] = rec.Task
+	case opDel:
+		delete(q.tasks, rec.ID)
+	}
+}
+
+// Enqueue 将一个任务持久化后返回，payload 会被序列化为 JSON
+func (q *Queue) Enqueue(kind string, payload interface{}) (*Task, error) {
+	return q.Import(kind, payload, StatePending, 0, "")
+}
+
+// Import 以给定的状态和已失败次数持久化一个任务，用于迁移其他队列中的任务。
+// lastError 非空时记入失败记录。
+func (q *Queue) Import(kind string, payload interface{}, state TaskState, attempts int, lastError string) (*Task, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	task := &Task{
+		ID:            uuid.NewString(),
+		Kind:          kind,
+		State:         state,
+		Attempts:      attempts,
+		NextAttemptAt: now,
+		EnqueuedAt:    now,
+		Payload:       data,
+	}
+	if lastError != "" {
+		task.recordError(now, errors.New(lastError))
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.putLocked(task); err != nil {
+		return nil, err
+	}
+	q.wake()
+	return task.clone(), nil
+}
+
+// Dequeue 返回一个到期的待执行任务并将其标记为执行中，没有到期任务时返回 nil。
+// 调用方必须随后调用 Ack 或 Nack。
+func (q *Queue) Dequeue(now time.Time) *Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var next *Task
+	for id, t := range q.tasks {
+		if t.State != StatePending || q.inflight[id] || t.NextAttemptAt.After(now) {
+			continue
+		}
+		if next == nil || t.NextAttemptAt.Before(next.NextAttemptAt) {
+			next = t
+		}
+	}
+	if next == nil {
+		return nil
+	}
+	q.inflight[next.ID] = true
+	return next.clone()
+}
+
+// Ack 确认任务已完成并将其从队列中删除
+func (q *Queue) Ack(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, id)
+	if _, ok := q.tasks[id]; !ok {
+		return ErrTaskNotFound
+	}
+	return q.deleteLocked(id)
+}
+
+// Nack 记录一次失败：未达到次数上限时按退避时间重新排队，否则进入死信
+func (q *Queue) Nack(id string, cause error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, id)
+	t, ok := q.tasks[id]
+	if !ok {
+		return ErrTaskNotFound
+	}
+
+	now := time.Now().UTC()
+	updated := t.clone()
+	updated.Attempts++
+	updated.recordError(now, cause)
+	if updated.Attempts >= q.opts.MaxAttempts {
+		updated.State = StateDead
+	} else {
+		updated.NextAttemptAt = now.Add(q.opts.Backoff(updated.Attempts))
+	}
+	return q.putLocked(updated)
+}
+
+// Release 将执行中的任务放回队列而不计入失败次数 (例如停机时)
+func (q *Queue) Release(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, id)
+	q.wake()
+}
+
+// Get 返回任务的副本
+func (q *Queue) Get(id string) (*Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tasks[id]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	return t.clone(), nil
+}
+
+// List 返回处于 state 的任务 (state 为空时返回全部)，按入队时间排序
+func (q *Queue) List(state TaskState) []*Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var out []*Task
+	for _, t := range q.tasks {
+		if state == "" || t.State == state {
+			out = append(out, t.clone())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].EnqueuedAt.Equal(out[j].EnqueuedAt) {
+			return out[i].EnqueuedAt.Before(out[j].EnqueuedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// putLocked 持久化任务的新状态后再更新内存
+func (q *Queue) putLocked(task *Task) error {
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if err := q.appendLocked(record{Op: opPut, Task: task}); err != nil {
+		return err
+	}
+	if _, existed := q.tasks[task.ID]; existed {
+		q.garbage++
+	}
+	q.tasks[task.ID] = task
+	q.maybeCompactLocked()
+	return nil
+}
+
+func (q *Queue) deleteLocked(id string) error {
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if err := q.appendLocked(record{Op: opDel, ID: id}); err != nil {
+		return err
+	}
+	delete(q.tasks, id)
+	q.garbage += 2 // 被删除任务的 put 和这条 del 都已失效
+	q.maybeCompactLocked()
+	return nil
+}
+
+func (q *Queue) appendLocked(rec record) error {
+	if q.writer.size >= q.opts.SegmentSize {
+		next, err := openSegmentWriter(q.dir, q.writer.seq+1)
+		if err != nil {
+			return err
+		}
+		q.writer.close()
+		q.writer = next
+	}
+	return q.writer.write(rec)
+}
+
+// maybeCompactLocked 在失效记录足够多时压缩。压缩失败不影响已持久化的写入，只记录日志，下次写入时重试。
+func (q *Queue) maybeCompactLocked() {
+	if q.garbage < q.opts.CompactGarbage || q.garbage < len(q.tasks) {
+		return
+	}
+	if err := q.compactLocked(q.writer.seq + 1); err != nil {
+		log.Printf("level=error msg=\"task queue: compaction failed\" dir=%s error=\"%v\"", q.dir, err)
+	}
+}
+
+// compactLocked 将所有存活任务写入新段 seq，然后删除之前的段
+func (q *Queue) compactLocked(seq int) error {
+	w, err := openSegmentWriter(q.dir, seq)
+	if err != nil {
+		return err
+	}
+	recs := make([]record, 0, len(q.tasks))
+	for _, t := range q.tasks {
+		recs = append(recs, record{Op: opPut, Task: t})
+	}
+	if len(recs) > 0 {
+		if err := w.write(recs...); err != nil {
+			w.close()
+			return err
+		}
+	}
+
+	if q.writer != nil {
+		q.writer.close()
+	}
+	q.writer = w
+	q.garbage = 0
+
+	seqs, err := listSegments(q.dir)
+	if err != nil {
+		return err
+	}
+	for _, old := range seqs {
+		if old < seq {
+			if err := os.Remove(filepath.Join(q.dir, segmentName(old))); err != nil {
+				return err
+			}
+		}
+	}
+	return syncDir(q.dir)
+}
+
+func (q *Queue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Close 关闭当前段文件，之后的写入返回 ErrQueueClosed
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	return q.writer.close()
+}
+
+// Stats 返回各状态的任务数
+func (q *Queue) Stats() map[TaskState]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := map[TaskState]int{StatePending: 0, StateDead: 0}
+	for _, t := range q.tasks {
+		stats[t.State]++
+	}
+	return stats
+}
+
+// waitCh 返回 worker 等待新任务的通道
+func (q *Queue) waitCh() <-chan struct{} {
+	return q.notify
+}
+
+// Filter 选择一组任务，空字段表示不限
+type Filter struct {
+	State TaskState
+	Kind  string
+}
+
+func (f Filter) match(t *Task) bool {
+	return (f.State == "" || t.State == f.State) && (f.Kind == "" || t.Kind == f.Kind)
+}
+
+// Find 返回匹配 filter 的任务，按入队时间排序
+func (q *Queue) Find(filter Filter) []*Task {
+	var out []*Task
+	for _, t := range q.List(filter.State) {
+		if filter.match(t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Requeue 将任务 (通常是死信) 重新排队立即执行，失败次数清零，错误历史保留。
+// 正在执行的任务返回 ErrTaskInFlight。
+func (q *Queue) Requeue(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tasks[id]
+	if !ok {
+		return ErrTaskNotFound
+	}
+	if q.inflight[id] {
+		return ErrTaskInFlight
+	}
+	if err := q.requeueLocked(t); err != nil {
+		return err
+	}
+	q.wake()
+	return nil
+}
+
+// RequeueMatching 重新排队所有匹配 filter 的任务 (跳过正在执行的任务)，返回处理的数量
+func (q *Queue) RequeueMatching(filter Filter) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for id, t := range q.tasks {
+		if !filter.match(t) || q.inflight[id] {
+			continue
+		}
+		if err := q.requeueLocked(t); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if n > 0 {
+		q.wake()
+	}
+	return n, nil
+}
+
+func (q *Queue) requeueLocked(t *Task) error {
+	updated := t.clone()
+	updated.State = StatePending
+	updated.Attempts = 0
+	updated.NextAttemptAt = time.Now().UTC()
+	return q.putLocked(updated)
+}
+
+// Purge 删除任务 (无论其状态)。正在执行的任务返回 ErrTaskInFlight，
+// 否则 Handler 仍在使用的外部数据 (如暂存的图片) 可能被调用方清理掉。
+func (q *Queue) Purge(id string) (*Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tasks[id]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	if q.inflight[id] {
+		return nil, ErrTaskInFlight
+	}
+	if err := q.deleteLocked(id); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// PurgeMatching 删除所有匹配 filter 的任务 (跳过正在执行的任务)，返回被删除的任务
+func (q *Queue) PurgeMatching(filter Filter) ([]*Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var purged []*Task
+	for id, t := range q.tasks {
+		if !filter.match(t) || q.inflight[id] {
+			continue
+		}
+		if err := q.deleteLocked(id); err != nil {
+			return purged, err
+		}
+		purged = append(purged, t)
+	}
+	return purged, nil
+}
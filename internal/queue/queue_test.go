@@ -0,0 +1,196 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueDurability(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{MaxAttempts: 2, Backoff: func(int) time.Duration { return time.Hour }, CompactGarbage: 1}
+
+	q, err := Open(dir, opts)
+	require.NoError(t, err)
+	a, err := q.Enqueue("email", map[string]string{"to": "a"})
+	require.NoError(t, err)
+	b, err := q.Enqueue("email", map[string]string{"to": "b"})
+	require.NoError(t, err)
+
+	// 投递中的任务不会被重复取出
+	first := q.Dequeue(time.Now())
+	require.NotNil(t, first)
+	second := q.Dequeue(time.Now())
+	require.NotNil(t, second)
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.Nil(t, q.Dequeue(time.Now()))
+
+	require.NoError(t, q.Ack(a.ID))
+	require.NoError(t, q.Nack(b.ID, errors.New("smtp down")))
+	assert.Nil(t, q.Dequeue(time.Now()), "nacked task waits for its backoff")
+
+	retry := q.Dequeue(time.Now().Add(2 * time.Hour))
+	require.NotNil(t, retry)
+	assert.Equal(t, 1, retry.Attempts)
+	require.NoError(t, q.Nack(b.ID, errors.New("still down")))
+	require.NoError(t, q.Close())
+
+	// 重新打开后状态保持：a 已确认，b 进入死信并保留错误历史
+	q, err = Open(dir, opts)
+	require.NoError(t, err)
+	defer q.Close()
+	_, err = q.Get(a.ID)
+	assert.ErrorIs(t, err, ErrTaskNotFound)
+	dead := q.List(StateDead)
+	require.Len(t, dead, 1)
+	assert.Equal(t, b.ID, dead[0].ID)
+	assert.Equal(t, "still down", dead[0].LastError())
+	assert.Len(t, dead[0].Errors, 2)
+
+	var payload map[string]string
+	require.NoError(t, dead[0].Decode(&payload))
+	assert.Equal(t, "b", payload["to"])
+
+	// 压缩后只剩一个段
+	seqs, err := listSegments(dir)
+	require.NoError(t, err)
+	assert.Len(t, seqs, 1)
+}
+
+func TestQueueSkipsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, Options{})
+	require.NoError(t, err)
+	task, err := q.Enqueue("k", "payload")
+	require.NoError(t, err)
+	seq := q.writer.seq
+	require.NoError(t, q.Close())
+
+	// 模拟崩溃时写了一半的记录
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(seq)), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"put","task":{"id":"tor`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	q, err = Open(dir, Options{})
+	require.NoError(t, err)
+	defer q.Close()
+	tasks := q.List("")
+	require.Len(t, tasks, 1)
+	assert.Equal(t, task.ID, tasks[0].ID)
+
+	_, err = q.Enqueue("k", "after")
+	require.NoError(t, err)
+	assert.Len(t, q.List(StatePending), 2)
+}
+
+func TestQueueWorkers(t *testing.T) {
+	q, err := Open(t.TempDir(), Options{MaxAttempts: 1})
+	require.NoError(t, err)
+	defer q.Close()
+
+	done := make(chan string, 1)
+	q.Register("ok", func(ctx context.Context, task *Task) error {
+		var s string
+		require.NoError(t, task.Decode(&s))
+		done <- s
+		return nil
+	})
+	q.Register("boom", func(ctx context.Context, task *Task) error { panic("boom") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := q.Start(ctx, 2)
+
+	_, err = q.Enqueue("ok", "hello")
+	require.NoError(t, err)
+	_, err = q.Enqueue("boom", nil)
+	require.NoError(t, err)
+	_, err = q.Enqueue("unknown", nil)
+	require.NoError(t, err)
+
+	select {
+	case s := <-done:
+		assert.Equal(t, "hello", s)
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not delivered")
+	}
+	require.Eventually(t, func() bool { return len(q.List(StateDead)) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, q.List(StatePending))
+
+	cancel()
+	wg.Wait()
+}
+
+func TestQueueRequeueAndPurge(t *testing.T) {
+	q, err := Open(t.TempDir(), Options{MaxAttempts: 1})
+	require.NoError(t, err)
+	defer q.Close()
+
+	var ids []string
+	for _, kind := range []string{"a", "a", "b"} {
+		task, err := q.Enqueue(kind, nil)
+		require.NoError(t, err)
+		require.NoError(t, q.Nack(task.ID, errors.New("failed")))
+		ids = append(ids, task.ID)
+	}
+	assert.Len(t, q.Find(Filter{State: StateDead}), 3)
+
+	require.NoError(t, q.Requeue(ids[0]))
+	requeued, err := q.Get(ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, StatePending, requeued.State)
+	assert.Zero(t, requeued.Attempts)
+	assert.Equal(t, "failed", requeued.LastError(), "error history survives a requeue")
+
+	n, err := q.RequeueMatching(Filter{State: StateDead, Kind: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	purged, err := q.PurgeMatching(Filter{State: StateDead})
+	require.NoError(t, err)
+	require.Len(t, purged, 1)
+	assert.Equal(t, ids[2], purged[0].ID)
+
+	_, err = q.Purge(ids[2])
+	assert.ErrorIs(t, err, ErrTaskNotFound)
+	assert.Equal(t, map[TaskState]int{StatePending: 2, StateDead: 0}, q.Stats())
+
+	// 正在执行的任务不能被清除或重新排队
+	running := q.Dequeue(time.Now())
+	require.NotNil(t, running)
+	_, err = q.Purge(running.ID)
+	assert.ErrorIs(t, err, ErrTaskInFlight)
+	assert.ErrorIs(t, q.Requeue(running.ID), ErrTaskInFlight)
+	purged, err = q.PurgeMatching(Filter{State: StatePending})
+	require.NoError(t, err)
+	require.Len(t, purged, 1)
+	assert.NotEqual(t, running.ID, purged[0].ID)
+	require.NoError(t, q.Ack(running.ID))
+}
+
+func TestQueueImport(t *testing.T) {
+	q, err := Open(t.TempDir(), Options{MaxAttempts: 3})
+	require.NoError(t, err)
+	defer q.Close()
+
+	dead, err := q.Import("email", map[string]string{"to": "a"}, StateDead, 5, "smtp down")
+	require.NoError(t, err)
+	assert.Equal(t, StateDead, dead.State)
+	assert.Equal(t, 5, dead.Attempts)
+	assert.Equal(t, "smtp down", dead.LastError())
+	assert.Nil(t, q.Dequeue(time.Now()), "dead tasks are not delivered")
+
+	pending, err := q.Import("email", map[string]string{"to": "b"}, StatePending, 1, "")
+	require.NoError(t, err)
+	got := q.Dequeue(time.Now())
+	require.NotNil(t, got)
+	assert.Equal(t, pending.ID, got.ID)
+	assert.Equal(t, 1, got.Attempts)
+}
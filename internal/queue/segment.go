@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 段文件中的每一行是一条记录：
+//
+//	{"op":"put","task":{...}}   写入或覆盖任务的完整状态 (入队、失败重试、进入死信、重新入队)
+//	{"op":"del","id":"..."}     删除任务 (确认完成、清除)
+//
+// 按段号顺序重放所有记录即可恢复队列状态。压缩只是把当前存活的任务重新 put 到一个新段，
+// 再删除旧段；重放是幂等的，因此压缩在任何一步崩溃都不会丢失或复活任务。
+const (
+	opPut = "put"
+	opDel = "del"
+
+	segmentPrefix = "segment-"
+	segmentSuffix = ".log"
+)
+
+type record struct {
+	Op   string `json:"op"`
+	Task *Task  `json:"task,omitempty"`
+	ID   string `json:"id,omitempty"`
+}
+
+func segmentName(seq int) string {
+	return fmt.Sprintf("%s%08d%s", segmentPrefix, seq, segmentSuffix)
+}
+
+// listSegments 返回目录中的段号，按升序排列
+func listSegments(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []int
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		var seq int
+		if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), "%d", &seq); err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	return seqs, nil
+}
+
+// readSegment 重放一个段文件中的记录。
+// 崩溃时最后一行可能只写了一半，无法解析的行会被跳过并记录日志。
+func readSegment(path string, apply func(record)) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	n := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var rec record
+			if jsonErr := json.Unmarshal(line, &rec); jsonErr != nil || !rec.valid() {
+				log.Printf("WARN: queue: skipping corrupt record in %s", filepath.Base(path))
+			} else {
+				apply(rec)
+				n++
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+func (r record) valid() bool {
+	switch r.Op {
+	case opPut:
+		return r.Task != nil && r.Task.ID != ""
+	case opDel:
+		return r.ID != ""
+	}
+	return false
+}
+
+// segmentWriter 追加记录到当前段，每次写入后 fsync
+type segmentWriter struct {
+	f    *os.File
+	seq  int
+	size int64
+}
+
+func openSegmentWriter(dir string, seq int) (*segmentWriter, error) {
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(seq)), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// 新建的段需要同步目录项，否则崩溃后段文件本身可能消失
+	if info.Size() == 0 {
+		if err := syncDir(dir); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return &segmentWriter{f: f, seq: seq, size: info.Size()}, nil
+}
+
+// write 写入一批记录并 fsync，返回后记录即已持久化
+func (w *segmentWriter) write(recs ...record) error {
+	var buf []byte
+	for _, rec := range recs {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	n, err := w.f.Write(buf)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+func (w *segmentWriter) close() error {
+	return w.f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TaskState 是任务在队列中的状态
+type TaskState string
+
+const (
+	// StatePending 表示任务等待 (重新) 执行
+	StatePending TaskState = "pending"
+	// StateDead 表示任务失败次数达到上限，进入死信，需人工处理
+	StateDead TaskState = "dead"
+)
+
+// maxErrorHistory 是每个任务保留的最近失败记录数
+const maxErrorHistory = 10
+
+// AttemptError 是一次执行失败的记录
+type AttemptError struct {
+	At    time.Time `json:"at"`
+	Error string    `json:"error"`
+}
+
+// Task 是队列中的任务信封，Kind 决定由哪个 Handler 处理 Payload
+type Task struct {
+	ID            string          `json:"id"`
+	Kind          string          `json:"kind"`
+	State         TaskState       `json:"state"`
+	Attempts      int             `json:"attempts"` // 已失败的次数
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	EnqueuedAt    time.Time       `json:"enqueued_at"`
+	Payload       json.RawMessage `json:"payload"`
+	Errors        []AttemptError  `json:"errors,omitempty"` // 最近的失败记录，最新的在最后
+}
+
+// Decode 将 Payload 反序列化到 v
+func (t *Task) Decode(v interface{}) error {
+	return json.Unmarshal(t.Payload, v)
+}
+
+// LastError 返回最近一次失败的原因，没有失败过时为空
+func (t *Task) LastError() string {
+	if len(t.Errors) == 0 {
+		return ""
+	}
+	return t.Errors[len(t.Errors)-1].Error
+}
+
+func (t *Task) recordError(at time.Time, err error) {
+	t.Errors = append(t.Errors, AttemptError{At: at, Error: err.Error()})
+	if len(t.Errors) > maxErrorHistory {
+		t.Errors = t.Errors[len(t.Errors)-maxErrorHistory:]
+	}
+}
+
+func (t *Task) clone() *Task {
+	c := *t
+	c.Errors = append([]AttemptError(nil), t.Errors...)
+	return &c
+}
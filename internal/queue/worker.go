@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Handler 处理一种任务，返回 nil 表示完成 (Ack)，返回错误则按退避重试 (Nack)。
+// 任务可能被重复投递，Handler 必须是幂等的。
+type Handler func(ctx context.Context, task *Task) error
+
+// errNoHandler 表示任务的类型没有注册 Handler
+var errNoHandler = errors.New("no handler registered for task kind")
+
+// pollInterval 是 worker 在没有通知时检查到期重试任务的间隔
+const pollInterval = time.Second
+
+// Register 为一种任务注册 Handler，须在 Start 之前调用
+func (q *Queue) Register(kind string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = handler
+}
+
+func (q *Queue) handler(kind string) Handler {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.handlers[kind]
+}
+
+// Start 启动 workers 个 worker 执行到期的任务，直到 ctx 被取消。
+// 返回的 WaitGroup 在所有 worker 退出后完成。
+func (q *Queue) Start(ctx context.Context, workers int) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for i := 0; i < max(1, workers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	log.Printf("INFO: Task queue started with %d workers (%d pending, %d dead)", max(1, workers), q.Stats()[StatePending], q.Stats()[StateDead])
+	return &wg
+}
+
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			task := q.Dequeue(time.Now())
+			if task == nil {
+				break
+			}
+			q.execute(ctx, task)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.waitCh():
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *Queue) execute(ctx context.Context, task *Task) {
+	handler := q.handler(task.Kind)
+	var err error
+	if handler == nil {
+		err = fmt.Errorf("%w: %s", errNoHandler, task.Kind)
+	} else {
+		err = runHandler(ctx, handler, task)
+	}
+
+	if err == nil {
+		if ackErr := q.Ack(task.ID); ackErr != nil {
+			log.Printf("level=error msg=\"task queue: ack failed\" task_id=%s kind=%s error=\"%v\"", task.ID, task.Kind, ackErr)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		// 停机导致的失败不计入失败次数
+		q.Release(task.ID)
+		return
+	}
+
+	log.Printf("level=warn msg=\"task queue: task failed\" task_id=%s kind=%s attempt=%d error=\"%v\"", task.ID, task.Kind, task.Attempts+1, err)
+	if nackErr := q.Nack(task.ID, err); nackErr != nil {
+		log.Printf("level=error msg=\"task queue: nack failed\" task_id=%s kind=%s error=\"%v\"", task.ID, task.Kind, nackErr)
+	}
+}
+
+// runHandler 执行 Handler，并将 panic 转换为错误，避免一个任务拖垮 worker
+func runHandler(ctx context.Context, handler Handler, task *Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, task)
+}
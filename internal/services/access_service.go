@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"patrol-cloud/internal/db"
+)
+
+var (
+	ErrAccessDenied   = errors.New("access to vehicle denied")
+	ErrGrantNotFound  = errors.New("vehicle access grant not found")
+	ErrUnknownGrantee = errors.New("user or vehicle does not exist")
+)
+
+// AccessService 管理用户对车辆的访问授权。
+// 管理员可访问所有车辆，操作员只能访问被授权的车辆。
+type AccessService struct {
+	repo db.Repository
+}
+
+// NewAccessService 创建一个新的 AccessService
+func NewAccessService(repo db.Repository) *AccessService {
+	return &AccessService{repo: repo}
+}
+
+// CheckVehicleAccess 在用户无权访问车辆时返回 ErrAccessDenied
+func (s *AccessService) CheckVehicleAccess(ctx context.Context, userID, vehicleID string) error {
+	ok, err := s.repo.UserCanAccessVehicle(ctx, userID, vehicleID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// VehicleFilter 返回判断用户能否访问某辆车的函数，用于过滤跨车辆的列表
+func (s *AccessService) VehicleFilter(ctx context.Context, userID string) (func(vehicleID string) bool, error) {
+	vehicleIDs, all, err := s.repo.ListAccessibleVehicleIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return func(string) bool { return true }, nil
+	}
+	allowed := make(map[string]struct{}, len(vehicleIDs))
+	for _, id := range vehicleIDs {
+		allowed[id] = struct{}{}
+	}
+	return func(vehicleID string) bool {
+		_, ok := allowed[vehicleID]
+		return ok
+	}, nil
+}
+
+// ListVehicleAccess 返回用户被授权的车辆 ID，管理员返回 all = true
+func (s *AccessService) ListVehicleAccess(ctx context.Context, userID string) ([]string, bool, error) {
+	return s.repo.ListAccessibleVehicleIDs(ctx, userID)
+}
+
+// GrantVehicleAccess 授权用户访问车辆
+func (s *AccessService) GrantVehicleAccess(ctx context.Context, userID, vehicleID string) error {
+	err := s.repo.GrantVehicleAccess(ctx, userID, vehicleID)
+	if errors.Is(err, db.ErrReferenceNotFound) {
+		return ErrUnknownGrantee
+	}
+	return err
+}
+
+// RevokeVehicleAccess 撤销授权，授权不存在时返回 ErrGrantNotFound
+func (s *AccessService) RevokeVehicleAccess(ctx context.Context, userID, vehicleID string) error {
+	removed, err := s.repo.RevokeVehicleAccess(ctx, userID, vehicleID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrGrantNotFound
+	}
+	return nil
+}
@@ -11,6 +11,7 @@ import "C"
 
 import (
 	"log"
+	"path/filepath"
 	"patrol-cloud/internal/models"
 )
 
@@ -39,12 +40,41 @@ func (s *AIService) Recognize(image []byte) (*models.DecisionResult, error) {
 	// --- 模拟实现 ---
 	// 模拟一个高置信度的 "pickup" 决策
 	result := &models.DecisionResult{
-		ImageID:    "", // DecisionService 将填充此项
-		Action:     "pickup",
-		Confidence: 0.95,
-		Reason:     "is_trash_type_A (stubbed)",
+		ImageID:      "", // DecisionService 将填充此项
+		Action:       "pickup",
+		Confidence:   0.95,
+		Reason:       "is_trash_type_A (stubbed)",
+		Class:        "trash_type_A",
+		ModelVersion: s.ModelVersion(),
 	}
 	// --- 结束模拟 ---
 
 	return result, nil
 }
+
+// RecognizeBatch 批量推理 (BatchRecognizer)
+func (s *AIService) RecognizeBatch(images [][]byte) ([]*models.DecisionResult, []error) {
+	log.Printf("INFO: (STUB) AIService.RecognizeBatch called with %d images", len(images))
+
+	// 1. 对每张图片 PreProcess，并沿 batch 维度堆叠为 [N, C, H, W] 的输入张量
+	// 2. tensor_output = C.run_onnx_inference(...) (一次前向计算)
+	// 3. 按 batch 维度拆分输出，逐张 PostProcess
+
+	// --- 模拟实现 ---
+	results := make([]*models.DecisionResult, len(images))
+	errs := make([]error, len(images))
+	for i, image := range images {
+		results[i], errs[i] = s.Recognize(image)
+	}
+	// --- 结束模拟 ---
+
+	return results, errs
+}
+
+// ModelVersion 返回当前加载模型的版本标识 (取模型文件名)
+func (s *AIService) ModelVersion() string {
+	if s.modelPath == "" {
+		return "unknown"
+	}
+	return filepath.Base(s.modelPath)
+}
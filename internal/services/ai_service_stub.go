@@ -4,6 +4,7 @@ package services
 
 import (
 	"log"
+	"path/filepath"
 	"patrol-cloud/internal/models"
 )
 
@@ -24,11 +25,31 @@ func (s *AIService) Recognize(image []byte) (*models.DecisionResult, error) {
 
 	// 模拟一个高置信度的 "pickup" 决策
 	result := &models.DecisionResult{
-		ImageID:    "", // DecisionService 将填充此项
-		Action:     "pickup",
-		Confidence: 0.95,
-		Reason:     "is_trash_type_A (stubbed)",
+		ImageID:      "", // DecisionService 将填充此项
+		Action:       "pickup",
+		Confidence:   0.95,
+		Reason:       "is_trash_type_A (stubbed)",
+		Class:        "trash_type_A",
+		ModelVersion: s.ModelVersion(),
 	}
 
 	return result, nil
 }
+
+// RecognizeBatch returns a mocked decision for each image.
+func (s *AIService) RecognizeBatch(images [][]byte) ([]*models.DecisionResult, []error) {
+	results := make([]*models.DecisionResult, len(images))
+	errs := make([]error, len(images))
+	for i, image := range images {
+		results[i], errs[i] = s.Recognize(image)
+	}
+	return results, errs
+}
+
+// ModelVersion returns the identifier of the loaded model (its file name).
+func (s *AIService) ModelVersion() string {
+	if s.modelPath == "" {
+		return "stub"
+	}
+	return filepath.Base(s.modelPath)
+}
@@ -45,7 +45,7 @@ func (s *AuthService) Login(ctx context.Context, username, password string) (str
 	}
 
 	// 3. 生成 JWT
-	token, err := s.generateJWT(user.ID, user.Username)
+	token, err := s.generateJWT(user.ID, user.Username, user.Role)
 	if err != nil {
 		return "", err
 	}
@@ -54,11 +54,12 @@ func (s *AuthService) Login(ctx context.Context, username, password string) (str
 }
 
 // generateJWT 为指定用户生成一个新的 JWT
-func (s *AuthService) generateJWT(userID, username string) (string, error) {
+func (s *AuthService) generateJWT(userID, username, role string) (string, error) {
 	// 创建 claims
 	claims := jwt.MapClaims{
 		"sub":      userID,
 		"username": username,
+		"role":     role,
 		"iat":      time.Now().Unix(),
 		"exp":      time.Now().Add(time.Hour * 24).Unix(), // 24小时后过期
 	}
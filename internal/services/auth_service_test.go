@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"patrol-cloud/internal/db"
 	"patrol-cloud/internal/models"
 	"testing"
 
@@ -10,9 +11,12 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// MockRepository is a mock type for the db.Repository interface
+// MockRepository is a mock type for the db.Repository interface.
+// Methods not overridden below fall through to the embedded (nil) interface
+// and panic if a test calls them unexpectedly.
 type MockRepository struct {
 	mock.Mock
+	db.Repository
 }
 
 // GetUserByUsername is a mock implementation of the GetUserByUsername method
@@ -25,8 +29,8 @@ func (m *MockRepository) GetUserByUsername(ctx context.Context, username string)
 }
 
 // LogDecision is a mock implementation (needed to satisfy the interface)
-func (m *MockRepository) LogDecision(ctx context.Context, result *models.DecisionResult, imageURL string, metadata models.DecisionRequestMetadata) error {
-	args := m.Called(ctx, result, imageURL, metadata)
+func (m *MockRepository) LogDecision(ctx context.Context, entry *models.DecisionLogEntry) error {
+	args := m.Called(ctx, entry)
 	return args.Error(0)
 }
 
@@ -1,10 +1,13 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"patrol-cloud/internal/db"
 	"patrol-cloud/internal/models"
+
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
 )
@@ -12,14 +15,16 @@ import (
 // CommandService 负责将来自 API 的指令发布到 MQTT
 type CommandService struct {
 	mqttClient mqtt.Client
+	repo       db.Repository
 }
 
-func NewCommandService(client mqtt.Client) *CommandService {
-	return &CommandService{mqttClient: client}
+func NewCommandService(client mqtt.Client, repo db.Repository) *CommandService {
+	return &CommandService{mqttClient: client, repo: repo}
 }
 
-// SendCommand 遵循 3.1.2 协议发布指令
-func (s *CommandService) SendCommand(vehicleID, command, taskID string) (string, error) {
+// SendCommand 遵循 3.1.2 协议发布指令，issuedBy 为下发指令的用户 ID。
+// 无论发布成功与否都会记录到 'command_logs'，以便事后审计。
+func (s *CommandService) SendCommand(ctx context.Context, vehicleID, command, taskID, issuedBy string) (string, error) {
 	commandID := uuid.NewString()
 
 	// 1. 构建 Payload
@@ -38,13 +43,32 @@ func (s *CommandService) SendCommand(vehicleID, command, taskID string) (string,
 
 	// 3. 发布 (QoS 1，如 3.1 所定义)
 	token := s.mqttClient.Publish(topic, 1, false, payloadBytes)
-	
+
 	// (等待确认不是必须的，但有助于调试)
+	entry := &models.CommandLog{
+		ID:        commandID,
+		VehicleID: vehicleID,
+		Command:   command,
+		TaskID:    taskID,
+		IssuedBy:  issuedBy,
+		Status:    models.CommandPublished,
+	}
 	if token.Wait() && token.Error() != nil {
 		log.Printf("ERROR: Failed to publish command to %s: %v", topic, token.Error())
+		entry.Status = models.CommandFailed
+		entry.Error = token.Error().Error()
+		s.recordCommand(ctx, entry)
 		return "", token.Error()
 	}
+	s.recordCommand(ctx, entry)
 
 	log.Printf("INFO: Command %s published to topic %s", commandID, topic)
 	return commandID, nil
 }
+
+// recordCommand 记录指令，记录失败不影响指令本身
+func (s *CommandService) recordCommand(ctx context.Context, entry *models.CommandLog) {
+	if err := s.repo.CreateCommandLog(ctx, entry); err != nil {
+		log.Printf("ERROR: Failed to record command %s: %v", entry.ID, err)
+	}
+}
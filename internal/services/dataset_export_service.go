@@ -0,0 +1,218 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // 注册解码器，用于读取图片尺寸
+	_ "image/png"
+	"log"
+	"os"
+	"path"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/storage"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// datasetExportBucket 是存放导出归档的 Bucket
+	datasetExportBucket = "exports"
+	// datasetLinkExpiry 是导出归档下载链接的有效期
+	datasetLinkExpiry = 24 * time.Hour
+)
+
+var ErrInvalidExportFilter = errors.New("invalid export filter")
+
+// DatasetExportService 将决策图片与标注导出为 YOLO / COCO 格式的训练数据集。
+// 导出只包含创建者有权访问的车辆的决策。
+type DatasetExportService struct {
+	repo    db.Repository
+	storage storage.ObjectStore
+	access  *AccessService
+}
+
+// NewDatasetExportService 创建一个新的 DatasetExportService
+func NewDatasetExportService(repo db.Repository, storage storage.ObjectStore, access *AccessService) *DatasetExportService {
+	return &DatasetExportService{repo: repo, storage: storage, access: access}
+}
+
+// StartExport 登记一个导出任务并在后台执行，立即返回任务记录。
+// 过滤条件指定了创建者无权访问的车辆时返回 ErrAccessDenied。
+func (s *DatasetExportService) StartExport(ctx context.Context, filter models.DatasetExportFilter, createdBy string) (*models.DatasetExport, error) {
+	if filter.StartTime != nil && filter.EndTime != nil && filter.EndTime.Before(*filter.StartTime) {
+		return nil, ErrInvalidExportFilter
+	}
+	if filter.VehicleID != "" {
+		if err := s.access.CheckVehicleAccess(ctx, createdBy, filter.VehicleID); err != nil {
+			return nil, err
+		}
+	}
+
+	export := &models.DatasetExport{
+		ID:        uuid.NewString(),
+		Status:    models.DatasetExportPending,
+		Filter:    filter,
+		CreatedBy: createdBy,
+	}
+	if err := s.repo.CreateDatasetExport(ctx, export); err != nil {
+		return nil, err
+	}
+
+	go s.run(export)
+	return export, nil
+}
+
+// RecoverExports 在启动时调用：导出在进程内的 goroutine 中执行，进程重启后仍为 pending 或 running 的任务
+// 已不可能完成，将其标记为失败
+func (s *DatasetExportService) RecoverExports(ctx context.Context) (int64, error) {
+	return s.repo.FailUnfinishedDatasetExports(ctx, "export interrupted by server restart")
+}
+
+// GetExport 返回导出任务，已完成的任务附带一个短期有效的下载链接。
+// 只有创建者和管理员可以查看，其他用户与任务不存在时一样返回 nil。
+func (s *DatasetExportService) GetExport(ctx context.Context, id, requestedBy, role string) (*models.DatasetExport, error) {
+	export, err := s.repo.GetDatasetExport(ctx, id)
+	if err != nil || export == nil {
+		return export, err
+	}
+	if export.CreatedBy != requestedBy && role != models.RoleAdmin {
+		return nil, nil
+	}
+
+	if export.Status == models.DatasetExportCompleted && export.ObjectName != "" {
+		url, err := s.storage.PresignGet(ctx, datasetExportBucket, export.ObjectName, datasetLinkExpiry)
+		if err != nil {
+			return nil, err
+		}
+		export.DownloadURL = url
+	}
+	return export, nil
+}
+
+// run 在后台生成数据集归档并上传到对象存储
+func (s *DatasetExportService) run(export *models.DatasetExport) {
+	bgCtx := context.Background()
+
+	export.Status = models.DatasetExportRunning
+	if err := s.repo.UpdateDatasetExport(bgCtx, export); err != nil {
+		log.Printf("level=error msg=\"dataset export: failed to update status\" export_id=%s error=\"%v\"", export.ID, err)
+	}
+
+	err := s.safeBuild(bgCtx, export)
+
+	now := time.Now()
+	export.CompletedAt = &now
+	if err != nil {
+		log.Printf("level=error msg=\"dataset export failed\" export_id=%s error=\"%v\"", export.ID, err)
+		export.Status = models.DatasetExportFailed
+		export.Error = err.Error()
+	} else {
+		log.Printf("level=info msg=\"dataset export complete\" export_id=%s images=%d", export.ID, export.ImageCount)
+		export.Status = models.DatasetExportCompleted
+	}
+
+	if err := s.repo.UpdateDatasetExport(bgCtx, export); err != nil {
+		log.Printf("level=error msg=\"dataset export: failed to update status\" export_id=%s error=\"%v\"", export.ID, err)
+	}
+}
+
+// safeBuild 执行 build，将 panic 转换为错误，保证任务不会停留在 running 状态
+func (s *DatasetExportService) safeBuild(ctx context.Context, export *models.DatasetExport) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("level=error msg=\"dataset export panicked\" export_id=%s panic=\"%v\"", export.ID, r)
+			err = fmt.Errorf("export panicked: %v", r)
+		}
+	}()
+	return s.build(ctx, export)
+}
+
+// build 查询样本、下载图片、写出归档并上传，归档先落在临时文件以避免整体占用内存。
+// 创建者无权访问的车辆的样本在执行时按当前授权剔除。
+func (s *DatasetExportService) build(ctx context.Context, export *models.DatasetExport) error {
+	all, err := s.repo.ListDatasetRecords(ctx, export.Filter)
+	if err != nil {
+		return err
+	}
+	allowed, err := s.access.VehicleFilter(ctx, export.CreatedBy)
+	if err != nil {
+		return err
+	}
+	records := make([]*models.DatasetRecord, 0, len(all))
+	for _, record := range all {
+		if allowed(record.Log.VehicleID) {
+			records = append(records, record)
+		}
+	}
+
+	decisions := make([]*models.DecisionResult, len(records))
+	boxesByRecord := make([][]models.BoundingBox, len(records))
+	for i, record := range records {
+		var decision models.DecisionResult
+		if err := json.Unmarshal(record.Log.ServerDecision, &decision); err == nil {
+			decisions[i] = &decision
+		}
+		boxesByRecord[i] = datasetBoxes(record, decisions[i])
+	}
+
+	tmp, err := os.CreateTemp("", "dataset-export-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	writer := newDatasetWriter(zip.NewWriter(tmp), sortedClasses(boxesByRecord))
+	skipped := 0
+	for i, record := range records {
+		if record.Label == nil && !export.Filter.IncludeBackground {
+			skipped++
+			continue
+		}
+		objectName := record.Log.ImageKey
+		data, err := storage.GetBytes(ctx, s.storage, decisionImageBucket, objectName)
+		if err != nil {
+			log.Printf("level=warn msg=\"dataset export: skipping decision\" export_id=%s decision_id=%s error=\"%v\"", export.ID, record.Log.ID, err)
+			continue
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			log.Printf("level=warn msg=\"dataset export: skipping undecodable image\" export_id=%s decision_id=%s error=\"%v\"", export.ID, record.Log.ID, err)
+			continue
+		}
+
+		fileName := record.Log.ID + path.Ext(objectName)
+		if err := writer.Add(fileName, data, cfg.Width, cfg.Height, boxesByRecord[i]); err != nil {
+			return err
+		}
+		export.ImageCount++
+	}
+	if skipped > 0 {
+		log.Printf("level=info msg=\"dataset export: skipped unlabelled decisions\" export_id=%s count=%d", export.ID, skipped)
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, 0); err != nil {
+		return err
+	}
+
+	objectName := export.ID + ".zip"
+	if _, err := s.storage.Put(ctx, datasetExportBucket, objectName, tmp, info.Size(), "application/zip"); err != nil {
+		return err
+	}
+	export.ObjectName = objectName
+	return nil
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"path"
+	"patrol-cloud/internal/models"
+	"sort"
+	"strings"
+)
+
+// 数据集归档布局：
+//
+//	images/<decision_id>.<ext>   原始图片 (YOLO 与 COCO 共用)
+//	labels/<decision_id>.txt     YOLO 标注 (类别索引 + 归一化中心点与宽高)
+//	classes.txt                  YOLO 类别表，行号即类别索引
+//	annotations.json             COCO 标注
+//
+// 已标注但没有目标框的样本写入图片和空的 YOLO 标注文件 (即背景样本)；
+// 未标注的决策只在 IncludeBackground 时才作为背景样本写入。
+
+// cocoImage, cocoAnnotation, cocoCategory 是 COCO 标注文件的最小子集
+type cocoImage struct {
+	ID       int    `json:"id"`
+	FileName string `json:"file_name"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+type cocoAnnotation struct {
+	ID         int        `json:"id"`
+	ImageID    int        `json:"image_id"`
+	CategoryID int        `json:"category_id"`
+	BBox       [4]float64 `json:"bbox"`
+	Area       float64    `json:"area"`
+	IsCrowd    int        `json:"iscrowd"`
+}
+
+type cocoCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type cocoDataset struct {
+	Images      []cocoImage      `json:"images"`
+	Annotations []cocoAnnotation `json:"annotations"`
+	Categories  []cocoCategory   `json:"categories"`
+}
+
+// datasetWriter 将样本依次写入 zip 归档，并在 Close 时写出类别表和 COCO 标注
+type datasetWriter struct {
+	zw         *zip.Writer
+	classes    []string
+	classIndex map[string]int
+	coco       cocoDataset
+}
+
+// newDatasetWriter 创建写入器，classes 决定 YOLO 类别索引与 COCO 类别 ID 的顺序
+func newDatasetWriter(zw *zip.Writer, classes []string) *datasetWriter {
+	w := &datasetWriter{
+		zw:         zw,
+		classes:    classes,
+		classIndex: make(map[string]int, len(classes)),
+		coco: cocoDataset{
+			Images:      []cocoImage{},
+			Annotations: []cocoAnnotation{},
+			Categories:  make([]cocoCategory, 0, len(classes)),
+		},
+	}
+	for i, class := range classes {
+		w.classIndex[class] = i
+		w.coco.Categories = append(w.coco.Categories, cocoCategory{ID: i + 1, Name: class})
+	}
+	return w
+}
+
+// Add 写入一张图片及其目标框
+func (w *datasetWriter) Add(fileName string, image []byte, width, height int, boxes []models.BoundingBox) error {
+	if err := w.writeFile("images/"+fileName, image); err != nil {
+		return err
+	}
+
+	imageID := len(w.coco.Images) + 1
+	w.coco.Images = append(w.coco.Images, cocoImage{ID: imageID, FileName: fileName, Width: width, Height: height})
+
+	var yolo strings.Builder
+	for _, box := range boxes {
+		index, ok := w.classIndex[box.Class]
+		if !ok {
+			return fmt.Errorf("bounding box class %q is not in the class list", box.Class)
+		}
+
+		// YOLO: 类别索引 + 归一化的中心点坐标与宽高
+		cx := (box.X + box.Width/2) / float64(width)
+		cy := (box.Y + box.Height/2) / float64(height)
+		fmt.Fprintf(&yolo, "%d %.6f %.6f %.6f %.6f\n", index, cx, cy, box.Width/float64(width), box.Height/float64(height))
+
+		// COCO: 像素坐标 [x, y, width, height]
+		w.coco.Annotations = append(w.coco.Annotations, cocoAnnotation{
+			ID:         len(w.coco.Annotations) + 1,
+			ImageID:    imageID,
+			CategoryID: index + 1,
+			BBox:       [4]float64{box.X, box.Y, box.Width, box.Height},
+			Area:       box.Width * box.Height,
+		})
+	}
+
+	labelName := strings.TrimSuffix(fileName, path.Ext(fileName)) + ".txt"
+	return w.writeFile("labels/"+labelName, []byte(yolo.String()))
+}
+
+// Close 写出类别表和 COCO 标注并结束归档
+func (w *datasetWriter) Close() error {
+	if err := w.writeFile("classes.txt", []byte(strings.Join(w.classes, "\n")+"\n")); err != nil {
+		return err
+	}
+	cocoBytes, err := json.MarshalIndent(w.coco, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := w.writeFile("annotations.json", cocoBytes); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+func (w *datasetWriter) writeFile(name string, data []byte) error {
+	f, err := w.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// datasetBoxes 返回样本的目标框，未指定类别的框沿用标注 (或模型) 给出的类别
+func datasetBoxes(record *models.DatasetRecord, decision *models.DecisionResult) []models.BoundingBox {
+	if record.Label == nil {
+		return nil
+	}
+
+	fallback := record.Label.CorrectedClass
+	if fallback == "" && decision != nil {
+		fallback = decision.Class
+	}
+
+	boxes := make([]models.BoundingBox, 0, len(record.Label.BoundingBoxes))
+	for _, box := range record.Label.BoundingBoxes {
+		if box.Class == "" {
+			box.Class = fallback
+		}
+		if box.Class == "" {
+			continue
+		}
+		boxes = append(boxes, box)
+	}
+	return boxes
+}
+
+// sortedClasses 返回所有目标框类别的有序去重列表
+func sortedClasses(boxesByRecord [][]models.BoundingBox) []string {
+	seen := make(map[string]bool)
+	var classes []string
+	for _, boxes := range boxesByRecord {
+		for _, box := range boxes {
+			if !seen[box.Class] {
+				seen[box.Class] = true
+				classes = append(classes, box.Class)
+			}
+		}
+	}
+	sort.Strings(classes)
+	return classes
+}
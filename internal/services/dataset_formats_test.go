@@ -0,0 +1,139 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"patrol-cloud/internal/models"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readZip 读取归档中的全部文件
+func readZip(t *testing.T, data []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := make(map[string]string, len(zr.File))
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestDatasetWriter(t *testing.T) {
+	tests := []struct {
+		name       string
+		classes    []string
+		fileName   string
+		width      int
+		height     int
+		boxes      []models.BoundingBox
+		wantLabel  string
+		wantCOCO   []cocoAnnotation
+		wantLayout []string
+	}{
+		{
+			name:      "bbox normalised to centre and size",
+			classes:   []string{"bottle"},
+			fileName:  "d1.jpg",
+			width:     200,
+			height:    100,
+			boxes:     []models.BoundingBox{{Class: "bottle", X: 50, Y: 25, Width: 100, Height: 50}},
+			wantLabel: "0 0.500000 0.500000 0.500000 0.500000\n",
+			wantCOCO: []cocoAnnotation{
+				{ID: 1, ImageID: 1, CategoryID: 1, BBox: [4]float64{50, 25, 100, 50}, Area: 5000},
+			},
+			wantLayout: []string{"annotations.json", "classes.txt", "images/d1.jpg", "labels/d1.txt"},
+		},
+		{
+			name:     "class index follows class list order",
+			classes:  []string{"bottle", "can", "paper"},
+			fileName: "d2.png",
+			width:    100,
+			height:   100,
+			boxes: []models.BoundingBox{
+				{Class: "paper", X: 0, Y: 0, Width: 10, Height: 20},
+				{Class: "can", X: 90, Y: 80, Width: 10, Height: 20},
+			},
+			wantLabel: "2 0.050000 0.100000 0.100000 0.200000\n1 0.950000 0.900000 0.100000 0.200000\n",
+			wantCOCO: []cocoAnnotation{
+				{ID: 1, ImageID: 1, CategoryID: 3, BBox: [4]float64{0, 0, 10, 20}, Area: 200},
+				{ID: 2, ImageID: 1, CategoryID: 2, BBox: [4]float64{90, 80, 10, 20}, Area: 200},
+			},
+			wantLayout: []string{"annotations.json", "classes.txt", "images/d2.png", "labels/d2.txt"},
+		},
+		{
+			name:       "background sample has empty label file",
+			classes:    []string{},
+			fileName:   "d3.jpeg",
+			width:      64,
+			height:     64,
+			wantLabel:  "",
+			wantCOCO:   []cocoAnnotation{},
+			wantLayout: []string{"annotations.json", "classes.txt", "images/d3.jpeg", "labels/d3.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newDatasetWriter(zip.NewWriter(&buf), tt.classes)
+			require.NoError(t, w.Add(tt.fileName, []byte("image"), tt.width, tt.height, tt.boxes))
+			require.NoError(t, w.Close())
+
+			files := readZip(t, buf.Bytes())
+			var names []string
+			for name := range files {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			assert.Equal(t, tt.wantLayout, names)
+			assert.Equal(t, "image", files["images/"+tt.fileName])
+			assert.Equal(t, tt.wantLabel, files[tt.wantLayout[3]])
+
+			var coco cocoDataset
+			require.NoError(t, json.Unmarshal([]byte(files["annotations.json"]), &coco))
+			assert.Equal(t, tt.wantCOCO, coco.Annotations)
+			require.Len(t, coco.Images, 1)
+			assert.Equal(t, cocoImage{ID: 1, FileName: tt.fileName, Width: tt.width, Height: tt.height}, coco.Images[0])
+			require.Len(t, coco.Categories, len(tt.classes))
+			for i, class := range tt.classes {
+				assert.Equal(t, cocoCategory{ID: i + 1, Name: class}, coco.Categories[i])
+			}
+		})
+	}
+}
+
+func TestDatasetWriterRejectsUnknownClass(t *testing.T) {
+	w := newDatasetWriter(zip.NewWriter(io.Discard), []string{"bottle"})
+	err := w.Add("d.jpg", []byte("image"), 10, 10, []models.BoundingBox{{Class: "can", Width: 1, Height: 1}})
+	assert.Error(t, err)
+}
+
+func TestDatasetBoxes(t *testing.T) {
+	decision := &models.DecisionResult{Class: "bottle"}
+	assert.Nil(t, datasetBoxes(&models.DatasetRecord{}, decision), "unlabelled")
+
+	// 未指定类别的框依次沿用更正类别和模型类别
+	record := &models.DatasetRecord{Label: &models.DecisionLabel{
+		CorrectedClass: "can",
+		BoundingBoxes:  []models.BoundingBox{{X: 1, Width: 2, Height: 2}, {Class: "paper", Width: 3, Height: 3}},
+	}}
+	boxes := datasetBoxes(record, decision)
+	require.Len(t, boxes, 2)
+	assert.Equal(t, "can", boxes[0].Class)
+	assert.Equal(t, "paper", boxes[1].Class)
+
+	record.Label.CorrectedClass = ""
+	assert.Equal(t, "bottle", datasetBoxes(record, decision)[0].Class)
+	assert.Equal(t, []string{"bottle", "paper"}, sortedClasses([][]models.BoundingBox{datasetBoxes(record, decision)}))
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"patrol-cloud/internal/models"
+	"sync"
+)
+
+// MaxDecisionBatchImages 限制单次批量识别的图片数量
+const MaxDecisionBatchImages = 16
+
+// BatchRecognizer 由支持批量推理的后端实现，一次前向计算处理多张图片。
+// 返回的两个切片与输入等长，第 i 个结果或错误对应第 i 张图片。
+type BatchRecognizer interface {
+	RecognizeBatch(images [][]byte) ([]*models.DecisionResult, []error)
+}
+
+// DecisionBatchItem 是批量识别中的一张图片及其元数据
+type DecisionBatchItem struct {
+	Image    []byte
+	Metadata models.DecisionRequestMetadata
+}
+
+// DecisionBatchOutcome 是批量识别中单张图片的结果，Result 与 Err 有且只有一个非空
+type DecisionBatchOutcome struct {
+	Result *models.DecisionResult
+	Err    error
+}
+
+// ProcessDecisionBatch 处理同一次停靠中多路摄像头的图片，每张图片的结果和错误互不影响。
+// 超过 MaxDecisionBatchImages 张时整批拒绝。
+func (s *DecisionService) ProcessDecisionBatch(ctx context.Context, items []DecisionBatchItem) []DecisionBatchOutcome {
+	outcomes := make([]DecisionBatchOutcome, len(items))
+	if len(items) > MaxDecisionBatchImages {
+		err := BatchTooLarge(len(items))
+		for i := range outcomes {
+			outcomes[i].Err = err
+		}
+		return outcomes
+	}
+	inputs := make([]*decisionInput, len(items))
+
+	// 1. 并行校验和解码 (并发解码数受 LimitDecodes 限制)；去重命中的图片直接复用之前的决策，其余图片进入推理
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item DecisionBatchItem) {
+			defer wg.Done()
+			inputs[i], outcomes[i].Err = s.prepare(ctx, item.Image, item.Metadata)
+		}(i, item)
+	}
+	wg.Wait()
+
+	var pending []int
+	for i, input := range inputs {
+		if input == nil {
+			continue
+		}
+		if prior := s.duplicateOf(ctx, input); prior != nil {
+			outcomes[i].Result = prior
+			continue
+		}
+		pending = append(pending, i)
+	}
+	if len(pending) == 0 {
+		return outcomes
+	}
+
+	images := make([][]byte, len(pending))
+	for j, i := range pending {
+		images[j] = inputs[i].image.Data
+	}
+
+	// 2. 推理，并为成功的结果并行记录日志，整批共用请求的截止时间
+	results, errs := s.recognizeBatch(ctx, images)
+	for j, i := range pending {
+		if errs[j] != nil {
+			if !errors.Is(errs[j], ErrInferenceQueueFull) && !errors.Is(errs[j], ErrInferencePoolClosed) && !errors.Is(errs[j], context.DeadlineExceeded) {
+				log.Printf("ERROR: AIService.Recognize failed for batch item %d: %v", i, errs[j])
+			}
+			outcomes[i].Err = errs[j]
+			continue
+		}
+		wg.Add(1)
+		go func(result *models.DecisionResult, input *decisionInput) {
+			defer wg.Done()
+			s.dispatchBackground(ctx, result, input)
+		}(results[j], inputs[i])
+		outcomes[i].Result = results[j]
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// recognizeBatch 后端支持批量推理时作为一个任务提交到推理池，否则逐张并行提交
+func (s *DecisionService) recognizeBatch(ctx context.Context, images [][]byte) ([]*models.DecisionResult, []error) {
+	results := make([]*models.DecisionResult, len(images))
+	errs := make([]error, len(images))
+
+	if batcher, ok := s.aiSvc.(BatchRecognizer); ok {
+		var batchResults []*models.DecisionResult
+		var batchErrs []error
+		run := func() { batchResults, batchErrs = batcher.RecognizeBatch(images) }
+
+		if s.pool == nil {
+			run()
+		} else if err := s.pool.Do(ctx, run); err != nil {
+			for i := range errs {
+				errs[i] = err
+			}
+			return results, errs
+		}
+		return batchResults, batchErrs
+	}
+
+	var wg sync.WaitGroup
+	for i := range images {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = s.recognize(ctx, images[i])
+		}(i)
+	}
+	wg.Wait()
+	return results, errs
+}
+
+// BatchTooLarge 返回批量图片数量超限的校验错误
+func BatchTooLarge(count int) *ValidationError {
+	return &ValidationError{
+		Code:    CodeMetadataInvalid,
+		Field:   "images",
+		Message: fmt.Sprintf("at most %d images are allowed per batch", MaxDecisionBatchImages),
+		Details: map[string]interface{}{"max_images": MaxDecisionBatchImages, "count": count},
+	}
+}
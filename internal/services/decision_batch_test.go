@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/queue"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// widthRecognizer 以图片宽度作为识别出的类别，宽度在 fail 中的图片识别失败
+type widthRecognizer struct {
+	fail map[int]bool
+}
+
+func (r *widthRecognizer) Recognize(data []byte) (*models.DecisionResult, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if r.fail[cfg.Width] {
+		return nil, errors.New("inference failed")
+	}
+	return &models.DecisionResult{Class: fmt.Sprint(cfg.Width)}, nil
+}
+
+func (r *widthRecognizer) ModelVersion() string { return "test" }
+
+// batchWidthRecognizer 额外支持一次推理多张图片
+type batchWidthRecognizer struct {
+	widthRecognizer
+	calls int
+}
+
+func (r *batchWidthRecognizer) RecognizeBatch(images [][]byte) ([]*models.DecisionResult, []error) {
+	r.calls++
+	results := make([]*models.DecisionResult, len(images))
+	errs := make([]error, len(images))
+	for i, data := range images {
+		results[i], errs[i] = r.Recognize(data)
+	}
+	return results, errs
+}
+
+// batchRepo 登记了车辆 v1，并记录写入发件箱的决策日志
+type batchRepo struct {
+	db.Repository
+	mu      sync.Mutex
+	entries []*models.DecisionLogEntry
+}
+
+func (r *batchRepo) GetVehicleByID(ctx context.Context, id string) (*models.Vehicle, error) {
+	if id != "v1" {
+		return nil, nil
+	}
+	return &models.Vehicle{ID: id}, nil
+}
+
+func (r *batchRepo) LogDecisionWithOutbox(ctx context.Context, entry *models.DecisionLogEntry, messages ...*models.OutboxMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func TestProcessDecisionBatch(t *testing.T) {
+	now := time.Now().Unix()
+	item := func(width int, vehicleID string) DecisionBatchItem {
+		return DecisionBatchItem{
+			Image:    encodePNG(t, width, 40),
+			Metadata: models.DecisionRequestMetadata{VehicleID: vehicleID, Timestamp: now},
+		}
+	}
+	items := []DecisionBatchItem{
+		item(40, "v1"),
+		item(41, "unknown"), // 校验失败
+		item(42, "v1"),      // 推理失败
+		{Image: []byte("not an image"), Metadata: models.DecisionRequestMetadata{VehicleID: "v1", Timestamp: now}},
+		item(44, "v1"),
+	}
+
+	recognizers := map[string]Recognizer{
+		"per image": &widthRecognizer{fail: map[int]bool{42: true}},
+		"batched":   &batchWidthRecognizer{widthRecognizer: widthRecognizer{fail: map[int]bool{42: true}}},
+	}
+	for name, recognizer := range recognizers {
+		t.Run(name, func(t *testing.T) {
+			repo := &batchRepo{}
+			spool, err := NewImageSpool(t.TempDir())
+			require.NoError(t, err)
+			q, err := queue.Open(t.TempDir(), queue.Options{})
+			require.NoError(t, err)
+			defer q.Close()
+			svc := NewDecisionService(recognizer, repo, nil, q)
+			svc.EnableImageSpool(spool)
+			svc.EnableOutbox()
+			pool := NewInferencePool(2, 8)
+			defer pool.Close()
+			svc.UseInferencePool(pool, time.Second, time.Second)
+
+			outcomes := svc.ProcessDecisionBatch(context.Background(), items)
+			require.Len(t, outcomes, len(items))
+
+			// 结果与输入一一对应，一张图片失败不影响其他图片
+			assert.Equal(t, "40", outcomes[0].Result.Class)
+			assert.Equal(t, "44", outcomes[4].Result.Class)
+			var verr *ValidationError
+			require.ErrorAs(t, outcomes[1].Err, &verr)
+			assert.Equal(t, CodeUnknownVehicle, verr.Code)
+			assert.EqualError(t, outcomes[2].Err, "inference failed")
+			require.ErrorAs(t, outcomes[3].Err, &verr)
+			assert.Equal(t, CodeUnsupportedMedia, verr.Code)
+			for i, outcome := range outcomes {
+				assert.True(t, (outcome.Result == nil) != (outcome.Err == nil), "item %d", i)
+			}
+
+			// 只有成功的结果写入日志，图片登记为上传任务
+			require.Len(t, repo.entries, 2)
+			assert.ElementsMatch(t,
+				[]string{outcomes[0].Result.ImageID, outcomes[4].Result.ImageID},
+				[]string{repo.entries[0].Result.ImageID, repo.entries[1].Result.ImageID})
+			assert.Len(t, q.List(queue.StatePending), 2)
+
+			if batcher, ok := recognizer.(*batchWidthRecognizer); ok {
+				assert.Equal(t, 1, batcher.calls, "valid images share one inference")
+			}
+		})
+	}
+}
+
+func TestProcessDecisionBatchLimit(t *testing.T) {
+	spool, err := NewImageSpool(t.TempDir())
+	require.NoError(t, err)
+	q, err := queue.Open(t.TempDir(), queue.Options{})
+	require.NoError(t, err)
+	defer q.Close()
+	svc := NewDecisionService(&widthRecognizer{}, &batchRepo{}, nil, q)
+	svc.EnableImageSpool(spool)
+	svc.EnableOutbox()
+	items := make([]DecisionBatchItem, MaxDecisionBatchImages+1)
+	for i := range items {
+		items[i] = DecisionBatchItem{Image: encodePNG(t, 40, 40), Metadata: models.DecisionRequestMetadata{VehicleID: "v1", Timestamp: time.Now().Unix()}}
+	}
+
+	outcomes := svc.ProcessDecisionBatch(context.Background(), items)
+	require.Len(t, outcomes, len(items))
+	for _, outcome := range outcomes {
+		var verr *ValidationError
+		require.ErrorAs(t, outcome.Err, &verr)
+		assert.Equal(t, "images", verr.Field)
+		assert.Nil(t, outcome.Result)
+	}
+
+	// 恰好达到上限时正常处理
+	outcomes = svc.ProcessDecisionBatch(context.Background(), items[:MaxDecisionBatchImages])
+	for _, outcome := range outcomes {
+		assert.NoError(t, outcome.Err)
+	}
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"log"
+	"patrol-cloud/internal/imaging"
+	"patrol-cloud/internal/models"
+	"time"
+)
+
+// DedupOptions 控制重复决策请求的识别范围
+type DedupOptions struct {
+	MaxDistance int           // 允许的最大汉明距离 (0-64)
+	Window      time.Duration // 只与该时间窗口内同一车辆的决策比对
+}
+
+// EnableDeduplication 开启基于感知哈希的去重：同一车辆在窗口内对相似图片的请求直接返回之前的决策
+func (s *DecisionService) EnableDeduplication(opts DedupOptions) {
+	s.dedup = &opts
+}
+
+// duplicateOf 在开启去重时查找可复用的近期决策
+func (s *DecisionService) duplicateOf(ctx context.Context, input *decisionInput) *models.DecisionResult {
+	if s.dedup == nil || input.imageHash == nil {
+		return nil
+	}
+	return s.findDuplicate(ctx, input.metadata.VehicleID, uint64(*input.imageHash))
+}
+
+// findDuplicate 查找同一车辆近期最相似的决策，超出距离阈值或查询失败时返回 nil
+func (s *DecisionService) findDuplicate(ctx context.Context, vehicleID string, hash uint64) *models.DecisionResult {
+	recent, err := s.repo.ListRecentHashedDecisions(ctx, vehicleID, time.Now().Add(-s.dedup.Window))
+	if err != nil {
+		// 去重只是优化，查询失败时退回正常推理流程
+		log.Printf("WARN: Could not look up recent decisions for deduplication: %v", err)
+		return nil
+	}
+
+	var best *models.RecentDecision
+	bestDistance := s.dedup.MaxDistance + 1
+	for _, d := range recent {
+		if d.Decision == nil {
+			continue
+		}
+		if distance := imaging.HammingDistance(hash, uint64(d.ImageHash)); distance < bestDistance {
+			best, bestDistance = d, distance
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	log.Printf("level=info msg=\"decision deduplicated\" vehicle_id=%s duplicate_of=%s distance=%d", vehicleID, best.ID, bestDistance)
+	prior := *best.Decision
+	prior.ImageID = best.ID
+	prior.Deduplicated = true
+	return &prior
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"log"
+	"patrol-cloud/internal/imaging"
+	"patrol-cloud/internal/storage"
+)
+
+// imageDerivative 描述一种由决策图片派生的缩小版本
+type imageDerivative struct {
+	prefix  string // 对象名前缀，派生图与原图位于同一 Bucket
+	maxDim  int    // 宽和高的上限 (像素)
+	quality int    // JPEG 质量
+}
+
+var (
+	// thumbnailDerivative 用于日志列表
+	thumbnailDerivative = imageDerivative{prefix: "thumbnails/", maxDim: 160, quality: 75}
+	// previewDerivative 用于详情和标注页面
+	previewDerivative = imageDerivative{prefix: "previews/", maxDim: 640, quality: 82}
+)
+
+// derivativeObjectName 返回决策图片派生图的对象名，派生图统一编码为 JPEG
+func derivativeObjectName(d imageDerivative, imageID string) string {
+	return d.prefix + imageID + ".jpg"
+}
+
+// derivativeImages 是编码好的派生图，编码失败的派生图为 nil
+type derivativeImages struct {
+	thumbnail []byte
+	preview   []byte
+}
+
+// buildDerivatives 由解码后的原图编码缩略图和预览图。
+// 缩略图由预览图再次缩小得到，原图只需完整遍历 (及转换为 RGBA) 一次。
+func buildDerivatives(img image.Image) derivativeImages {
+	preview := imaging.Fit(img, previewDerivative.maxDim)
+	return derivativeImages{
+		preview:   encodeDerivative(previewDerivative, preview),
+		thumbnail: encodeDerivative(thumbnailDerivative, imaging.Fit(preview, thumbnailDerivative.maxDim)),
+	}
+}
+
+// decodeDerivatives 解码原图并编码派生图，用于后台重新处理已持久化的图片
+func decodeDerivatives(data []byte) (derivativeImages, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return derivativeImages{}, err
+	}
+	return buildDerivatives(img), nil
+}
+
+func encodeDerivative(d imageDerivative, img image.Image) []byte {
+	data, err := imaging.EncodeJPEG(img, d.quality)
+	if err != nil {
+		log.Printf("level=warn msg=\"failed to encode image derivative\" derivative=%s error=\"%v\"", d.prefix, err)
+		return nil
+	}
+	return data
+}
+
+// uploadDerivatives 上传缩略图和预览图，返回它们的对象名。
+// 某个派生图失败时只记录日志，对应的对象名为空，前端回退到原图。
+func (s *DecisionService) uploadDerivatives(ctx context.Context, imageID string, images derivativeImages) (thumbnailKey, previewKey string) {
+	return s.uploadDerivative(ctx, thumbnailDerivative, imageID, images.thumbnail), s.uploadDerivative(ctx, previewDerivative, imageID, images.preview)
+}
+
+func (s *DecisionService) uploadDerivative(ctx context.Context, d imageDerivative, imageID string, data []byte) string {
+	if data == nil {
+		return ""
+	}
+	name := derivativeObjectName(d, imageID)
+	if _, err := storage.PutBytes(ctx, s.uploader, decisionImageBucket, name, data, "image/jpeg"); err != nil {
+		log.Printf(
+			"level=warn msg=\"background task failed: image derivative\" image_id=%s derivative=%s error=\"%v\"",
+			imageID,
+			d.prefix,
+			err,
+		)
+		return ""
+	}
+	return name
+}
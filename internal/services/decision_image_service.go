@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/storage"
+	"strconv"
+	"time"
+)
+
+// 决策图片在 API 响应中的 URL 形式
+const (
+	// ImageURLModePresign 返回对象存储的短期预签名链接，浏览器直接从对象存储下载
+	ImageURLModePresign = "presign"
+	// ImageURLModeProxy 返回 /api/v1/images/:id 代理地址，地址带有绑定用户的短期签名 (<img> 无法携带 JWT)，
+	// 每次下载都校验签名和车辆访问权限
+	ImageURLModeProxy = "proxy"
+)
+
+// 决策图片的版本，对应代理地址的 variant 参数
+const (
+	ImageVariantOriginal  = "original"
+	ImageVariantThumbnail = "thumbnail"
+	ImageVariantPreview   = "preview"
+)
+
+var (
+	ErrImageNotFound       = errors.New("decision image not found")
+	ErrInvalidImageVariant = errors.New("invalid image variant")
+	ErrInvalidImageLink    = errors.New("invalid or expired image link")
+)
+
+// DecisionImageService 根据数据库中保存的对象名生成决策图片的访问地址，并提供鉴权代理下载
+type DecisionImageService struct {
+	repo     db.Repository
+	store    storage.ObjectStore
+	access   *AccessService
+	mode     string
+	expiry   time.Duration
+	proxyURL string // 代理地址前缀，如 /api/v1/images
+	secret   []byte // 代理地址的签名密钥
+}
+
+// NewDecisionImageService 创建一个新的 DecisionImageService，mode 为 ImageURLModePresign 或 ImageURLModeProxy，
+// secret 用于签名代理地址
+func NewDecisionImageService(repo db.Repository, store storage.ObjectStore, access *AccessService, mode string, expiry time.Duration, proxyURL string, secret []byte) (*DecisionImageService, error) {
+	if mode != ImageURLModePresign && mode != ImageURLModeProxy {
+		return nil, fmt.Errorf("invalid image url mode %q", mode)
+	}
+	return &DecisionImageService{
+		repo:     repo,
+		store:    store,
+		access:   access,
+		mode:     mode,
+		expiry:   expiry,
+		proxyURL: proxyURL,
+		secret:   secret,
+	}, nil
+}
+
+// ResolveURLs 为决策日志填充 image_url / thumbnail_url / preview_url，代理地址签发给 userID。
+// 单张图片签名失败时只记录日志并留空，不影响列表的其余部分。
+func (s *DecisionImageService) ResolveURLs(ctx context.Context, userID string, logs ...*models.DecisionLog) {
+	for _, l := range logs {
+		l.ImageURL = s.resolve(ctx, userID, l, ImageVariantOriginal, l.ImageKey)
+		l.ThumbnailURL = s.resolve(ctx, userID, l, ImageVariantThumbnail, l.ThumbnailKey)
+		l.PreviewURL = s.resolve(ctx, userID, l, ImageVariantPreview, l.PreviewKey)
+	}
+}
+
+func (s *DecisionImageService) resolve(ctx context.Context, userID string, l *models.DecisionLog, variant, key string) string {
+	if key == "" {
+		return ""
+	}
+	if s.mode == ImageURLModeProxy {
+		expires := time.Now().Add(s.expiry).Unix()
+		q := url.Values{}
+		q.Set("variant", variant)
+		q.Set("user", userID)
+		q.Set("expires", strconv.FormatInt(expires, 10))
+		q.Set("signature", s.sign(userID, l.ID, variant, expires))
+		return s.proxyURL + "/" + url.PathEscape(l.ID) + "?" + q.Encode()
+	}
+	link, err := s.store.PresignGet(ctx, decisionImageBucket, key, s.expiry)
+	if err != nil {
+		log.Printf("level=warn msg=\"failed to presign decision image\" decision_id=%s variant=%s error=\"%v\"", l.ID, variant, err)
+		return ""
+	}
+	return link
+}
+
+// VerifyLink 校验代理地址的签名参数，签名无效或过期时返回 ErrInvalidImageLink
+func (s *DecisionImageService) VerifyLink(userID, decisionID, variant, expires, signature string) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || userID == "" || time.Now().Unix() > exp {
+		return ErrInvalidImageLink
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(userID, decisionID, variant, exp))) {
+		return ErrInvalidImageLink
+	}
+	return nil
+}
+
+func (s *DecisionImageService) sign(userID, decisionID, variant string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "image\n%s\n%s\n%s\n%d", userID, decisionID, variant, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Open 在检查用户对决策所属车辆的访问权限后打开决策图片，调用方负责关闭。
+// 请求的派生图不存在时回退到原图。
+func (s *DecisionImageService) Open(ctx context.Context, userID, decisionID, variant string) (io.ReadCloser, *storage.ObjectInfo, error) {
+	decision, err := s.repo.GetDecisionLogByID(ctx, decisionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if decision == nil {
+		return nil, nil, ErrDecisionNotFound
+	}
+	if err := s.access.CheckVehicleAccess(ctx, userID, decision.VehicleID); err != nil {
+		return nil, nil, err
+	}
+
+	var key string
+	switch variant {
+	case ImageVariantOriginal, "":
+	case ImageVariantThumbnail:
+		key = decision.ThumbnailKey
+	case ImageVariantPreview:
+		key = decision.PreviewKey
+	default:
+		return nil, nil, ErrInvalidImageVariant
+	}
+	if key == "" {
+		key = decision.ImageKey
+	}
+	if key == "" {
+		return nil, nil, ErrImageNotFound
+	}
+
+	rc, info, err := s.store.Get(ctx, decisionImageBucket, key)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil, nil, ErrImageNotFound
+	}
+	return rc, info, err
+}
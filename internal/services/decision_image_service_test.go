@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// imageAccessRepo 只实现 DecisionImageService 需要的查询
+type imageAccessRepo struct {
+	db.Repository
+	decisions map[string]*models.DecisionLog
+	grants    map[string]bool // userID + "/" + vehicleID
+}
+
+func (r *imageAccessRepo) GetDecisionLogByID(ctx context.Context, id string) (*models.DecisionLog, error) {
+	return r.decisions[id], nil
+}
+
+func (r *imageAccessRepo) UserCanAccessVehicle(ctx context.Context, userID, vehicleID string) (bool, error) {
+	return r.grants[userID+"/"+vehicleID], nil
+}
+
+func TestDecisionImageService(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8888/objects", []byte("secret"))
+	require.NoError(t, err)
+	_, err = storage.PutBytes(ctx, store, decisionImageBucket, "img-1.png", []byte("original"), "image/png")
+	require.NoError(t, err)
+
+	decision := &models.DecisionLog{ID: "d1", VehicleID: "v1", ImageKey: "img-1.png"}
+	repo := &imageAccessRepo{
+		decisions: map[string]*models.DecisionLog{"d1": decision},
+		grants:    map[string]bool{"alice/v1": true},
+	}
+	access := NewAccessService(repo)
+
+	proxy, err := NewDecisionImageService(repo, store, access, ImageURLModeProxy, time.Minute, "/api/v1/images", []byte("secret"))
+	require.NoError(t, err)
+	proxy.ResolveURLs(ctx, "alice", decision)
+	link, err := url.Parse(decision.ImageURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v1/images/d1", link.Path)
+	q := link.Query()
+	assert.Equal(t, "original", q.Get("variant"))
+	assert.Equal(t, "alice", q.Get("user"))
+	assert.NoError(t, proxy.VerifyLink("alice", "d1", "original", q.Get("expires"), q.Get("signature")))
+	assert.Empty(t, decision.ThumbnailURL, "missing derivatives have no URL")
+
+	// 签名绑定用户、决策和版本
+	assert.ErrorIs(t, proxy.VerifyLink("bob", "d1", "original", q.Get("expires"), q.Get("signature")), ErrInvalidImageLink)
+	assert.ErrorIs(t, proxy.VerifyLink("alice", "d1", "preview", q.Get("expires"), q.Get("signature")), ErrInvalidImageLink)
+	assert.ErrorIs(t, proxy.VerifyLink("alice", "d1", "original", "1", q.Get("signature")), ErrInvalidImageLink)
+
+	presign, err := NewDecisionImageService(repo, store, access, ImageURLModePresign, time.Minute, "/api/v1/images", []byte("secret"))
+	require.NoError(t, err)
+	presign.ResolveURLs(ctx, "alice", decision)
+	assert.Contains(t, decision.ImageURL, "/decisions/img-1.png?expires=")
+
+	// 缺少缩略图时回退到原图
+	rc, info, err := proxy.Open(ctx, "alice", "d1", ImageVariantThumbnail)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "original", string(data))
+	assert.Equal(t, "image/png", info.ContentType)
+
+	_, _, err = proxy.Open(ctx, "bob", "d1", ImageVariantOriginal)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	_, _, err = proxy.Open(ctx, "alice", "d1", "huge")
+	assert.ErrorIs(t, err, ErrInvalidImageVariant)
+	_, _, err = proxy.Open(ctx, "alice", "missing", ImageVariantOriginal)
+	assert.ErrorIs(t, err, ErrDecisionNotFound)
+
+	_, err = NewDecisionImageService(repo, store, access, "public", time.Minute, "", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"patrol-cloud/internal/geo"
+	"patrol-cloud/internal/models"
+	"time"
+)
+
+// maxTelemetryGap 是用于定位决策的遥测点与决策时刻之间允许的最大时间差，
+// 超过该间隔的轨迹点不足以推断拍摄位置
+const maxTelemetryGap = 2 * time.Minute
+
+// locateDecision 确定决策发生的位置：优先使用元数据中的定位，否则按时间在车辆遥测轨迹上插值。
+// 无法确定时返回 nil。
+func (s *DecisionService) locateDecision(ctx context.Context, metadata models.DecisionRequestMetadata) (*models.DecisionLocation, error) {
+	if metadata.Position != nil {
+		return &models.DecisionLocation{Position: *metadata.Position, Source: models.LocationSourceMetadata}, nil
+	}
+
+	t := time.Unix(metadata.Timestamp, 0)
+	before, after, err := s.repo.GetTelemetryAround(ctx, metadata.VehicleID, t)
+	if err != nil {
+		return nil, err
+	}
+	if before != nil && t.Sub(before.Timestamp) > maxTelemetryGap {
+		before = nil
+	}
+	if after != nil && after.Timestamp.Sub(t) > maxTelemetryGap {
+		after = nil
+	}
+
+	var pos models.Position
+	switch {
+	case before != nil && after != nil:
+		pos = geo.Interpolate(telemetryPosition(before), before.Timestamp, telemetryPosition(after), after.Timestamp, t)
+	case before != nil:
+		pos = telemetryPosition(before)
+	case after != nil:
+		pos = telemetryPosition(after)
+	default:
+		return nil, nil
+	}
+	return &models.DecisionLocation{Position: pos, Source: models.LocationSourceTelemetry}, nil
+}
+
+func telemetryPosition(t *models.VehicleTelemetry) models.Position {
+	return models.Position{Lat: t.Latitude, Lng: t.Longitude}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"log"
+	"patrol-cloud/internal/models"
+	"time"
+)
+
+// OutboxKindDecisionLocate 是随决策日志一同写入发件箱的定位工作：按遥测轨迹插值补全决策位置。
+// Payload 为 DecisionLocateMessage。
+const OutboxKindDecisionLocate = "decision_locate"
+
+// DecisionLocateMessage 描述一条已写入数据库、位置尚待插值的决策
+type DecisionLocateMessage struct {
+	DecisionID string                         `json:"decision_id"`
+	Metadata   models.DecisionRequestMetadata `json:"metadata"`
+}
+
+// EnableOutbox 让决策日志在响应前写入数据库，需要延后处理的工作在同一事务中写入发件箱，
+// 由 OutboxDispatcher 在任一副本上执行，进程在响应后崩溃也不会丢失决策。需要同时开启 EnableImageSpool。
+func (s *DecisionService) EnableOutbox() {
+	s.outbox = true
+}
+
+// logWithOutbox 在响应前持久化决策，返回是否成功，响应路径上没有对象存储 I/O：
+// 图片暂存到本地磁盘并登记 TaskKindImageUpload 任务，由后台上传原图、生成派生图并写回对象名；
+// 决策日志与其定位消息在同一事务中写入。全部工作受请求的截止时间约束。
+// 图片暂存失败时调用方退回到 logAndUploadAsync；数据库写入失败时决策日志改由持久化队列重试。
+func (s *DecisionService) logWithOutbox(ctx context.Context, result *models.DecisionResult, input *decisionInput) bool {
+	if !s.outbox || s.spool == nil {
+		return false
+	}
+	metadata := input.metadata
+	spooled := &SpooledImage{
+		DecisionID:  result.ImageID,
+		VehicleID:   metadata.VehicleID,
+		ObjectName:  result.ImageID + input.image.Extension,
+		ContentType: input.image.ContentType,
+		Size:        len(input.image.Data),
+		SpooledAt:   time.Now().UTC(),
+	}
+	if err := s.enqueueUpload(spooled, input.image.Data); err != nil {
+		log.Printf(
+			"level=warn msg=\"could not spool decision image, falling back to in-process logging\" image_id=%s vehicle_id=%s error=\"%v\"",
+			result.ImageID,
+			metadata.VehicleID,
+			err,
+		)
+		return false
+	}
+
+	// 遥测插值可能需要决策之后的轨迹点，留给后台处理；元数据中的定位直接写入
+	var location *models.DecisionLocation
+	var messages []*models.OutboxMessage
+	if metadata.Position != nil {
+		location = &models.DecisionLocation{Position: *metadata.Position, Source: models.LocationSourceMetadata}
+	} else {
+		msg, err := models.NewOutboxMessage(OutboxKindDecisionLocate, DecisionLocateMessage{DecisionID: result.ImageID, Metadata: metadata})
+		if err != nil {
+			log.Printf("ERROR: Failed to encode outbox message for decision %s: %v", result.ImageID, err)
+		} else {
+			messages = append(messages, msg)
+		}
+	}
+	// 对象名由上传任务在图片上传后写回
+	entry := models.DecisionLogEntry{
+		Result:    result,
+		Metadata:  metadata,
+		ImageHash: input.imageHash,
+		Location:  location,
+	}
+	if err := s.repo.LogDecisionWithOutbox(ctx, &entry, messages...); err != nil {
+		log.Printf(
+			"level=warn msg=\"outbox write failed, decision log queued for retry\" image_id=%s vehicle_id=%s error=\"%v\"",
+			result.ImageID,
+			metadata.VehicleID,
+			err,
+		)
+		// 重试时由 HandleDecisionLogTask 补全定位
+		if _, qErr := s.taskQueue.Enqueue(TaskKindDecisionLog, entry); qErr != nil {
+			log.Printf(
+				"level=critical msg=\"FATAL: could not write failed task to queue\" image_id=%s error=\"%v\"",
+				result.ImageID,
+				qErr,
+			)
+		}
+	}
+	return true
+}
+
+// HandleDecisionLocateMessage 按遥测轨迹插值决策位置并写回，可重复执行。
+// 查询或写入失败时返回错误由分发器重试；轨迹中没有可用的点时不再重试。
+func (s *DecisionService) HandleDecisionLocateMessage(ctx context.Context, msg *models.OutboxMessage) error {
+	var payload DecisionLocateMessage
+	if err := msg.Decode(&payload); err != nil {
+		return err
+	}
+
+	location, err := s.locateDecision(ctx, payload.Metadata)
+	if err != nil {
+		return err
+	}
+	if location == nil {
+		log.Printf("level=info msg=\"decision could not be located from telemetry\" image_id=%s vehicle_id=%s", payload.DecisionID, payload.Metadata.VehicleID)
+		return nil
+	}
+	updated, err := s.repo.UpdateDecisionLocation(ctx, payload.DecisionID, location)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		// 决策日志与消息同时写入，不存在说明决策已被删除
+		log.Printf("level=warn msg=\"decision of outbox message no longer exists\" image_id=%s", payload.DecisionID)
+		return nil
+	}
+
+	log.Printf("level=info msg=\"background task complete: decision located\" image_id=%s attempts=%d", payload.DecisionID, msg.Attempts+1)
+	return nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/queue"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outboxRepo 记录与决策日志一同写入的消息，以及处理消息后写回的位置
+type outboxRepo struct {
+	db.Repository
+	entry    *models.DecisionLogEntry
+	messages []*models.OutboxMessage
+	location *models.DecisionLocation
+	err      error
+}
+
+func (r *outboxRepo) LogDecisionWithOutbox(ctx context.Context, entry *models.DecisionLogEntry, messages ...*models.OutboxMessage) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.entry = entry
+	r.messages = messages
+	return nil
+}
+
+func (r *outboxRepo) UpdateDecisionLocation(ctx context.Context, decisionID string, location *models.DecisionLocation) (bool, error) {
+	r.location = location
+	return r.entry != nil, nil
+}
+
+func (r *outboxRepo) GetTelemetryAround(ctx context.Context, vehicleID string, t time.Time) (before, after *models.VehicleTelemetry, err error) {
+	return &models.VehicleTelemetry{Timestamp: t.Add(-time.Second), Latitude: 31.2, Longitude: 121.5}, nil, nil
+}
+
+func TestDecisionOutbox(t *testing.T) {
+	ctx := context.Background()
+	spool, err := NewImageSpool(t.TempDir())
+	require.NoError(t, err)
+	q, err := queue.Open(t.TempDir(), queue.Options{})
+	require.NoError(t, err)
+	defer q.Close()
+
+	repo := &outboxRepo{}
+	// 没有对象存储：响应路径上不能访问对象存储
+	svc := NewDecisionService(nil, repo, nil, q)
+	svc.EnableImageSpool(spool)
+	png := encodePNG(t, 800, 600)
+	input := &decisionInput{
+		image:    &DecisionImage{Data: png, ContentType: "image/png", Extension: ".png"},
+		metadata: models.DecisionRequestMetadata{VehicleID: "v1", Timestamp: 1700000000},
+	}
+	result := &models.DecisionResult{ImageID: "img-1"}
+
+	// 未开启时由调用方退回到进程内处理
+	assert.False(t, svc.logWithOutbox(ctx, result, input))
+
+	// 图片暂存到本地并登记上传任务，日志与定位消息一同写入
+	svc.EnableOutbox()
+	require.True(t, svc.logWithOutbox(ctx, result, input))
+	require.NotNil(t, repo.entry)
+	assert.Empty(t, repo.entry.ImageKey, "image key is written back by the upload task")
+	data, err := os.ReadFile(spool.imagePath("img-1.png"))
+	require.NoError(t, err)
+	assert.Equal(t, png, data)
+	tasks := q.List(queue.StatePending)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, TaskKindImageUpload, tasks[0].Kind)
+
+	require.Len(t, repo.messages, 1)
+	msg := repo.messages[0]
+	assert.Equal(t, OutboxKindDecisionLocate, msg.Kind)
+	assert.Less(t, len(msg.Payload), 512, "payload carries references only")
+
+	// 重复处理同一条消息的结果相同
+	for range 2 {
+		require.NoError(t, svc.HandleDecisionLocateMessage(ctx, msg))
+	}
+	require.NotNil(t, repo.location)
+	assert.Equal(t, models.LocationSourceTelemetry, repo.location.Source)
+
+	// 元数据中已有定位时不需要发件箱消息
+	input.metadata.Position = &models.Position{Lat: 1, Lng: 2}
+	require.True(t, svc.logWithOutbox(ctx, &models.DecisionResult{ImageID: "img-2"}, input))
+	assert.Empty(t, repo.messages)
+	require.NotNil(t, repo.entry.Location)
+	assert.Equal(t, models.LocationSourceMetadata, repo.entry.Location.Source)
+
+	// 数据库不可用时决策日志进入持久化队列
+	repo.err = errors.New("connection refused")
+	require.True(t, svc.logWithOutbox(ctx, &models.DecisionResult{ImageID: "img-3"}, input))
+	kinds := map[string]int{}
+	for _, task := range q.List(queue.StatePending) {
+		kinds[task.Kind]++
+	}
+	assert.Equal(t, map[string]int{TaskKindImageUpload: 3, TaskKindDecisionLog: 1}, kinds)
+}
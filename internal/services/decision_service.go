@@ -1,71 +1,243 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"image"
 	"log"
 	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/imaging"
+	"patrol-cloud/internal/metrics"
 	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/queue"
 	"patrol-cloud/internal/storage"
-	"patrol-cloud/internal/tasks"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+// decisionImageBucket 是存放决策图片的 Bucket
+const decisionImageBucket = "decisions"
+
+const (
+	// defaultDecisionTimeout 与边缘端的 5 秒请求超时保持一致
+	defaultDecisionTimeout = 5 * time.Second
+	// maxDecisionTimeout 是客户端可声明的最长处理时限
+	maxDecisionTimeout = 30 * time.Second
+)
+
+// Recognizer 抽象了一个可执行推理的模型 (AIService 即其实现)
+type Recognizer interface {
+	Recognize(image []byte) (*models.DecisionResult, error)
+	ModelVersion() string
+}
+
 // DecisionService 遵循 4.2.3 的设计
 type DecisionService struct {
-	aiSvc      *AIService
-	repo       db.Repository
-	uploader   *storage.MinIOClient
-	taskQueue *tasks.FileQueue
+	aiSvc     Recognizer
+	repo      db.Repository
+	uploader  storage.ObjectStore
+	taskQueue *queue.Queue
+	shadow    *ShadowService // (可选) 候选模型的影子评估
+	dedup     *DedupOptions  // (可选) 基于感知哈希的重复请求识别
+	pool      *InferencePool // (可选) 有界推理池，未配置时在请求 goroutine 中直接推理
+	decodes   chan struct{}  // (可选) 限制同时解码的图片数，未配置时不限制
+	decodeDur *metrics.Histogram
+	validator *DecisionValidator
+	spool     *ImageSpool // (可选) 上传失败的图片暂存到本地后重传
+	outbox    bool        // 开启后在响应前将决策日志和图片处理工作写入同一事务 (见 decision_outbox.go)
+
+	defaultTimeout time.Duration
+	maxTimeout     time.Duration
 }
 
-func NewDecisionService(ai *AIService, r db.Repository, s *storage.MinIOClient, tq *tasks.FileQueue) *DecisionService {
+func NewDecisionService(ai Recognizer, r db.Repository, s storage.ObjectStore, tq *queue.Queue) *DecisionService {
 	return &DecisionService{
-		aiSvc:    ai,
-		repo:     r,
-		uploader: s,
+		aiSvc:     ai,
+		repo:      r,
+		uploader:  s,
 		taskQueue: tq,
+		validator: NewDecisionValidator(r, DefaultUploadLimits),
+		decodeDur: metrics.Default.Histogram("decision.decode_duration", metrics.DefaultLatencyBounds),
+
+		defaultTimeout: defaultDecisionTimeout,
+		maxTimeout:     maxDecisionTimeout,
 	}
 }
 
+// LimitDecodes 限制同时解码的图片数，超出的请求在截止时间内等待。
+// 解码不经过推理池，不与推理争用 worker，也不计入 inference.duration。
+func (s *DecisionService) LimitDecodes(n int) {
+	if n < 1 {
+		n = 1
+	}
+	s.decodes = make(chan struct{}, n)
+}
+
+// SetUploadLimits 覆盖默认的上传校验阈值
+func (s *DecisionService) SetUploadLimits(limits UploadLimits) {
+	s.validator = NewDecisionValidator(s.repo, limits)
+}
+
+// UploadLimits 返回当前的上传校验阈值，API 层据此限制请求体大小
+func (s *DecisionService) UploadLimits() UploadLimits {
+	return s.validator.Limits()
+}
+
+// UseInferencePool 让推理经由有界推理池执行，defaultTimeout / maxTimeout 约束每个请求的截止时间
+func (s *DecisionService) UseInferencePool(pool *InferencePool, defaultTimeout, maxTimeout time.Duration) {
+	s.pool = pool
+	s.defaultTimeout = defaultTimeout
+	s.maxTimeout = maxTimeout
+}
+
+// RequestTimeout 根据客户端声明的超时 (未声明时为 0) 计算本次请求的处理时限
+func (s *DecisionService) RequestTimeout(requested time.Duration) time.Duration {
+	if requested <= 0 {
+		return s.defaultTimeout
+	}
+	if requested > s.maxTimeout {
+		return s.maxTimeout
+	}
+	return requested
+}
+
+// RetryAfter 返回队列满时建议客户端等待的时间
+func (s *DecisionService) RetryAfter() time.Duration {
+	if s.pool == nil {
+		return time.Second
+	}
+	return s.pool.RetryAfter()
+}
+
+// recognize 调用 AI 服务，配置了推理池时在池中排队执行
+func (s *DecisionService) recognize(ctx context.Context, image []byte) (*models.DecisionResult, error) {
+	if s.pool == nil {
+		return s.aiSvc.Recognize(image)
+	}
+
+	var result *models.DecisionResult
+	var err error
+	if poolErr := s.pool.Do(ctx, func() { result, err = s.aiSvc.Recognize(image) }); poolErr != nil {
+		return nil, poolErr
+	}
+	return result, err
+}
+
+// EnableShadowEvaluation 开启影子模式：每次决策后在后台用候选模型对同一张图片再推理一次
+func (s *DecisionService) EnableShadowEvaluation(shadow *ShadowService) {
+	s.shadow = shadow
+}
+
+// decisionInput 是通过校验、等待推理的一张决策图片。
+// 不保留解码后的图片 (8192x8192 的 RGBA 约 268 MB)，只保留感知哈希和编码好的派生图。
+type decisionInput struct {
+	image     *DecisionImage
+	metadata  models.DecisionRequestMetadata
+	imageHash *int64
+}
+
+// prepare 校验图片和元数据 (不合法时返回 *ValidationError)，并完整解码图片
+func (s *DecisionService) prepare(ctx context.Context, image []byte, metadata models.DecisionRequestMetadata) (*decisionInput, error) {
+	validated, err := s.validator.ValidateImage(image)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validator.ValidateMetadata(ctx, metadata); err != nil {
+		return nil, err
+	}
+
+	input := &decisionInput{image: validated, metadata: metadata}
+	if err := s.analyze(ctx, input); err != nil {
+		return nil, err
+	}
+	return input, nil
+}
+
+// analyze 在请求 goroutine 中解码图片并计算感知哈希，派生图在后台由原图生成。
+// 图片的字节数和尺寸已由 ValidateImage 限制，并发解码数由 LimitDecodes 限制。
+func (s *DecisionService) analyze(ctx context.Context, input *decisionInput) error {
+	if s.decodes != nil {
+		select {
+		case s.decodes <- struct{}{}:
+			defer func() { <-s.decodes }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	start := time.Now()
+	decoded, _, err := image.Decode(bytes.NewReader(input.image.Data))
+	s.decodeDur.Observe(time.Since(start))
+	if err != nil {
+		return &ValidationError{Code: CodeImageUndecodable, Field: "image", Message: "image data is corrupt or truncated"}
+	}
+	hash := int64(imaging.HashImage(decoded))
+	input.imageHash = &hash
+	return nil
+}
+
 // ProcessDecision 编排同步 AI 决策和异步日志记录
 func (s *DecisionService) ProcessDecision(ctx context.Context, image []byte, metadata models.DecisionRequestMetadata) (*models.DecisionResult, error) {
 
-	// 1. (同步) 调用 AI 服务进行识别
-	result, err := s.aiSvc.Recognize(image)
+	// 0. 校验上传内容
+	input, err := s.prepare(ctx, image, metadata)
 	if err != nil {
-		log.Printf("ERROR: AIService.Recognize failed: %v", err)
 		return nil, err
 	}
 
-	// 确保 ImageID 已生成
-	if result.ImageID == "" {
-		result.ImageID = uuid.NewString()
+	// 0b. 命中同一车辆近期的相似决策时直接复用，跳过推理和上传
+	if prior := s.duplicateOf(ctx, input); prior != nil {
+		return prior, nil
+	}
+
+	// 1. (同步) 调用 AI 服务进行识别
+	result, err := s.recognize(ctx, input.image.Data)
+	if err != nil {
+		if !errors.Is(err, ErrInferenceQueueFull) && !errors.Is(err, ErrInferencePoolClosed) && !errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("ERROR: AIService.Recognize failed: %v", err)
+		}
+		return nil, err
 	}
 
-	// 2. (异步) 启动 Goroutine 上传图片和记录日志
-	go s.logAndUploadAsync(result, image, metadata)
+	// 2. 记录日志 (开启发件箱时在响应前持久化)，异步上传图片和影子评估
+	s.dispatchBackground(ctx, result, input)
 
 	// 3. (同步) 立即返回 AI 结果
 	return result, nil
 }
 
-// FailedDecisionLogTask 定义了写入文件队列的任务结构
-type FailedDecisionLogTask struct {
-	Result   *models.DecisionResult        `json:"result"`
-	ImageURL string                        `json:"image_url"`
-	Metadata models.DecisionRequestMetadata `json:"metadata"`
+// dispatchBackground 为识别结果分配 ImageID 并记录决策。开启发件箱时在响应前持久化 (受请求截止时间约束)，
+// 图片上传、派生图和定位都在后台进行；否则整个记录过程在后台 Goroutine 中进行
+func (s *DecisionService) dispatchBackground(ctx context.Context, result *models.DecisionResult, input *decisionInput) {
+	// 确保 ImageID 已生成
+	if result.ImageID == "" {
+		result.ImageID = uuid.NewString()
+	}
+
+	// 优先将日志和后续工作写入发件箱；未开启或数据库不可用时退回到进程内的 Goroutine
+	if !s.logWithOutbox(ctx, result, input) {
+		go s.logAndUploadAsync(result, input)
+	}
+
+	// 影子模式下让候选模型评估同一张图片，不影响返回结果
+	if s.shadow != nil {
+		s.shadow.Submit(result, input.image.Data, input.metadata)
+	}
 }
 
 // logAndUploadAsync 在后台处理图片上传和数据库日志记录
-func (s *DecisionService) logAndUploadAsync(result *models.DecisionResult, image []byte, metadata models.DecisionRequestMetadata) {
+func (s *DecisionService) logAndUploadAsync(result *models.DecisionResult, input *decisionInput) {
 	// 使用一个新的 background context，因为原始的 API 请求可能已经结束
 	bgCtx := context.Background()
+	metadata := input.metadata
 
-	// 1. 上传图片到 MinIO
-	fileName := result.ImageID + ".jpg"
-	imageURL, err := s.uploader.Upload(bgCtx, "decisions", fileName, image, "image/jpeg")
-	if err != nil {
+	// 1. 上传图片到对象存储
+	// 数据库中只保存对象名，访问 URL 在响应时按调用者权限生成 (见 DecisionImageService)
+	var imageKey string
+	fileName := result.ImageID + input.image.Extension
+	if _, err := storage.PutBytes(bgCtx, s.uploader, decisionImageBucket, fileName, input.image.Data, input.image.ContentType); err != nil {
 		// 使用结构化日志记录后台任务的失败
 		log.Printf(
 			"level=error msg=\"background task failed: image upload\" image_id=%s vehicle_id=%s error=\"%v\"",
@@ -73,11 +245,43 @@ func (s *DecisionService) logAndUploadAsync(result *models.DecisionResult, image
 			metadata.VehicleID,
 			err,
 		)
-		// 即使上传失败，我们仍然尝试记录日志，imageURL 会是空的
+		// 即使上传失败，我们仍然尝试记录日志，imageKey 会是空的，
+		// 图片暂存到本地，重传成功后再写回 (见 HandleImageUploadTask)
+		s.spoolImage(result.ImageID, metadata.VehicleID, fileName, input.image, err)
+	} else {
+		imageKey = fileName
+	}
+
+	// 1b. 原图上传成功后生成缩略图和预览图
+	var thumbnailKey, previewKey string
+	if imageKey != "" {
+		if derivatives, err := decodeDerivatives(input.image.Data); err == nil {
+			thumbnailKey, previewKey = s.uploadDerivatives(bgCtx, result.ImageID, derivatives)
+		}
+	}
+
+	// 2. 确定决策发生的位置，定位失败不影响日志记录
+	location, err := s.locateDecision(bgCtx, metadata)
+	if err != nil {
+		log.Printf(
+			"level=warn msg=\"background task failed: locate decision\" image_id=%s vehicle_id=%s error=\"%v\"",
+			result.ImageID,
+			metadata.VehicleID,
+			err,
+		)
 	}
 
-	// 2. 记录日志到数据库
-	if err := s.repo.LogDecision(bgCtx, result, imageURL, metadata); err != nil {
+	// 3. 记录日志到数据库
+	entry := models.DecisionLogEntry{
+		Result:       result,
+		ImageKey:     imageKey,
+		ThumbnailKey: thumbnailKey,
+		PreviewKey:   previewKey,
+		Metadata:     metadata,
+		ImageHash:    input.imageHash,
+		Location:     location,
+	}
+	if err := s.repo.LogDecision(bgCtx, &entry); err != nil {
 		log.Printf(
 			"level=error msg=\"background task failed: log decision\" image_id=%s vehicle_id=%s error=\"%v\"",
 			result.ImageID,
@@ -85,13 +289,8 @@ func (s *DecisionService) logAndUploadAsync(result *models.DecisionResult, image
 			err,
 		)
 
-		// 将失败的任务写入文件队列
-		failedTask := FailedDecisionLogTask{
-			Result:   result,
-			ImageURL: imageURL,
-			Metadata: metadata,
-		}
-		if qErr := s.taskQueue.LogFailedTask(failedTask); qErr != nil {
+		// 将失败的任务写入持久化队列，由 HandleDecisionLogTask 重试
+		if _, qErr := s.taskQueue.Enqueue(TaskKindDecisionLog, entry); qErr != nil {
 			log.Printf(
 				"level=critical msg=\"FATAL: could not write failed task to queue\" image_id=%s error=\"%v\"",
 				result.ImageID,
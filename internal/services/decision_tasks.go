@@ -0,0 +1,79 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/queue"
+)
+
+// TaskKindDecisionLog 是写入数据库失败、等待重试的决策日志任务，Payload 为 models.DecisionLogEntry
+const TaskKindDecisionLog = "decision_log"
+
+// HandleDecisionLogTask 重试写入决策日志。决策已存在 (此前的重试实际已成功) 时视为完成。
+func (s *DecisionService) HandleDecisionLogTask(ctx context.Context, task *queue.Task) error {
+	var entry models.DecisionLogEntry
+	if err := task.Decode(&entry); err != nil {
+		return err
+	}
+	if entry.Result == nil {
+		return errors.New("decision log task has no result")
+	}
+	// 发件箱写入失败时定位消息随之丢失，在重试时补全
+	if entry.Location == nil {
+		if location, err := s.locateDecision(ctx, entry.Metadata); err == nil {
+			entry.Location = location
+		}
+	}
+	if err := s.repo.LogDecision(ctx, &entry); err != nil && !errors.Is(err, db.ErrConflict) {
+		return err
+	}
+	log.Printf("level=info msg=\"background task complete: decision logged on retry\" image_id=%s attempts=%d", entry.Result.ImageID, task.Attempts+1)
+	return nil
+}
+
+// legacyFailedTask 是旧版文件队列中的一行：决策日志及其重放失败的次数
+type legacyFailedTask struct {
+	models.DecisionLogEntry
+	Attempts  int    `json:"attempts,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// ImportLegacyFailedTasks 将旧版文件队列 (每行一个决策日志 JSON) 中的任务以 state 导入持久化队列，
+// 保留原有的失败次数和最近一次错误，死信文件应以 queue.StateDead 导入，避免重新执行。
+// 导入后将文件重命名为 <path>.imported。文件不存在时不做任何事。
+func ImportLegacyFailedTasks(q *queue.Queue, path string, state queue.TaskState) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	imported := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var task legacyFailedTask
+		if err := json.Unmarshal(scanner.Bytes(), &task); err != nil || task.Result == nil {
+			log.Printf("WARN: Skipping undecodable legacy failed task in %s: %v", path, err)
+			continue
+		}
+		if _, err := q.Import(TaskKindDecisionLog, task.DecisionLogEntry, state, task.Attempts, task.LastError); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	if err := scanner.Err(); err != nil {
+		return imported, err
+	}
+	return imported, os.Rename(path, path+".imported")
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg" // 注册解码器
+	_ "image/png"
+	"net/http"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"time"
+)
+
+// 校验错误码，API 层据此选择 HTTP 状态码
+const (
+	CodeImageTooLarge       = "image_too_large"
+	CodeUnsupportedMedia    = "unsupported_media_type"
+	CodeImageUndecodable    = "image_undecodable"
+	CodeImageDimensions     = "image_dimensions_out_of_range"
+	CodeMetadataInvalid     = "metadata_invalid"
+	CodeUnknownVehicle      = "unknown_vehicle"
+	CodeTimestampOutOfRange = "timestamp_out_of_range"
+)
+
+// ValidationError 描述上传内容不合法的具体原因
+type ValidationError struct {
+	Code    string                 `json:"code"`
+	Field   string                 `json:"field"`
+	Message string                 `json:"error"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// UploadLimits 是决策上传的校验阈值
+type UploadLimits struct {
+	MaxImageBytes int64
+	MinDimension  int           // 宽和高的最小像素数
+	MaxDimension  int           // 宽和高的最大像素数
+	MaxClockSkew  time.Duration // 元数据时间戳最多可超前服务器时间多久
+	MaxAge        time.Duration // 元数据时间戳最多可落后服务器时间多久
+}
+
+// DefaultUploadLimits 是未显式配置时使用的校验阈值
+var DefaultUploadLimits = UploadLimits{
+	MaxImageBytes: 10 << 20,
+	MinDimension:  32,
+	MaxDimension:  8192,
+	MaxClockSkew:  5 * time.Minute,
+	MaxAge:        24 * time.Hour,
+}
+
+// supportedImageTypes 将嗅探出的 MIME 类型映射为存储时使用的扩展名
+var supportedImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// DecisionImage 是通过校验的决策图片
+type DecisionImage struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+}
+
+// DecisionValidator 校验决策请求的图片和元数据
+type DecisionValidator struct {
+	repo   db.Repository
+	limits UploadLimits
+}
+
+// NewDecisionValidator 创建一个新的 DecisionValidator
+func NewDecisionValidator(repo db.Repository, limits UploadLimits) *DecisionValidator {
+	return &DecisionValidator{repo: repo, limits: limits}
+}
+
+// Limits 返回当前的校验阈值
+func (v *DecisionValidator) Limits() UploadLimits {
+	return v.limits
+}
+
+// ValidateImage 依次检查大小、MIME 类型和尺寸。只解码图片头，
+// 完整解码 (及对损坏图片的检查) 在推理池中进行，见 DecisionService.analyze。
+func (v *DecisionValidator) ValidateImage(data []byte) (*DecisionImage, error) {
+	if int64(len(data)) > v.limits.MaxImageBytes {
+		return nil, &ValidationError{
+			Code:    CodeImageTooLarge,
+			Field:   "image",
+			Message: "image exceeds the maximum allowed size",
+			Details: map[string]interface{}{"max_bytes": v.limits.MaxImageBytes, "size": len(data)},
+		}
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := supportedImageTypes[contentType]
+	if !ok {
+		return nil, &ValidationError{
+			Code:    CodeUnsupportedMedia,
+			Field:   "image",
+			Message: "image must be JPEG or PNG",
+			Details: map[string]interface{}{"detected_type": contentType},
+		}
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ValidationError{Code: CodeImageUndecodable, Field: "image", Message: "image header could not be decoded"}
+	}
+	if cfg.Width < v.limits.MinDimension || cfg.Height < v.limits.MinDimension ||
+		cfg.Width > v.limits.MaxDimension || cfg.Height > v.limits.MaxDimension {
+		return nil, &ValidationError{
+			Code:    CodeImageDimensions,
+			Field:   "image",
+			Message: "image dimensions are out of range",
+			Details: map[string]interface{}{
+				"width":         cfg.Width,
+				"height":        cfg.Height,
+				"min_dimension": v.limits.MinDimension,
+				"max_dimension": v.limits.MaxDimension,
+			},
+		}
+	}
+
+	return &DecisionImage{
+		Data:        data,
+		ContentType: contentType,
+		Extension:   ext,
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+	}, nil
+}
+
+// ValidateMetadata 检查车辆是否已登记以及时间戳是否在合理范围内
+func (v *DecisionValidator) ValidateMetadata(ctx context.Context, metadata models.DecisionRequestMetadata) error {
+	if metadata.VehicleID == "" {
+		return &ValidationError{Code: CodeMetadataInvalid, Field: "metadata.vehicle_id", Message: "vehicle_id is required"}
+	}
+
+	if p := metadata.Position; p != nil && (p.Lat < -90 || p.Lat > 90 || p.Lng < -180 || p.Lng > 180) {
+		return &ValidationError{
+			Code:    CodeMetadataInvalid,
+			Field:   "metadata.position",
+			Message: "position is out of range",
+			Details: map[string]interface{}{"lat": p.Lat, "lng": p.Lng},
+		}
+	}
+
+	now := time.Now()
+	ts := time.Unix(metadata.Timestamp, 0)
+	if metadata.Timestamp <= 0 || ts.After(now.Add(v.limits.MaxClockSkew)) || ts.Before(now.Add(-v.limits.MaxAge)) {
+		return &ValidationError{
+			Code:    CodeTimestampOutOfRange,
+			Field:   "metadata.timestamp",
+			Message: "timestamp is missing or too far from server time",
+			Details: map[string]interface{}{"timestamp": metadata.Timestamp, "server_time": now.Unix()},
+		}
+	}
+
+	vehicle, err := v.repo.GetVehicleByID(ctx, metadata.VehicleID)
+	if err != nil {
+		return err
+	}
+	if vehicle == nil {
+		return &ValidationError{
+			Code:    CodeUnknownVehicle,
+			Field:   "metadata.vehicle_id",
+			Message: "vehicle is not registered",
+			Details: map[string]interface{}{"vehicle_id": metadata.VehicleID},
+		}
+	}
+	return nil
+}
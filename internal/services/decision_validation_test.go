@@ -0,0 +1,90 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"patrol-cloud/internal/metrics"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))))
+	return buf.Bytes()
+}
+
+func TestValidateImage(t *testing.T) {
+	limits := DefaultUploadLimits
+	limits.MaxImageBytes = 4096
+	v := NewDecisionValidator(nil, limits)
+
+	valid := encodePNG(t, 64, 48)
+	img, err := v.ValidateImage(valid)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", img.ContentType)
+	assert.Equal(t, ".png", img.Extension)
+	assert.Equal(t, 64, img.Width)
+
+	cases := map[string]struct {
+		data []byte
+		code string
+	}{
+		"too large":   {bytes.Repeat([]byte{0}, 5000), CodeImageTooLarge},
+		"not image":   {[]byte("hello, world"), CodeUnsupportedMedia},
+		"too small":   {encodePNG(t, 16, 16), CodeImageDimensions},
+		"header only": {valid[:8], CodeImageUndecodable},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := v.ValidateImage(tc.data)
+			var vErr *ValidationError
+			require.ErrorAs(t, err, &vErr)
+			assert.Equal(t, tc.code, vErr.Code)
+		})
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	svc := NewDecisionService(nil, nil, nil, nil)
+	svc.LimitDecodes(1)
+
+	decodes := metrics.Default.Histogram("decision.decode_duration", metrics.DefaultLatencyBounds).Snapshot().Count
+	valid := encodePNG(t, 1280, 720)
+	input := &decisionInput{image: &DecisionImage{Data: valid}}
+	require.NoError(t, svc.analyze(context.Background(), input))
+	require.NotNil(t, input.imageHash)
+	assert.Equal(t, decodes+1, metrics.Default.Histogram("decision.decode_duration", metrics.DefaultLatencyBounds).Snapshot().Count)
+
+	// 解码名额被占满时在截止时间到达后放弃
+	svc.decodes <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, svc.analyze(ctx, input), context.DeadlineExceeded)
+	<-svc.decodes
+
+	// 派生图按比例缩小，缩略图由预览图得到
+	derivatives, err := decodeDerivatives(valid)
+	require.NoError(t, err)
+	preview, _, err := image.DecodeConfig(bytes.NewReader(derivatives.preview))
+	require.NoError(t, err)
+	assert.Equal(t, 640, preview.Width)
+	assert.Equal(t, 360, preview.Height)
+	thumbnail, _, err := image.DecodeConfig(bytes.NewReader(derivatives.thumbnail))
+	require.NoError(t, err)
+	assert.Equal(t, 160, thumbnail.Width)
+
+	// 图片头完好但数据被截断时只能在完整解码时发现
+	truncated := valid[:len(valid)/2]
+	_, err = svc.validator.ValidateImage(truncated)
+	require.NoError(t, err)
+	err = svc.analyze(context.Background(), &decisionInput{image: &DecisionImage{Data: truncated}})
+	var vErr *ValidationError
+	require.ErrorAs(t, err, &vErr)
+	assert.Equal(t, CodeImageUndecodable, vErr.Code)
+}
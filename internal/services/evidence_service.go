@@ -0,0 +1,284 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"path"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/imaging"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/storage"
+	"sort"
+	"time"
+)
+
+const (
+	// evidenceTelemetryWindow 是证据包中包含的决策前后遥测轨迹的时间范围
+	evidenceTelemetryWindow = 5 * time.Minute
+	// evidenceCommandWindow 是证据包中包含的决策前后指令的时间范围
+	evidenceCommandWindow = 15 * time.Minute
+)
+
+var (
+	// 叠加图中模型检测框与人工标注框的颜色
+	detectionColor = color.RGBA{R: 255, G: 32, B: 32, A: 255}
+	labelColor     = color.RGBA{R: 32, G: 224, B: 64, A: 255}
+)
+
+// 证据包布局：
+//
+//	image/original.<ext>   车辆上传的原始图片
+//	image/overlay.png      原图叠加模型检测框 (红) 与人工标注框 (绿)，没有任何框时省略
+//	request_metadata.json  车辆随请求上报的元数据 (原样保存)
+//	server_decision.json   服务端返回的决策 (原样保存，含模型版本)
+//	label.json             操作员标注 (如有)
+//	telemetry.json         决策前后 evidenceTelemetryWindow 内的遥测轨迹
+//	commands.json          决策前后 evidenceCommandWindow 内下发给该车辆的指令
+//	manifest.json          证据包说明及上述每个文件的 SHA-256
+//	SHA256SUMS             与 manifest 相同的校验和，可直接用 sha256sum -c 校验
+
+// EvidenceFile 是证据包中一个文件的校验信息
+type EvidenceFile struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// EvidenceManifest 描述证据包的来源和内容
+type EvidenceManifest struct {
+	DecisionID        string         `json:"decision_id"`
+	VehicleID         string         `json:"vehicle_id"`
+	DecisionTimestamp time.Time      `json:"decision_timestamp"`
+	ModelVersion      string         `json:"model_version,omitempty"`
+	ImageKey          string         `json:"image_key,omitempty"`
+	TelemetryWindow   [2]time.Time   `json:"telemetry_window"`
+	CommandWindow     [2]time.Time   `json:"command_window"`
+	GeneratedAt       time.Time      `json:"generated_at"`
+	GeneratedBy       string         `json:"generated_by,omitempty"`
+	Missing           []string       `json:"missing,omitempty"` // 无法取得的内容及原因
+	Files             []EvidenceFile `json:"files"`
+}
+
+// EvidenceService 为单条决策生成用于投诉处理的证据包
+type EvidenceService struct {
+	repo    db.Repository
+	storage storage.ObjectStore
+	access  *AccessService
+}
+
+// NewEvidenceService 创建一个新的 EvidenceService
+func NewEvidenceService(repo db.Repository, storage storage.ObjectStore, access *AccessService) *EvidenceService {
+	return &EvidenceService{repo: repo, storage: storage, access: access}
+}
+
+// EvidenceBundle 是已查询好内容、尚未写出的证据包
+type EvidenceBundle struct {
+	svc       *EvidenceService
+	decision  *models.DecisionLog
+	label     *models.DecisionLabel
+	result    models.DecisionResult
+	manifest  *EvidenceManifest
+	telemetry []*models.VehicleTelemetry
+	commands  []*models.CommandLog
+}
+
+// PrepareBundle 查询证据包所需的数据库内容，决策不存在时返回 ErrDecisionNotFound，
+// generatedBy 无权访问决策所属车辆时返回 ErrAccessDenied。
+// 这些错误在开始写出响应之前返回，之后由 WriteTo 以流的方式写出归档。
+func (s *EvidenceService) PrepareBundle(ctx context.Context, decisionID, generatedBy string) (*EvidenceBundle, error) {
+	decision, err := s.repo.GetDecisionLogByID(ctx, decisionID)
+	if err != nil {
+		return nil, err
+	}
+	if decision == nil {
+		return nil, ErrDecisionNotFound
+	}
+	if err := s.access.CheckVehicleAccess(ctx, generatedBy, decision.VehicleID); err != nil {
+		return nil, err
+	}
+
+	label, err := s.repo.GetDecisionLabel(ctx, decisionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result models.DecisionResult
+	if err := json.Unmarshal(decision.ServerDecision, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode server decision: %w", err)
+	}
+
+	ts := decision.Timestamp
+	manifest := &EvidenceManifest{
+		DecisionID:        decision.ID,
+		VehicleID:         decision.VehicleID,
+		DecisionTimestamp: ts,
+		ModelVersion:      result.ModelVersion,
+		ImageKey:          decision.ImageKey,
+		TelemetryWindow:   [2]time.Time{ts.Add(-evidenceTelemetryWindow), ts.Add(evidenceTelemetryWindow)},
+		CommandWindow:     [2]time.Time{ts.Add(-evidenceCommandWindow), ts.Add(evidenceCommandWindow)},
+		GeneratedAt:       time.Now().UTC(),
+		GeneratedBy:       generatedBy,
+	}
+
+	telemetry, err := s.repo.GetTelemetryByVehicleID(ctx, decision.VehicleID, manifest.TelemetryWindow[0], manifest.TelemetryWindow[1])
+	if err != nil {
+		return nil, err
+	}
+	commands, err := s.repo.ListCommandLogs(ctx, decision.VehicleID, manifest.CommandWindow[0], manifest.CommandWindow[1])
+	if err != nil {
+		return nil, err
+	}
+	if telemetry == nil {
+		telemetry = []*models.VehicleTelemetry{}
+	}
+	if commands == nil {
+		commands = []*models.CommandLog{}
+	}
+
+	return &EvidenceBundle{
+		svc:       s,
+		decision:  decision,
+		label:     label,
+		result:    result,
+		manifest:  manifest,
+		telemetry: telemetry,
+		commands:  commands,
+	}, nil
+}
+
+// WriteTo 将证据包 ZIP 直接写入 w，归档本身不在内存中缓冲 (只有原图及其叠加图需要完整读入)。
+// 原始图片无法取得时仍生成证据包，并在 manifest 的 missing 中注明。
+func (b *EvidenceBundle) WriteTo(ctx context.Context, w io.Writer) error {
+	bundle := &evidenceWriter{zw: zip.NewWriter(w)}
+	manifest := b.manifest
+
+	// 图片与叠加图
+	if original, name, err := b.svc.downloadOriginal(ctx, b.decision.ImageKey); err != nil {
+		manifest.Missing = append(manifest.Missing, fmt.Sprintf("image/original: %v", err))
+	} else {
+		bundle.add("image/original"+path.Ext(name), original)
+		if overlay, err := evidenceOverlay(original, b.result.Detections, b.label); err != nil {
+			manifest.Missing = append(manifest.Missing, fmt.Sprintf("image/overlay.png: %v", err))
+		} else if overlay != nil {
+			bundle.add("image/overlay.png", overlay)
+		}
+	}
+
+	// 元数据与决策保持数据库中的原始字节，便于与日志逐字比对
+	bundle.add("request_metadata.json", b.decision.RequestMetadata)
+	bundle.add("server_decision.json", b.decision.ServerDecision)
+	if b.label != nil {
+		bundle.addJSON("label.json", b.label)
+	}
+	bundle.addJSON("telemetry.json", b.telemetry)
+	bundle.addJSON("commands.json", b.commands)
+
+	// manifest 与校验和文件最后写入，覆盖之前的全部文件
+	manifest.Files = bundle.files
+	sums := bundle.checksums()
+	bundle.addJSON("manifest.json", manifest)
+	bundle.add("SHA256SUMS", sums)
+
+	if bundle.err != nil {
+		return bundle.err
+	}
+	return bundle.zw.Close()
+}
+
+// downloadOriginal 从对象存储下载决策原图
+func (s *EvidenceService) downloadOriginal(ctx context.Context, imageKey string) ([]byte, string, error) {
+	if imageKey == "" {
+		return nil, "", fmt.Errorf("decision has no image")
+	}
+	data, err := storage.GetBytes(ctx, s.storage, decisionImageBucket, imageKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, imageKey, nil
+}
+
+// evidenceOverlay 在原图上绘制模型检测框和人工标注框，没有任何框时返回 nil
+func evidenceOverlay(original []byte, detections []models.BoundingBox, label *models.DecisionLabel) ([]byte, error) {
+	var boxes []imaging.Box
+	for _, d := range detections {
+		boxes = append(boxes, imaging.Box{Rect: boxRect(d), Color: detectionColor})
+	}
+	if label != nil {
+		for _, b := range label.BoundingBoxes {
+			boxes = append(boxes, imaging.Box{Rect: boxRect(b), Color: labelColor})
+		}
+	}
+	if len(boxes) == 0 {
+		return nil, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, err
+	}
+	thickness := max(2, min(img.Bounds().Dx(), img.Bounds().Dy())/200)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, imaging.DrawBoxes(img, boxes, thickness)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func boxRect(b models.BoundingBox) image.Rectangle {
+	return image.Rect(int(b.X), int(b.Y), int(b.X+b.Width), int(b.Y+b.Height))
+}
+
+// evidenceWriter 写入 zip 条目并记录每个文件的 SHA-256，第一次出错后忽略后续写入
+type evidenceWriter struct {
+	zw    *zip.Writer
+	files []EvidenceFile
+	err   error
+}
+
+func (w *evidenceWriter) add(name string, data []byte) {
+	if w.err != nil {
+		return
+	}
+	var f io.Writer
+	if f, w.err = w.zw.Create(name); w.err != nil {
+		return
+	}
+	if _, w.err = f.Write(data); w.err != nil {
+		return
+	}
+	sum := sha256.Sum256(data)
+	w.files = append(w.files, EvidenceFile{Name: name, Size: len(data), SHA256: hex.EncodeToString(sum[:])})
+}
+
+func (w *evidenceWriter) addJSON(name string, v interface{}) {
+	if w.err != nil {
+		return
+	}
+	var data []byte
+	if data, w.err = json.MarshalIndent(v, "", "  "); w.err != nil {
+		return
+	}
+	w.add(name, data)
+}
+
+// checksums 以 sha256sum 的输出格式列出已写入的文件
+func (w *evidenceWriter) checksums() []byte {
+	files := append([]EvidenceFile(nil), w.files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	var buf bytes.Buffer
+	for _, f := range files {
+		fmt.Fprintf(&buf, "%s  %s\n", f.SHA256, f.Name)
+	}
+	return buf.Bytes()
+}
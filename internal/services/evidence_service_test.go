@@ -0,0 +1,54 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"patrol-cloud/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvidenceWriterChecksums(t *testing.T) {
+	var buf bytes.Buffer
+	w := &evidenceWriter{zw: zip.NewWriter(&buf)}
+	w.add("b.json", []byte(`{"b":1}`))
+	w.add("a.txt", []byte("hello"))
+	sums := string(w.checksums())
+	require.NoError(t, w.err)
+	require.NoError(t, w.zw.Close())
+
+	lines := strings.Split(strings.TrimSpace(sums), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasSuffix(lines[0], "  a.txt"))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+
+		sum := sha256.Sum256(data)
+		assert.Contains(t, sums, hex.EncodeToString(sum[:])+"  "+f.Name)
+	}
+}
+
+func TestEvidenceOverlay(t *testing.T) {
+	original := encodePNG(t, 64, 64)
+
+	overlay, err := evidenceOverlay(original, nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, overlay)
+
+	overlay, err = evidenceOverlay(original, []models.BoundingBox{{Class: "bottle", X: 8, Y: 8, Width: 20, Height: 20}}, nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, overlay)
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/geo"
+	"patrol-cloud/internal/models"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultHotspotRadius 是聚类邻域半径的默认值 (米)
+	DefaultHotspotRadius = 30.0
+	// DefaultHotspotMinPoints 是构成热点所需的最少决策数的默认值
+	DefaultHotspotMinPoints = 5
+)
+
+var ErrInvalidHotspotQuery = errors.New("invalid hotspot query")
+
+// HotspotQuery 描述热点聚类的范围和参数
+type HotspotQuery struct {
+	StartTime    time.Time
+	EndTime      time.Time
+	Action       string  // 为空时包含所有动作
+	RadiusMeters float64 // DBSCAN 邻域半径
+	MinPoints    int     // DBSCAN 核心点的最少邻居数
+}
+
+// HotspotService 将已定位的决策聚类为垃圾热点
+type HotspotService struct {
+	repo db.Repository
+}
+
+// NewHotspotService 创建一个新的 HotspotService
+func NewHotspotService(repo db.Repository) *HotspotService {
+	return &HotspotService{repo: repo}
+}
+
+// Hotspots 对时间范围内的决策位置进行 DBSCAN 聚类，每个簇输出为一个 GeoJSON 点要素，
+// 坐标为簇的中心，属性中包含决策数、覆盖半径、时间范围以及动作和类别的分布。
+// 要素按决策数从多到少排列，噪声点不输出。
+func (s *HotspotService) Hotspots(ctx context.Context, q HotspotQuery) (*geo.FeatureCollection, error) {
+	if q.EndTime.Before(q.StartTime) || q.RadiusMeters <= 0 || q.MinPoints < 1 {
+		return nil, ErrInvalidHotspotQuery
+	}
+
+	points, err := s.repo.ListDecisionPoints(ctx, q.StartTime, q.EndTime, q.Action)
+	if err != nil {
+		return nil, err
+	}
+	return buildHotspots(points, q.RadiusMeters, q.MinPoints), nil
+}
+
+// buildHotspots 聚类并生成 GeoJSON
+func buildHotspots(points []*models.DecisionPoint, radius float64, minPoints int) *geo.FeatureCollection {
+	positions := make([]models.Position, len(points))
+	for i, p := range points {
+		positions[i] = p.Position
+	}
+	labels := geo.DBSCAN(positions, radius, minPoints)
+
+	clusters := make(map[int][]*models.DecisionPoint)
+	for i, label := range labels {
+		if label != geo.Noise {
+			clusters[label] = append(clusters[label], points[i])
+		}
+	}
+
+	features := make([]*geo.Feature, 0, len(clusters))
+	for _, members := range clusters {
+		features = append(features, hotspotFeature(members))
+	}
+	sort.SliceStable(features, func(i, j int) bool {
+		return features[i].Properties["count"].(int) > features[j].Properties["count"].(int)
+	})
+
+	fc := geo.NewFeatureCollection()
+	for i, f := range features {
+		f.Properties["hotspot_id"] = i
+		fc.Features = append(fc.Features, f)
+	}
+	return fc
+}
+
+// hotspotFeature 汇总一个簇的属性
+func hotspotFeature(members []*models.DecisionPoint) *geo.Feature {
+	positions := make([]models.Position, len(members))
+	actions := make(map[string]int)
+	classes := make(map[string]int)
+	vehicles := make(map[string]struct{})
+	firstSeen, lastSeen := members[0].Timestamp, members[0].Timestamp
+	for i, m := range members {
+		positions[i] = m.Position
+		actions[m.Action]++
+		if m.Class != "" {
+			classes[m.Class]++
+		}
+		vehicles[m.VehicleID] = struct{}{}
+		if m.Timestamp.Before(firstSeen) {
+			firstSeen = m.Timestamp
+		}
+		if m.Timestamp.After(lastSeen) {
+			lastSeen = m.Timestamp
+		}
+	}
+
+	center := geo.Centroid(positions)
+	radius := 0.0
+	for _, p := range positions {
+		radius = math.Max(radius, geo.Distance(center, p))
+	}
+
+	return geo.NewPointFeature(center, map[string]interface{}{
+		"count":      len(members),
+		"radius_m":   math.Round(radius*10) / 10,
+		"vehicles":   len(vehicles),
+		"actions":    actions,
+		"classes":    classes,
+		"first_seen": firstSeen,
+		"last_seen":  lastSeen,
+	})
+}
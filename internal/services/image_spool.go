@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"patrol-cloud/internal/queue"
+	"patrol-cloud/internal/storage"
+	"time"
+)
+
+// TaskKindImageUpload 是暂存在本地磁盘、等待上传的决策图片 (发件箱模式下的所有图片，以及上传失败的图片)，
+// Payload 为 SpooledImage。暂存目录是副本本地的，因此使用本地任务队列而不是发件箱。
+const TaskKindImageUpload = "image_upload"
+
+// errDecisionNotLogged 表示图片上传成功但决策日志尚未写入 (其写入任务可能仍在队列中)，稍后重试
+var errDecisionNotLogged = errors.New("decision log not written yet")
+
+// SpooledImage 描述一张暂存在本地的决策图片，同时以 <object>.json 的形式保存在图片旁边，
+// 即使任务队列丢失也能从暂存目录中找回证据
+type SpooledImage struct {
+	DecisionID  string    `json:"decision_id"`
+	VehicleID   string    `json:"vehicle_id"`
+	ObjectName  string    `json:"object_name"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	SpooledAt   time.Time `json:"spooled_at"`
+	UploadError string    `json:"upload_error,omitempty"`
+}
+
+// ImageSpool 将等待上传的决策图片写入本地目录
+type ImageSpool struct {
+	dir string
+}
+
+// NewImageSpool 创建暂存目录
+func NewImageSpool(dir string) (*ImageSpool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &ImageSpool{dir: dir}, nil
+}
+
+func (s *ImageSpool) imagePath(objectName string) string {
+	return filepath.Join(s.dir, filepath.Base(objectName))
+}
+
+// Write 持久化图片及其元数据，返回前已 fsync
+func (s *ImageSpool) Write(meta *SpooledImage, data []byte) error {
+	metaBytes, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileSync(s.imagePath(meta.ObjectName), data); err != nil {
+		return err
+	}
+	return writeFileSync(s.imagePath(meta.ObjectName)+".json", metaBytes)
+}
+
+// Read 读取暂存的图片
+func (s *ImageSpool) Read(meta *SpooledImage) ([]byte, error) {
+	return os.ReadFile(s.imagePath(meta.ObjectName))
+}
+
+// Remove 删除暂存的图片及元数据，文件不存在时不视为错误
+func (s *ImageSpool) Remove(meta *SpooledImage) error {
+	for _, p := range []string{s.imagePath(meta.ObjectName), s.imagePath(meta.ObjectName) + ".json"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// EnableImageSpool 让图片暂存到本地并通过任务队列上传，未开启时上传失败的图片会被丢弃，发件箱也不会启用
+func (s *DecisionService) EnableImageSpool(spool *ImageSpool) {
+	s.spool = spool
+}
+
+// spoolImage 暂存上传失败的图片并登记重传任务，返回是否成功
+func (s *DecisionService) spoolImage(decisionID, vehicleID, objectName string, img *DecisionImage, uploadErr error) bool {
+	if s.spool == nil {
+		return false
+	}
+	meta := &SpooledImage{
+		DecisionID:  decisionID,
+		VehicleID:   vehicleID,
+		ObjectName:  objectName,
+		ContentType: img.ContentType,
+		Size:        len(img.Data),
+		SpooledAt:   time.Now().UTC(),
+		UploadError: uploadErr.Error(),
+	}
+	if err := s.enqueueUpload(meta, img.Data); err != nil {
+		log.Printf(
+			"level=critical msg=\"could not spool decision image, image is lost\" image_id=%s vehicle_id=%s error=\"%v\"",
+			decisionID,
+			vehicleID,
+			err,
+		)
+		return false
+	}
+	log.Printf("level=warn msg=\"decision image spooled for retry\" image_id=%s vehicle_id=%s", decisionID, vehicleID)
+	return true
+}
+
+// enqueueUpload 将图片写入暂存目录并登记上传任务，二者都只涉及本地磁盘
+func (s *DecisionService) enqueueUpload(meta *SpooledImage, data []byte) error {
+	if err := s.spool.Write(meta, data); err != nil {
+		return err
+	}
+	_, err := s.taskQueue.Enqueue(TaskKindImageUpload, meta)
+	return err
+}
+
+// HandleImageUploadTask 上传暂存的图片，生成派生图，并将对象名写回决策日志。
+// 每一步都可重复执行：重复上传会覆盖同名对象，写回对象名是幂等的。
+func (s *DecisionService) HandleImageUploadTask(ctx context.Context, task *queue.Task) error {
+	var meta SpooledImage
+	if err := task.Decode(&meta); err != nil {
+		return err
+	}
+	if s.spool == nil {
+		return errors.New("image spool is not enabled")
+	}
+	data, err := s.spool.Read(&meta)
+	if err != nil {
+		return fmt.Errorf("failed to read spooled image: %w", err)
+	}
+
+	if _, err := storage.PutBytes(ctx, s.uploader, decisionImageBucket, meta.ObjectName, data, meta.ContentType); err != nil {
+		return err
+	}
+	var thumbnailKey, previewKey string
+	if derivatives, err := decodeDerivatives(data); err == nil {
+		thumbnailKey, previewKey = s.uploadDerivatives(ctx, meta.DecisionID, derivatives)
+	}
+
+	updated, err := s.repo.UpdateDecisionImageKeys(ctx, meta.DecisionID, meta.ObjectName, thumbnailKey, previewKey)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return errDecisionNotLogged
+	}
+
+	if err := s.spool.Remove(&meta); err != nil {
+		log.Printf("level=warn msg=\"failed to remove spooled image\" image_id=%s error=\"%v\"", meta.DecisionID, err)
+	}
+	log.Printf("level=info msg=\"spooled decision image uploaded\" image_id=%s attempts=%d", meta.DecisionID, task.Attempts+1)
+	return nil
+}
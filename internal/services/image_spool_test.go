@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/queue"
+	"patrol-cloud/internal/storage"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// spoolRepo 记录补传后写回的对象名，logged 为 false 时模拟决策日志尚未写入
+type spoolRepo struct {
+	db.Repository
+	logged bool
+	keys   [3]string
+}
+
+func (r *spoolRepo) UpdateDecisionImageKeys(ctx context.Context, decisionID, imageKey, thumbnailKey, previewKey string) (bool, error) {
+	if !r.logged {
+		return false, nil
+	}
+	r.keys = [3]string{imageKey, thumbnailKey, previewKey}
+	return true, nil
+}
+
+func TestHandleImageUploadTask(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8888/objects", []byte("secret"))
+	require.NoError(t, err)
+	spool, err := NewImageSpool(t.TempDir())
+	require.NoError(t, err)
+	q, err := queue.Open(t.TempDir(), queue.Options{})
+	require.NoError(t, err)
+	defer q.Close()
+
+	repo := &spoolRepo{}
+	svc := NewDecisionService(nil, repo, store, q)
+	svc.EnableImageSpool(spool)
+
+	png := encodePNG(t, 800, 600)
+	img := &DecisionImage{Data: png, ContentType: "image/png", Extension: ".png"}
+	require.True(t, svc.spoolImage("img-1", "v1", "img-1.png", img, errors.New("minio down")))
+
+	tasks := q.List(queue.StatePending)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, TaskKindImageUpload, tasks[0].Kind)
+
+	// 决策日志尚未写入时保留暂存文件，稍后重试
+	assert.ErrorIs(t, svc.HandleImageUploadTask(ctx, tasks[0]), errDecisionNotLogged)
+	_, err = os.Stat(spool.imagePath("img-1.png"))
+	require.NoError(t, err)
+
+	repo.logged = true
+	require.NoError(t, svc.HandleImageUploadTask(ctx, tasks[0]))
+	assert.Equal(t, [3]string{"img-1.png", "thumbnails/img-1.jpg", "previews/img-1.jpg"}, repo.keys)
+
+	data, err := storage.GetBytes(ctx, store, decisionImageBucket, "img-1.png")
+	require.NoError(t, err)
+	assert.Equal(t, png, data)
+	_, err = os.Stat(spool.imagePath("img-1.png"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(spool.imagePath("img-1.png") + ".json")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"patrol-cloud/internal/metrics"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInferenceQueueFull 表示推理队列已满，请求应被快速拒绝 (503) 而不是继续排队
+	ErrInferenceQueueFull = errors.New("inference queue is full")
+	// ErrInferencePoolClosed 表示推理池已关闭 (服务正在停止)
+	ErrInferencePoolClosed = errors.New("inference pool is closed")
+)
+
+// inferenceJob 是排队等待推理的一项工作
+type inferenceJob struct {
+	ctx        context.Context
+	enqueuedAt time.Time
+	run        func()
+	done       chan error
+}
+
+// InferencePool 以固定数量的 worker 执行推理，队列有界，并且不会执行已超过截止时间的请求
+type InferencePool struct {
+	jobs    chan *inferenceJob
+	workers int
+
+	mu     sync.RWMutex // 保护 closed，避免 Close 之后向 jobs 发送
+	closed bool
+
+	queueWait     *metrics.Histogram
+	inferenceTime *metrics.Histogram
+	rejected      *metrics.Counter
+	expired       *metrics.Counter
+}
+
+// NewInferencePool 创建推理池并立即启动 workers 个 worker
+func NewInferencePool(workers, queueSize int) *InferencePool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	p := &InferencePool{
+		jobs:          make(chan *inferenceJob, queueSize),
+		workers:       workers,
+		queueWait:     metrics.Default.Histogram("inference.queue_wait", metrics.DefaultLatencyBounds),
+		inferenceTime: metrics.Default.Histogram("inference.duration", metrics.DefaultLatencyBounds),
+		rejected:      metrics.Default.Counter("inference.rejected"),
+		expired:       metrics.Default.Counter("inference.expired"),
+	}
+	metrics.Default.GaugeFunc("inference.queue_depth", func() interface{} { return len(p.jobs) })
+	metrics.Default.GaugeFunc("inference.queue_capacity", func() interface{} { return cap(p.jobs) })
+
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+// Do 将 fn 放入队列并等待其执行完成。
+// 队列已满时立即返回 ErrInferenceQueueFull，已关闭时返回 ErrInferencePoolClosed；
+// ctx 在执行前或执行中到期时返回 ctx.Err()。
+func (p *InferencePool) Do(ctx context.Context, fn func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	job := &inferenceJob{
+		ctx:        ctx,
+		enqueuedAt: time.Now(),
+		run:        fn,
+		done:       make(chan error, 1),
+	}
+
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrInferencePoolClosed
+	}
+	select {
+	case p.jobs <- job:
+	default:
+		p.mu.RUnlock()
+		p.rejected.Inc()
+		return ErrInferenceQueueFull
+	}
+	p.mu.RUnlock()
+
+	select {
+	case err := <-job.done:
+		return err
+	case <-ctx.Done():
+		// worker 仍可能在执行 fn，其结果将被丢弃
+		return ctx.Err()
+	}
+}
+
+// RetryAfter 估算队列排空所需的时间，用于 503 响应的 Retry-After 头
+func (p *InferencePool) RetryAfter() time.Duration {
+	estimate := time.Duration(len(p.jobs)+1) * p.inferenceTime.Mean() / time.Duration(p.workers)
+	if estimate < time.Second {
+		return time.Second
+	}
+	return estimate
+}
+
+// Close 停止接收新的任务，已在队列中的任务仍会被执行。可重复调用。
+func (p *InferencePool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+}
+
+// worker 依次执行队列中的任务，跳过等待期间已经过期的请求
+func (p *InferencePool) worker() {
+	for job := range p.jobs {
+		p.queueWait.Observe(time.Since(job.enqueuedAt))
+
+		if err := job.ctx.Err(); err != nil {
+			p.expired.Inc()
+			job.done <- err
+			continue
+		}
+
+		start := time.Now()
+		job.run()
+		p.inferenceTime.Observe(time.Since(start))
+		job.done <- nil
+	}
+}
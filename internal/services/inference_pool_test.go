@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferencePoolLimitsConcurrency(t *testing.T) {
+	p := NewInferencePool(2, 10)
+	defer p.Close()
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.Do(context.Background(), func() {
+				n := running.Add(1)
+				for {
+					old := peak.Load()
+					if n <= old || peak.CompareAndSwap(old, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 2, peak.Load())
+}
+
+func TestInferencePoolQueueFullAndTimeout(t *testing.T) {
+	p := NewInferencePool(1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	// 占住唯一的 worker，再填满长度为 1 的队列
+	go p.Do(context.Background(), func() { close(started); <-release })
+	<-started
+	queuedCtx, cancelQueued := context.WithCancel(context.Background())
+	queued := make(chan error, 1)
+	go func() { queued <- p.Do(queuedCtx, func() { t.Error("expired job must not run") }) }()
+	require.Eventually(t, func() bool { return len(p.jobs) == 1 }, time.Second, time.Millisecond)
+
+	assert.ErrorIs(t, p.Do(context.Background(), func() {}), ErrInferenceQueueFull)
+	assert.GreaterOrEqual(t, p.RetryAfter(), time.Second)
+
+	// 排队期间到期的请求立即返回，worker 之后跳过它
+	cancelQueued()
+	assert.ErrorIs(t, <-queued, context.Canceled)
+	expired := p.expired.Value()
+	close(release)
+	require.Eventually(t, func() bool { return p.expired.Value() == expired+1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.Do(ctx, func() { time.Sleep(50 * time.Millisecond) }), context.DeadlineExceeded)
+
+	p.Close()
+	p.Close()
+	assert.ErrorIs(t, p.Do(context.Background(), func() {}), ErrInferencePoolClosed)
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"sort"
+	"time"
+)
+
+var (
+	ErrDecisionNotFound = errors.New("decision log not found")
+	ErrInvalidLabel     = errors.New("invalid label")
+)
+
+// LabelService 管理操作员对决策日志的真实标注，并据此评估模型表现。
+// 读写标注需要有权访问决策所属的车辆。
+type LabelService struct {
+	repo   db.Repository
+	access *AccessService
+}
+
+// NewLabelService 创建一个新的 LabelService
+func NewLabelService(repo db.Repository, access *AccessService) *LabelService {
+	return &LabelService{repo: repo, access: access}
+}
+
+// checkDecisionAccess 在决策不存在时返回 ErrDecisionNotFound，用户无权访问其车辆时返回 ErrAccessDenied
+func (s *LabelService) checkDecisionAccess(ctx context.Context, decisionID, userID string) error {
+	decision, err := s.repo.GetDecisionLogByID(ctx, decisionID)
+	if err != nil {
+		return err
+	}
+	if decision == nil {
+		return ErrDecisionNotFound
+	}
+	return s.access.CheckVehicleAccess(ctx, userID, decision.VehicleID)
+}
+
+// LabelDecision 为一条决策写入 (或覆盖) 标注，labelledBy 为当前操作员的用户 ID
+func (s *LabelService) LabelDecision(ctx context.Context, decisionID, labelledBy string, req models.LabelDecisionRequest) (*models.DecisionLabel, error) {
+	for i, box := range req.BoundingBoxes {
+		if box.Width <= 0 || box.Height <= 0 {
+			return nil, fmt.Errorf("%w: bounding box %d: width and height must be positive", ErrInvalidLabel, i)
+		}
+		if box.X < 0 || box.Y < 0 {
+			return nil, fmt.Errorf("%w: bounding box %d: x and y must not be negative", ErrInvalidLabel, i)
+		}
+	}
+
+	if err := s.checkDecisionAccess(ctx, decisionID, labelledBy); err != nil {
+		return nil, err
+	}
+
+	label := &models.DecisionLabel{
+		DecisionID:     decisionID,
+		CorrectAction:  req.CorrectAction,
+		CorrectedClass: req.CorrectedClass,
+		BoundingBoxes:  req.BoundingBoxes,
+		Notes:          req.Notes,
+		LabelledBy:     labelledBy,
+	}
+	if label.BoundingBoxes == nil {
+		label.BoundingBoxes = []models.BoundingBox{}
+	}
+	if err := s.repo.UpsertDecisionLabel(ctx, label); err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+// GetLabel 返回一条决策的标注，未标注时返回 nil
+func (s *LabelService) GetLabel(ctx context.Context, decisionID, userID string) (*models.DecisionLabel, error) {
+	if err := s.checkDecisionAccess(ctx, decisionID, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetDecisionLabel(ctx, decisionID)
+}
+
+// DeleteLabel 删除一条决策的标注
+func (s *LabelService) DeleteLabel(ctx context.Context, decisionID, userID string) (bool, error) {
+	if err := s.checkDecisionAccess(ctx, decisionID, userID); err != nil {
+		return false, err
+	}
+	return s.repo.DeleteDecisionLabel(ctx, decisionID)
+}
+
+// ModelMetrics 计算时间范围内每个模型版本在已标注决策上的精确率与召回率
+func (s *LabelService) ModelMetrics(ctx context.Context, startTime, endTime time.Time) ([]*models.ModelMetrics, error) {
+	labelled, err := s.repo.ListLabelledDecisions(ctx, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	return computeModelMetrics(labelled), nil
+}
+
+// confusionCounter 按取值累计 TP / FP / FN
+type confusionCounter map[string]*models.LabelMetrics
+
+func (c confusionCounter) get(label string) *models.LabelMetrics {
+	m, ok := c[label]
+	if !ok {
+		m = &models.LabelMetrics{Label: label}
+		c[label] = m
+	}
+	return m
+}
+
+// observe 记录一次 (预测值, 真实值) 观测
+func (c confusionCounter) observe(predicted, actual string) {
+	if predicted == actual {
+		c.get(predicted).TruePositives++
+		return
+	}
+	c.get(predicted).FalsePositives++
+	c.get(actual).FalseNegatives++
+}
+
+// finalize 计算精确率与召回率，并按取值排序输出
+func (c confusionCounter) finalize() []*models.LabelMetrics {
+	metrics := make([]*models.LabelMetrics, 0, len(c))
+	for _, m := range c {
+		if predicted := m.TruePositives + m.FalsePositives; predicted > 0 {
+			m.Precision = float64(m.TruePositives) / float64(predicted)
+		}
+		if actual := m.TruePositives + m.FalseNegatives; actual > 0 {
+			m.Recall = float64(m.TruePositives) / float64(actual)
+		}
+		metrics = append(metrics, m)
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Label < metrics[j].Label })
+	return metrics
+}
+
+// computeModelMetrics 按模型版本聚合动作与类别两个维度的混淆统计
+func computeModelMetrics(labelled []*models.LabelledDecision) []*models.ModelMetrics {
+	type modelCounters struct {
+		metrics *models.ModelMetrics
+		correct int
+		actions confusionCounter
+		classes confusionCounter
+	}
+
+	byModel := make(map[string]*modelCounters)
+	for _, ld := range labelled {
+		version := ld.Decision.ModelVersion
+		if version == "" {
+			version = "unknown"
+		}
+		mc, ok := byModel[version]
+		if !ok {
+			mc = &modelCounters{
+				metrics: &models.ModelMetrics{ModelVersion: version},
+				actions: confusionCounter{},
+				classes: confusionCounter{},
+			}
+			byModel[version] = mc
+		}
+
+		mc.metrics.Labelled++
+		mc.actions.observe(ld.Decision.Action, ld.Label.CorrectAction)
+		if ld.Decision.Action == ld.Label.CorrectAction {
+			mc.correct++
+		}
+
+		// 未填写更正类别时视为模型给出的类别正确
+		actualClass := ld.Label.CorrectedClass
+		if actualClass == "" {
+			actualClass = ld.Decision.Class
+		}
+		if ld.Decision.Class != "" || actualClass != "" {
+			mc.classes.observe(ld.Decision.Class, actualClass)
+		}
+	}
+
+	result := make([]*models.ModelMetrics, 0, len(byModel))
+	for _, mc := range byModel {
+		mc.metrics.ActionAccuracy = float64(mc.correct) / float64(mc.metrics.Labelled)
+		mc.metrics.Actions = mc.actions.finalize()
+		mc.metrics.Classes = mc.classes.finalize()
+		result = append(result, mc.metrics)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ModelVersion < result[j].ModelVersion })
+	return result
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// labelRepo 中有一条车辆 v1 的决策，只有 op1 被授权访问 v1
+type labelRepo struct {
+	db.Repository
+	label *models.DecisionLabel
+}
+
+func (r *labelRepo) GetDecisionLogByID(ctx context.Context, id string) (*models.DecisionLog, error) {
+	if id != "d1" {
+		return nil, nil
+	}
+	return &models.DecisionLog{ID: id, VehicleID: "v1"}, nil
+}
+
+func (r *labelRepo) UserCanAccessVehicle(ctx context.Context, userID, vehicleID string) (bool, error) {
+	return userID == "op1" && vehicleID == "v1", nil
+}
+
+func (r *labelRepo) UpsertDecisionLabel(ctx context.Context, label *models.DecisionLabel) error {
+	r.label = label
+	return nil
+}
+
+func (r *labelRepo) GetDecisionLabel(ctx context.Context, decisionID string) (*models.DecisionLabel, error) {
+	return r.label, nil
+}
+
+func (r *labelRepo) DeleteDecisionLabel(ctx context.Context, decisionID string) (bool, error) {
+	deleted := r.label != nil
+	r.label = nil
+	return deleted, nil
+}
+
+func TestLabelAccess(t *testing.T) {
+	ctx := context.Background()
+	repo := &labelRepo{}
+	svc := NewLabelService(repo, NewAccessService(repo))
+	req := models.LabelDecisionRequest{CorrectAction: "pickup"}
+
+	_, err := svc.LabelDecision(ctx, "d1", "op2", req)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	assert.Nil(t, repo.label)
+	_, err = svc.LabelDecision(ctx, "missing", "op1", req)
+	assert.ErrorIs(t, err, ErrDecisionNotFound)
+
+	_, err = svc.LabelDecision(ctx, "d1", "op1", req)
+	require.NoError(t, err)
+	_, err = svc.GetLabel(ctx, "d1", "op2")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	_, err = svc.DeleteLabel(ctx, "d1", "op2")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	assert.NotNil(t, repo.label, "label survives a denied delete")
+
+	deleted, err := svc.DeleteLabel(ctx, "d1", "op1")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+}
+
+func TestComputeModelMetrics(t *testing.T) {
+	labelled := func(model, action, class, correctAction, correctedClass string) *models.LabelledDecision {
+		return &models.LabelledDecision{
+			Decision: &models.DecisionResult{ModelVersion: model, Action: action, Class: class},
+			Label:    &models.DecisionLabel{CorrectAction: correctAction, CorrectedClass: correctedClass},
+		}
+	}
+
+	metrics := computeModelMetrics([]*models.LabelledDecision{
+		labelled("v1", "pickup", "bottle", "pickup", ""),
+		labelled("v1", "pickup", "bottle", "pickup", "can"),
+		labelled("v1", "pickup", "leaf", "ignore", ""),
+		labelled("v1", "ignore", "leaf", "pickup", "bottle"),
+		labelled("", "pickup", "", "pickup", ""),
+	})
+	assert.Len(t, metrics, 2)
+
+	unknown := metrics[0]
+	assert.Equal(t, "unknown", unknown.ModelVersion)
+	assert.Empty(t, unknown.Classes)
+
+	v1 := metrics[1]
+	assert.Equal(t, 4, v1.Labelled)
+	assert.InDelta(t, 0.5, v1.ActionAccuracy, 1e-9)
+
+	// pickup: TP=2, FP=1 (predicted pickup, actually ignore), FN=1 (predicted ignore, actually pickup)
+	pickup := v1.Actions[1]
+	assert.Equal(t, "pickup", pickup.Label)
+	assert.InDelta(t, 2.0/3.0, pickup.Precision, 1e-9)
+	assert.InDelta(t, 2.0/3.0, pickup.Recall, 1e-9)
+
+	// bottle: TP=1, FP=1 (corrected to can), FN=1 (leaf corrected to bottle)
+	bottle := v1.Classes[0]
+	assert.Equal(t, "bottle", bottle.Label)
+	assert.InDelta(t, 0.5, bottle.Precision, 1e-9)
+	assert.InDelta(t, 0.5, bottle.Recall, 1e-9)
+}
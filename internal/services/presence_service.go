@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/metrics"
+	"patrol-cloud/internal/models"
+	"sync"
+	"time"
+)
+
+// PresenceThresholds 决定车辆多久没有消息后被视为 stale 和 offline
+type PresenceThresholds struct {
+	StaleAfter   time.Duration
+	OfflineAfter time.Duration
+}
+
+// DefaultPresenceThresholds 适用于 1 Hz 上报的车辆
+var DefaultPresenceThresholds = PresenceThresholds{
+	StaleAfter:   15 * time.Second,
+	OfflineAfter: time.Minute,
+}
+
+// presenceEntry 是一辆车的在线状态跟踪信息
+type presenceEntry struct {
+	lastSeen  time.Time // 最后一次收到该车辆任何消息的时间
+	offlineAt time.Time // 最后一次收到离线遗嘱消息的时间
+	state     string    // 最近一次 Sweep 计算出的状态
+	dirty     bool      // lastSeen 尚未写入数据库
+}
+
+// PresenceService 根据车辆消息的到达时间和 MQTT 遗嘱消息跟踪车辆的在线状态，
+// 由后台定期调用 Sweep 推送状态变化并持久化最后在线时间
+type PresenceService struct {
+	repo       db.Repository
+	thresholds PresenceThresholds
+	broadcast  chan<- []byte // (可选) 推向 TelemetryHub
+
+	mu          sync.Mutex
+	vehicles    map[string]*presenceEntry
+	persistedAt time.Time // 最后一次写入最后在线时间的时刻
+
+	broadcastDropped *metrics.Counter
+}
+
+// NewPresenceService 创建一个新的 PresenceService
+func NewPresenceService(repo db.Repository, thresholds PresenceThresholds, broadcast chan<- []byte) *PresenceService {
+	return &PresenceService{
+		repo:             repo,
+		thresholds:       thresholds,
+		broadcast:        broadcast,
+		vehicles:         make(map[string]*presenceEntry),
+		broadcastDropped: metrics.Default.Counter("presence.broadcast_dropped"),
+	}
+}
+
+// Load 从数据库恢复各车辆的最后在线时间，启动时调用一次
+func (s *PresenceService) Load(ctx context.Context, now time.Time) error {
+	lastSeen, err := s.repo.ListVehicleLastSeen(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range lastSeen {
+		e := s.entry(id)
+		if t.After(e.lastSeen) {
+			e.lastSeen = t
+		}
+		e.state = s.compute(e, now)
+	}
+	return nil
+}
+
+// entry 返回车辆的跟踪信息，不存在时创建，调用方需持有锁
+func (s *PresenceService) entry(vehicleID string) *presenceEntry {
+	e, ok := s.vehicles[vehicleID]
+	if !ok {
+		e = &presenceEntry{state: models.PresenceOffline}
+		s.vehicles[vehicleID] = e
+	}
+	return e
+}
+
+// Seen 记录在 at 时刻收到了车辆的消息 (包括未通过校验的状态上报和上线通知)
+func (s *PresenceService) Seen(vehicleID string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entry(vehicleID)
+	if at.After(e.lastSeen) {
+		e.lastSeen = at
+		e.dirty = true
+	}
+}
+
+// MarkOffline 记录在 at 时刻收到了车辆的离线遗嘱消息，之后收到新消息前车辆被视为离线
+func (s *PresenceService) MarkOffline(vehicleID string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entry(vehicleID)
+	if at.After(e.offlineAt) {
+		e.offlineAt = at
+	}
+}
+
+// Presence 返回车辆在 now 时刻的在线状态，从未收到消息的车辆为 offline
+func (s *PresenceService) Presence(vehicleID string, now time.Time) *models.VehiclePresence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.vehicles[vehicleID]
+	if !ok {
+		return &models.VehiclePresence{State: models.PresenceOffline}
+	}
+	return s.presence(e, s.compute(e, now))
+}
+
+// FillPresence 为车辆列表填充在线状态
+func (s *PresenceService) FillPresence(vehicles []*models.Vehicle, now time.Time) {
+	for _, v := range vehicles {
+		v.Presence = s.Presence(v.ID, now)
+	}
+}
+
+func (s *PresenceService) presence(e *presenceEntry, state string) *models.VehiclePresence {
+	p := &models.VehiclePresence{State: state}
+	if !e.lastSeen.IsZero() {
+		lastSeen := e.lastSeen
+		p.LastSeenAt = &lastSeen
+	}
+	return p
+}
+
+// compute 根据最后在线时间和遗嘱消息计算状态，调用方需持有锁
+func (s *PresenceService) compute(e *presenceEntry, now time.Time) string {
+	if e.lastSeen.IsZero() || !e.offlineAt.Before(e.lastSeen) {
+		return models.PresenceOffline
+	}
+	switch age := now.Sub(e.lastSeen); {
+	case age < s.thresholds.StaleAfter:
+		return models.PresenceOnline
+	case age < s.thresholds.OfflineAfter:
+		return models.PresenceStale
+	default:
+		return models.PresenceOffline
+	}
+}
+
+// Sweep 重新计算所有车辆的状态并推送发生变化的状态。
+// 最后在线时间每隔 StaleAfter 才批量写入一次数据库：状态由内存中的时间计算，
+// 数据库中的值只用于重启后恢复，落后不超过 StaleAfter。
+func (s *PresenceService) Sweep(ctx context.Context, now time.Time) error {
+	var updates []models.PresenceUpdate
+
+	s.mu.Lock()
+	for id, e := range s.vehicles {
+		if state := s.compute(e, now); state != e.state {
+			e.state = state
+			updates = append(updates, models.PresenceUpdate{
+				Type:      models.UpdateTypePresence,
+				VehicleID: id,
+				Presence:  *s.presence(e, state),
+			})
+		}
+	}
+	persist := now.Sub(s.persistedAt) >= s.thresholds.StaleAfter
+	s.mu.Unlock()
+
+	for _, update := range updates {
+		log.Printf("level=info msg=\"vehicle presence changed\" vehicle_id=%s state=%s", update.VehicleID, update.Presence.State)
+		s.publish(update)
+	}
+
+	if !persist {
+		return nil
+	}
+	return s.persist(ctx, now)
+}
+
+// Flush 立即写入尚未持久化的最后在线时间，停止服务时调用
+func (s *PresenceService) Flush(ctx context.Context) error {
+	return s.persist(ctx, time.Now())
+}
+
+// persist 将有变化的最后在线时间写入数据库
+func (s *PresenceService) persist(ctx context.Context, now time.Time) error {
+	lastSeen := make(map[string]time.Time)
+	s.mu.Lock()
+	for id, e := range s.vehicles {
+		if e.dirty {
+			lastSeen[id] = e.lastSeen
+			e.dirty = false
+		}
+	}
+	s.persistedAt = now
+	s.mu.Unlock()
+
+	if len(lastSeen) == 0 {
+		return nil
+	}
+	if err := s.repo.UpdateVehicleLastSeen(ctx, lastSeen); err != nil {
+		// 写入失败时保留 dirty 标记，下次 Sweep 重试
+		s.mu.Lock()
+		for id := range lastSeen {
+			s.vehicles[id].dirty = true
+		}
+		s.persistedAt = time.Time{}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// publish 将状态变化推送给 WebSocket 客户端，Hub 处理不过来时丢弃
+func (s *PresenceService) publish(update models.PresenceUpdate) {
+	if s.broadcast == nil {
+		return
+	}
+	data, err := json.Marshal(update)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal presence update for broadcast: %v", err)
+		return
+	}
+	select {
+	case s.broadcast <- data:
+	default:
+		s.broadcastDropped.Inc()
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type presenceRepo struct {
+	db.Repository
+	lastSeen map[string]time.Time
+	fail     bool
+}
+
+func (r *presenceRepo) ListVehicleLastSeen(ctx context.Context) (map[string]time.Time, error) {
+	return r.lastSeen, nil
+}
+
+func (r *presenceRepo) UpdateVehicleLastSeen(ctx context.Context, lastSeen map[string]time.Time) error {
+	if r.fail {
+		return errors.New("database unavailable")
+	}
+	for id, t := range lastSeen {
+		r.lastSeen[id] = t
+	}
+	return nil
+}
+
+func TestPresenceService(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	repo := &presenceRepo{lastSeen: map[string]time.Time{"v1": now.Add(-30 * time.Second)}}
+	broadcast := make(chan []byte, 10)
+	svc := NewPresenceService(repo, DefaultPresenceThresholds, broadcast)
+	require.NoError(t, svc.Load(context.Background(), now))
+
+	// 重启后根据数据库中的最后在线时间恢复状态，不推送
+	assert.Equal(t, models.PresenceStale, svc.Presence("v1", now).State)
+	assert.Equal(t, models.PresenceOffline, svc.Presence("unknown", now).State)
+
+	svc.Seen("v1", now)
+	svc.Seen("v2", now.Add(-time.Second))
+	require.NoError(t, svc.Sweep(context.Background(), now))
+	require.Len(t, broadcast, 2)
+	assert.Equal(t, now, repo.lastSeen["v1"])
+	assert.Equal(t, now.Add(-time.Second), repo.lastSeen["v2"])
+
+	raw := <-broadcast
+	var update models.PresenceUpdate
+	require.NoError(t, json.Unmarshal(raw, &update))
+	assert.Equal(t, models.UpdateTypePresence, update.Type)
+	assert.Equal(t, models.PresenceOnline, update.Presence.State)
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(raw, &fields))
+	assert.NotContains(t, fields, "state", "presence must not reuse the telemetry state key")
+	<-broadcast
+
+	// 遗嘱消息立即使车辆离线，直到再次收到消息
+	svc.MarkOffline("v1", now.Add(time.Second))
+	assert.Equal(t, models.PresenceOffline, svc.Presence("v1", now.Add(time.Second)).State)
+	svc.Seen("v1", now.Add(2*time.Second))
+	assert.Equal(t, models.PresenceOnline, svc.Presence("v1", now.Add(2*time.Second)).State)
+
+	// 超过阈值没有消息时依次变为 stale 和 offline
+	assert.Equal(t, models.PresenceStale, svc.Presence("v2", now.Add(20*time.Second)).State)
+	assert.Equal(t, models.PresenceOffline, svc.Presence("v2", now.Add(2*time.Minute)).State)
+
+	// 最后在线时间每隔 StaleAfter 才写入一次
+	require.NoError(t, svc.Sweep(context.Background(), now.Add(2*time.Second)))
+	assert.Equal(t, now, repo.lastSeen["v1"])
+
+	// 写入失败时下次 Sweep 重试
+	repo.fail = true
+	assert.Error(t, svc.Sweep(context.Background(), now.Add(20*time.Second)))
+	repo.fail = false
+	require.NoError(t, svc.Sweep(context.Background(), now.Add(21*time.Second)))
+	assert.Equal(t, now.Add(2*time.Second), repo.lastSeen["v1"])
+
+	// 停止服务时立即写入
+	svc.Seen("v1", now.Add(22*time.Second))
+	require.NoError(t, svc.Flush(context.Background()))
+	assert.Equal(t, now.Add(22*time.Second), repo.lastSeen["v1"])
+}
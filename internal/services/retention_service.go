@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/storage"
+	"sync"
+	"time"
+)
+
+// DefaultRetentionBatchSize 是每批删除的最大行数 (图片为决策条数)
+const DefaultRetentionBatchSize = 500
+
+// errRetentionStalled 表示一整批决策图片都未能删除，本次执行提前结束
+var errRetentionStalled = errors.New("no decision image in the batch could be deleted")
+
+// RetentionPolicy 描述各类数据的保留期，为 0 表示永久保留
+type RetentionPolicy struct {
+	ImageMaxAge        time.Duration // 决策图片 (原图及派生图)，决策记录本身保留
+	KeepLabelledImages bool          // 已标注的决策图片永久保留 (训练数据)
+	TelemetryMaxAge    time.Duration // 原始遥测，删除前并入小时汇总
+	RollupMaxAge       time.Duration // 遥测小时汇总
+	RejectMaxAge       time.Duration // 被隔离的不合法状态上报
+	BatchSize          int
+}
+
+// DefaultRetentionPolicy 是默认的保留策略
+var DefaultRetentionPolicy = RetentionPolicy{
+	ImageMaxAge:        90 * 24 * time.Hour,
+	KeepLabelledImages: true,
+	TelemetryMaxAge:    30 * 24 * time.Hour,
+	RollupMaxAge:       2 * 365 * 24 * time.Hour,
+	RejectMaxAge:       30 * 24 * time.Hour,
+	BatchSize:          DefaultRetentionBatchSize,
+}
+
+// RetentionCategoryReport 是一类数据的保留情况
+type RetentionCategoryReport struct {
+	MaxAge  string     `json:"max_age"`          // 保留期，永久保留时为 "forever"
+	Cutoff  *time.Time `json:"cutoff,omitempty"` // 早于该时间的数据将被删除
+	Expired int64      `json:"expired"`          // 将被删除的数量
+	Kept    int64      `json:"kept,omitempty"`   // 已过期但按策略保留的数量 (已标注的图片)
+}
+
+// RetentionReport 是保留策略的试运行报告，列出下一次执行将删除的数据
+type RetentionReport struct {
+	GeneratedAt     time.Time               `json:"generated_at"`
+	DecisionImages  RetentionCategoryReport `json:"decision_images"`
+	Telemetry       RetentionCategoryReport `json:"telemetry"`
+	TelemetryRollup RetentionCategoryReport `json:"telemetry_rollups"`
+	TelemetryReject RetentionCategoryReport `json:"telemetry_rejects"`
+	LastRun         *RetentionRun           `json:"last_run,omitempty"`
+}
+
+// RetentionRun 是一次执行的结果
+type RetentionRun struct {
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	ImagesDeleted   int64     `json:"images_deleted"`  // 清除了图片的决策数
+	ObjectsDeleted  int64     `json:"objects_deleted"` // 删除的对象数 (含派生图)
+	TelemetryRolled int64     `json:"telemetry_rolled_up"`
+	RollupsDeleted  int64     `json:"rollups_deleted"`
+	RejectsDeleted  int64     `json:"rejects_deleted"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// RetentionService 按保留策略分批删除过期的决策图片、原始遥测、遥测汇总和被隔离的状态上报
+type RetentionService struct {
+	repo    db.Repository
+	storage storage.ObjectStore
+	policy  RetentionPolicy
+
+	mu      sync.Mutex // 保证同一时间只有一次执行
+	runMu   sync.Mutex // 保护 lastRun，报告不必等待正在进行的执行
+	lastRun *RetentionRun
+}
+
+// NewRetentionService 创建一个新的 RetentionService
+func NewRetentionService(repo db.Repository, storage storage.ObjectStore, policy RetentionPolicy) *RetentionService {
+	if policy.BatchSize <= 0 {
+		policy.BatchSize = DefaultRetentionBatchSize
+	}
+	return &RetentionService{repo: repo, storage: storage, policy: policy}
+}
+
+// Policy 返回当前的保留策略
+func (s *RetentionService) Policy() RetentionPolicy {
+	return s.policy
+}
+
+// cutoff 返回某一保留期对应的截止时间，永久保留时返回 nil
+func cutoff(now time.Time, maxAge time.Duration) *time.Time {
+	if maxAge <= 0 {
+		return nil
+	}
+	t := now.Add(-maxAge)
+	return &t
+}
+
+func describeMaxAge(maxAge time.Duration) string {
+	if maxAge <= 0 {
+		return "forever"
+	}
+	return maxAge.String()
+}
+
+// Report 统计按当前策略将被删除的数据，不做任何修改
+func (s *RetentionService) Report(ctx context.Context, now time.Time) (*RetentionReport, error) {
+	report := &RetentionReport{
+		GeneratedAt:     now.UTC(),
+		DecisionImages:  RetentionCategoryReport{MaxAge: describeMaxAge(s.policy.ImageMaxAge)},
+		Telemetry:       RetentionCategoryReport{MaxAge: describeMaxAge(s.policy.TelemetryMaxAge)},
+		TelemetryRollup: RetentionCategoryReport{MaxAge: describeMaxAge(s.policy.RollupMaxAge)},
+		TelemetryReject: RetentionCategoryReport{MaxAge: describeMaxAge(s.policy.RejectMaxAge)},
+	}
+
+	var err error
+	if c := cutoff(now, s.policy.ImageMaxAge); c != nil {
+		report.DecisionImages.Cutoff = c
+		if report.DecisionImages.Expired, report.DecisionImages.Kept, err = s.repo.CountExpiredDecisionImages(ctx, *c, s.policy.KeepLabelledImages); err != nil {
+			return nil, err
+		}
+	}
+	if c := cutoff(now, s.policy.TelemetryMaxAge); c != nil {
+		report.Telemetry.Cutoff = c
+		if report.Telemetry.Expired, err = s.repo.CountTelemetryBefore(ctx, *c); err != nil {
+			return nil, err
+		}
+	}
+	if c := cutoff(now, s.policy.RollupMaxAge); c != nil {
+		report.TelemetryRollup.Cutoff = c
+		if report.TelemetryRollup.Expired, err = s.repo.CountTelemetryRollupsBefore(ctx, *c); err != nil {
+			return nil, err
+		}
+	}
+	if c := cutoff(now, s.policy.RejectMaxAge); c != nil {
+		report.TelemetryReject.Cutoff = c
+		if report.TelemetryReject.Expired, err = s.repo.CountTelemetryRejectsBefore(ctx, *c); err != nil {
+			return nil, err
+		}
+	}
+
+	s.runMu.Lock()
+	report.LastRun = s.lastRun
+	s.runMu.Unlock()
+	return report, nil
+}
+
+// Run 执行一次保留策略，逐批删除直到没有过期数据或 ctx 被取消
+func (s *RetentionService) Run(ctx context.Context, now time.Time) *RetentionRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run := &RetentionRun{StartedAt: time.Now().UTC()}
+	err := s.run(ctx, now, run)
+	run.FinishedAt = time.Now().UTC()
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	s.runMu.Lock()
+	s.lastRun = run
+	s.runMu.Unlock()
+	return run
+}
+
+func (s *RetentionService) run(ctx context.Context, now time.Time, run *RetentionRun) error {
+	if c := cutoff(now, s.policy.ImageMaxAge); c != nil {
+		if err := s.expireImages(ctx, *c, run); err != nil {
+			return err
+		}
+	}
+	if c := cutoff(now, s.policy.TelemetryMaxAge); c != nil {
+		n, err := deleteInBatches(ctx, func() (int64, error) {
+			return s.repo.RollupAndDeleteTelemetry(ctx, *c, s.policy.BatchSize)
+		})
+		run.TelemetryRolled = n
+		if err != nil {
+			return err
+		}
+	}
+	if c := cutoff(now, s.policy.RollupMaxAge); c != nil {
+		n, err := deleteInBatches(ctx, func() (int64, error) {
+			return s.repo.DeleteTelemetryRollupsBefore(ctx, *c, s.policy.BatchSize)
+		})
+		run.RollupsDeleted = n
+		if err != nil {
+			return err
+		}
+	}
+	if c := cutoff(now, s.policy.RejectMaxAge); c != nil {
+		n, err := deleteInBatches(ctx, func() (int64, error) {
+			return s.repo.DeleteTelemetryRejectsBefore(ctx, *c, s.policy.BatchSize)
+		})
+		run.RejectsDeleted = n
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expireImages 逐批删除过期决策的图片对象，对象全部删除成功后才清空数据库中的对象名，
+// 删除失败的决策留到下一次执行重试。
+func (s *RetentionService) expireImages(ctx context.Context, before time.Time, run *RetentionRun) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch, err := s.repo.ListExpiredDecisionImages(ctx, before, s.policy.KeepLabelledImages, s.policy.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		var cleared []string
+		for _, img := range batch {
+			deleted, err := s.deleteObjects(ctx, img.ImageKey, img.ThumbnailKey, img.PreviewKey)
+			run.ObjectsDeleted += deleted
+			if err != nil {
+				log.Printf("level=warn msg=\"retention: failed to delete decision image\" decision_id=%s error=\"%v\"", img.DecisionID, err)
+				continue
+			}
+			cleared = append(cleared, img.DecisionID)
+		}
+		if len(cleared) == 0 {
+			// 整批都删除失败 (例如对象存储不可用)，避免反复处理同一批
+			return errRetentionStalled
+		}
+		if err := s.repo.ClearDecisionImageKeys(ctx, cleared); err != nil {
+			return err
+		}
+		run.ImagesDeleted += int64(len(cleared))
+		if len(batch) < s.policy.BatchSize {
+			return nil
+		}
+	}
+}
+
+func (s *RetentionService) deleteObjects(ctx context.Context, keys ...string) (int64, error) {
+	var deleted int64
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := s.storage.Delete(ctx, decisionImageBucket, key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// deleteInBatches 重复执行 deleteBatch 直到某一批没有删除任何数据，返回删除总数
+func deleteInBatches(ctx context.Context, deleteBatch func() (int64, error)) (int64, error) {
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := deleteBatch()
+		total += n
+		if err != nil || n == 0 {
+			return total, err
+		}
+	}
+}
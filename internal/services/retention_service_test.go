@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"patrol-cloud/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// retentionRepo 在内存中模拟过期图片的查询和清除，遥测相关方法按批返回预设的数量
+type retentionRepo struct {
+	db.Repository
+	images         []*models.DecisionImageKeys
+	cleared        []string
+	telemetryLeft  int64
+	rollupsDeleted int64
+	rejectsLeft    int64
+}
+
+func (r *retentionRepo) ListExpiredDecisionImages(ctx context.Context, before time.Time, keepLabelled bool, limit int) ([]*models.DecisionImageKeys, error) {
+	var batch []*models.DecisionImageKeys
+	for _, img := range r.images {
+		if img.ImageKey != "" && len(batch) < limit {
+			batch = append(batch, img)
+		}
+	}
+	return batch, nil
+}
+
+func (r *retentionRepo) ClearDecisionImageKeys(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		for _, img := range r.images {
+			if img.DecisionID == id {
+				img.ImageKey, img.ThumbnailKey, img.PreviewKey = "", "", ""
+			}
+		}
+	}
+	r.cleared = append(r.cleared, ids...)
+	return nil
+}
+
+func (r *retentionRepo) RollupAndDeleteTelemetry(ctx context.Context, before time.Time, limit int) (int64, error) {
+	n := min(r.telemetryLeft, int64(limit))
+	r.telemetryLeft -= n
+	return n, nil
+}
+
+func (r *retentionRepo) DeleteTelemetryRollupsBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	r.rollupsDeleted++
+	return 0, nil
+}
+
+func (r *retentionRepo) DeleteTelemetryRejectsBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	n := min(r.rejectsLeft, int64(limit))
+	r.rejectsLeft -= n
+	return n, nil
+}
+
+func TestRetentionServiceRun(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8888/objects", []byte("secret"))
+	require.NoError(t, err)
+
+	repo := &retentionRepo{telemetryLeft: 5, rejectsLeft: 3}
+	for _, id := range []string{"a", "b", "c"} {
+		keys := &models.DecisionImageKeys{DecisionID: id, ImageKey: id + ".png", ThumbnailKey: derivativeObjectName(thumbnailDerivative, id)}
+		repo.images = append(repo.images, keys)
+		_, err := storage.PutBytes(ctx, store, decisionImageBucket, keys.ImageKey, []byte("x"), "image/png")
+		require.NoError(t, err)
+		_, err = storage.PutBytes(ctx, store, decisionImageBucket, keys.ThumbnailKey, []byte("x"), "image/jpeg")
+		require.NoError(t, err)
+	}
+
+	svc := NewRetentionService(repo, store, RetentionPolicy{
+		ImageMaxAge:     time.Hour,
+		TelemetryMaxAge: time.Hour,
+		RejectMaxAge:    time.Hour,
+		BatchSize:       2,
+	})
+	run := svc.Run(ctx, time.Now())
+
+	assert.Empty(t, run.Error)
+	assert.Equal(t, int64(3), run.ImagesDeleted)
+	assert.Equal(t, int64(6), run.ObjectsDeleted)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, repo.cleared)
+	assert.Equal(t, int64(5), run.TelemetryRolled)
+	assert.Equal(t, int64(3), run.RejectsDeleted)
+	assert.Zero(t, repo.rollupsDeleted, "rollups are kept forever when RollupMaxAge is 0")
+
+	objects, err := store.List(ctx, decisionImageBucket, "")
+	require.NoError(t, err)
+	assert.Empty(t, objects)
+}
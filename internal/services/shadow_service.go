@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"log"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/models"
+	"sort"
+	"time"
+)
+
+// shadowMaxConcurrent 限制同时进行的候选模型推理数量，避免影子模式拖慢生效模型
+const shadowMaxConcurrent = 4
+
+// ShadowService 在影子模式下运行候选模型，记录其与生效模型的对比结果
+type ShadowService struct {
+	candidate Recognizer // 为 nil 时仅提供报告查询
+	repo      db.Repository
+	slots     chan struct{}
+}
+
+// NewShadowService 创建一个新的 ShadowService
+func NewShadowService(candidate Recognizer, r db.Repository) *ShadowService {
+	return &ShadowService{
+		candidate: candidate,
+		repo:      r,
+		slots:     make(chan struct{}, shadowMaxConcurrent),
+	}
+}
+
+// Submit 在后台用候选模型评估同一张图片；候选模型繁忙时直接跳过本次评估
+func (s *ShadowService) Submit(active *models.DecisionResult, image []byte, metadata models.DecisionRequestMetadata) {
+	if s.candidate == nil {
+		return
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		log.Printf("level=warn msg=\"shadow evaluation skipped: candidate busy\" image_id=%s", active.ImageID)
+		return
+	}
+
+	// 复制一份生效结果，避免与响应序列化和日志记录共享同一对象
+	activeCopy := *active
+	go func() {
+		defer func() { <-s.slots }()
+		s.evaluate(&activeCopy, image, metadata)
+	}()
+}
+
+// evaluate 执行候选模型推理并持久化对比结果
+func (s *ShadowService) evaluate(active *models.DecisionResult, image []byte, metadata models.DecisionRequestMetadata) {
+	eval := &models.ShadowEvaluation{
+		DecisionID:     active.ImageID,
+		VehicleID:      metadata.VehicleID,
+		ActiveModel:    active.ModelVersion,
+		CandidateModel: s.candidate.ModelVersion(),
+		ActiveResult:   active,
+	}
+
+	candidateResult, err := s.candidate.Recognize(image)
+	if err != nil {
+		eval.CandidateError = err.Error()
+	} else {
+		candidateResult.ImageID = active.ImageID
+		eval.CandidateResult = candidateResult
+		eval.Agreed = decisionsAgree(active, candidateResult)
+	}
+
+	if err := s.repo.CreateShadowEvaluation(context.Background(), eval); err != nil {
+		log.Printf(
+			"level=error msg=\"background task failed: log shadow evaluation\" image_id=%s candidate_model=%s error=\"%v\"",
+			active.ImageID,
+			eval.CandidateModel,
+			err,
+		)
+	}
+}
+
+// decisionsAgree 判断两个模型的决策是否一致 (动作与类别均相同)
+func decisionsAgree(a, b *models.DecisionResult) bool {
+	return a.Action == b.Action && a.Class == b.Class
+}
+
+// Report 汇总时间范围内每一对 (生效模型, 候选模型) 的一致率、置信度分布和分歧样本
+func (s *ShadowService) Report(ctx context.Context, startTime, endTime time.Time, maxSamples int) ([]*models.ShadowPairReport, error) {
+	evals, err := s.repo.ListShadowEvaluations(ctx, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	return buildShadowReport(evals, maxSamples), nil
+}
+
+// buildShadowReport 按模型对聚合评估记录，evals 应按时间倒序排列，以便分歧样本取最近的记录
+func buildShadowReport(evals []*models.ShadowEvaluation, maxSamples int) []*models.ShadowPairReport {
+	type pairKey struct{ active, candidate string }
+
+	pairs := make(map[pairKey]*models.ShadowPairReport)
+	activeConf := make(map[pairKey][]float64)
+	candidateConf := make(map[pairKey][]float64)
+
+	for _, e := range evals {
+		key := pairKey{e.ActiveModel, e.CandidateModel}
+		report, ok := pairs[key]
+		if !ok {
+			report = &models.ShadowPairReport{
+				ActiveModel:    e.ActiveModel,
+				CandidateModel: e.CandidateModel,
+				Disagreements:  []*models.ShadowEvaluation{},
+			}
+			pairs[key] = report
+		}
+
+		report.Total++
+		if e.ActiveResult != nil {
+			activeConf[key] = append(activeConf[key], e.ActiveResult.Confidence)
+		}
+		if e.CandidateResult == nil {
+			report.CandidateErrors++
+			continue
+		}
+		candidateConf[key] = append(candidateConf[key], e.CandidateResult.Confidence)
+
+		if e.Agreed {
+			report.Agreements++
+		} else if len(report.Disagreements) < maxSamples {
+			report.Disagreements = append(report.Disagreements, e)
+		}
+	}
+
+	reports := make([]*models.ShadowPairReport, 0, len(pairs))
+	for key, report := range pairs {
+		// 一致率只统计候选模型成功给出结果的样本
+		if compared := report.Total - report.CandidateErrors; compared > 0 {
+			report.AgreementRate = float64(report.Agreements) / float64(compared)
+		}
+		report.ActiveConfidence = confidenceDistribution(activeConf[key])
+		report.CandidateConfidence = confidenceDistribution(candidateConf[key])
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].ActiveModel != reports[j].ActiveModel {
+			return reports[i].ActiveModel < reports[j].ActiveModel
+		}
+		return reports[i].CandidateModel < reports[j].CandidateModel
+	})
+	return reports
+}
+
+// confidenceDistribution 计算置信度的均值、极值和 0.1 步长的直方图
+func confidenceDistribution(values []float64) models.ConfidenceDistribution {
+	var dist models.ConfidenceDistribution
+	if len(values) == 0 {
+		return dist
+	}
+
+	dist.Count = len(values)
+	dist.Min, dist.Max = values[0], values[0]
+	var sum float64
+	for _, v := range values {
+		sum += v
+		if v < dist.Min {
+			dist.Min = v
+		}
+		if v > dist.Max {
+			dist.Max = v
+		}
+
+		bucket := int(v * 10)
+		if bucket < 0 {
+			bucket = 0
+		}
+		if bucket > 9 {
+			bucket = 9
+		}
+		dist.Buckets[bucket]++
+	}
+	dist.Mean = sum / float64(len(values))
+	return dist
+}
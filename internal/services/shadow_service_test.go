@@ -0,0 +1,42 @@
+package services
+
+import (
+	"patrol-cloud/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildShadowReport(t *testing.T) {
+	result := func(action, class string, confidence float64) *models.DecisionResult {
+		return &models.DecisionResult{Action: action, Class: class, Confidence: confidence}
+	}
+
+	evals := []*models.ShadowEvaluation{
+		{ActiveModel: "v1", CandidateModel: "v2", ActiveResult: result("pickup", "a", 0.95), CandidateResult: result("pickup", "a", 0.90), Agreed: true},
+		{ActiveModel: "v1", CandidateModel: "v2", ActiveResult: result("pickup", "a", 0.85), CandidateResult: result("ignore", "b", 0.55), Agreed: false},
+		{ActiveModel: "v1", CandidateModel: "v2", ActiveResult: result("pickup", "a", 0.75), CandidateError: "inference failed"},
+		{ActiveModel: "v1", CandidateModel: "v3", ActiveResult: result("ignore", "b", 0.40), CandidateResult: result("ignore", "b", 0.45), Agreed: true},
+	}
+
+	reports := buildShadowReport(evals, 5)
+	assert.Len(t, reports, 2)
+
+	v2 := reports[0]
+	assert.Equal(t, "v2", v2.CandidateModel)
+	assert.Equal(t, 3, v2.Total)
+	assert.Equal(t, 1, v2.Agreements)
+	assert.Equal(t, 1, v2.CandidateErrors)
+	assert.InDelta(t, 0.5, v2.AgreementRate, 1e-9)
+	assert.Len(t, v2.Disagreements, 1)
+	assert.Equal(t, 3, v2.ActiveConfidence.Count)
+	assert.InDelta(t, 0.85, v2.ActiveConfidence.Mean, 1e-9)
+	assert.Equal(t, 2, v2.CandidateConfidence.Count)
+	assert.Equal(t, 1, v2.CandidateConfidence.Buckets[5])
+	assert.Equal(t, 1, v2.CandidateConfidence.Buckets[9])
+
+	v3 := reports[1]
+	assert.Equal(t, "v3", v3.CandidateModel)
+	assert.InDelta(t, 1.0, v3.AgreementRate, 1e-9)
+	assert.Empty(t, v3.Disagreements)
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"patrol-cloud/internal/queue"
+	"time"
+)
+
+// ErrInvalidTaskFilter 表示批量操作的筛选条件无效
+var ErrInvalidTaskFilter = errors.New("invalid task filter")
+
+// TaskSummary 是任务列表中的一项，不含 Payload
+type TaskSummary struct {
+	ID            string               `json:"id"`
+	Kind          string               `json:"kind"`
+	State         queue.TaskState      `json:"state"`
+	Attempts      int                  `json:"attempts"`
+	NextAttemptAt time.Time            `json:"next_attempt_at"`
+	EnqueuedAt    time.Time            `json:"enqueued_at"`
+	LastError     string               `json:"last_error,omitempty"`
+	Errors        []queue.AttemptError `json:"errors,omitempty"`
+}
+
+// TaskAdminService 供管理员查看和处理后台任务队列中的待执行任务和死信
+type TaskAdminService struct {
+	queue *queue.Queue
+	spool *ImageSpool // (可选) 清除图片补传任务时一并删除暂存的图片
+}
+
+// NewTaskAdminService 创建一个新的 TaskAdminService
+func NewTaskAdminService(q *queue.Queue, spool *ImageSpool) *TaskAdminService {
+	return &TaskAdminService{queue: q, spool: spool}
+}
+
+// ParseTaskFilter 校验筛选条件，requireState 为 true 时必须指定状态 (用于批量操作，避免误操作整个队列)
+func ParseTaskFilter(state, kind string, requireState bool) (queue.Filter, error) {
+	filter := queue.Filter{State: queue.TaskState(state), Kind: kind}
+	switch filter.State {
+	case queue.StatePending, queue.StateDead:
+	case "":
+		if requireState {
+			return filter, ErrInvalidTaskFilter
+		}
+	default:
+		return filter, ErrInvalidTaskFilter
+	}
+	return filter, nil
+}
+
+// ListTasks 返回匹配筛选条件的任务摘要及各状态的任务数
+func (s *TaskAdminService) ListTasks(filter queue.Filter) ([]TaskSummary, map[queue.TaskState]int) {
+	tasks := s.queue.Find(filter)
+	summaries := make([]TaskSummary, 0, len(tasks))
+	for _, t := range tasks {
+		summaries = append(summaries, TaskSummary{
+			ID:            t.ID,
+			Kind:          t.Kind,
+			State:         t.State,
+			Attempts:      t.Attempts,
+			NextAttemptAt: t.NextAttemptAt,
+			EnqueuedAt:    t.EnqueuedAt,
+			LastError:     t.LastError(),
+			Errors:        t.Errors,
+		})
+	}
+	return summaries, s.queue.Stats()
+}
+
+// GetTask 返回任务的完整内容 (含 Payload)
+func (s *TaskAdminService) GetTask(id string) (*queue.Task, error) {
+	return s.queue.Get(id)
+}
+
+// RequeueTask 将单个任务重新排队
+func (s *TaskAdminService) RequeueTask(id, requestedBy string) error {
+	if err := s.queue.Requeue(id); err != nil {
+		return err
+	}
+	log.Printf("level=info msg=\"task requeued\" task_id=%s requested_by=%s", id, requestedBy)
+	return nil
+}
+
+// RequeueTasks 将匹配筛选条件的任务重新排队
+func (s *TaskAdminService) RequeueTasks(filter queue.Filter, requestedBy string) (int, error) {
+	n, err := s.queue.RequeueMatching(filter)
+	log.Printf("level=info msg=\"tasks requeued\" state=%s kind=%s count=%d requested_by=%s", filter.State, filter.Kind, n, requestedBy)
+	return n, err
+}
+
+// PurgeTask 删除单个任务
+func (s *TaskAdminService) PurgeTask(id, requestedBy string) error {
+	task, err := s.queue.Purge(id)
+	if err != nil {
+		return err
+	}
+	s.cleanup(task)
+	log.Printf("level=info msg=\"task purged\" task_id=%s kind=%s requested_by=%s", id, task.Kind, requestedBy)
+	return nil
+}
+
+// PurgeTasks 删除匹配筛选条件的任务
+func (s *TaskAdminService) PurgeTasks(filter queue.Filter, requestedBy string) (int, error) {
+	purged, err := s.queue.PurgeMatching(filter)
+	for _, task := range purged {
+		s.cleanup(task)
+	}
+	log.Printf("level=info msg=\"tasks purged\" state=%s kind=%s count=%d requested_by=%s", filter.State, filter.Kind, len(purged), requestedBy)
+	return len(purged), err
+}
+
+// cleanup 删除被清除任务在队列之外留下的数据
+func (s *TaskAdminService) cleanup(task *queue.Task) {
+	if task.Kind != TaskKindImageUpload || s.spool == nil {
+		return
+	}
+	var meta SpooledImage
+	if err := task.Decode(&meta); err != nil {
+		return
+	}
+	if err := s.spool.Remove(&meta); err != nil {
+		log.Printf("level=warn msg=\"failed to remove spooled image of purged task\" task_id=%s error=\"%v\"", task.ID, err)
+	}
+}
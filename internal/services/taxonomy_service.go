@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/geo"
+	"patrol-cloud/internal/models"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrCategoryNotFound    = errors.New("trash category not found")
+	ErrInvalidCategory     = errors.New("invalid trash category")
+	ErrInvalidStatsGroupBy = errors.New("invalid statistics grouping")
+)
+
+// 收集统计的分组维度
+const (
+	StatsByCategory = "category"
+	StatsByVehicle  = "vehicle"
+	StatsByZone     = "zone"
+	StatsByDay      = "day"
+)
+
+const (
+	// unclassifiedCategory 是模型类别尚未映射到分类体系时使用的统计键
+	unclassifiedCategory = "unclassified"
+	// unlocatedZone 是决策没有位置信息时使用的区域键
+	unlocatedZone = "unknown"
+	// DefaultZonePrecision 是区域统计默认使用的 geohash 位数 (约 1.2km × 0.6km)
+	DefaultZonePrecision = 6
+)
+
+// categoryIDPattern 限制类别 ID 为小写字母、数字、下划线和连字符
+var categoryIDPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// TaxonomyService 管理垃圾分类体系及模型类别映射，并基于其统计收集量
+type TaxonomyService struct {
+	repo db.Repository
+}
+
+// NewTaxonomyService 创建一个新的 TaxonomyService
+func NewTaxonomyService(repo db.Repository) *TaxonomyService {
+	return &TaxonomyService{repo: repo}
+}
+
+// ListCategories 返回所有类别及其模型类别映射
+func (s *TaxonomyService) ListCategories(ctx context.Context) ([]*models.TrashCategory, error) {
+	return s.repo.ListTrashCategories(ctx)
+}
+
+// GetCategory 返回一个类别，不存在时返回 ErrCategoryNotFound
+func (s *TaxonomyService) GetCategory(ctx context.Context, id string) (*models.TrashCategory, error) {
+	category, err := s.repo.GetTrashCategory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if category == nil {
+		return nil, ErrCategoryNotFound
+	}
+	return category, nil
+}
+
+// CreateCategory 创建类别；ID 或某个模型类别已被占用时返回 db.ErrConflict
+func (s *TaxonomyService) CreateCategory(ctx context.Context, id string, req models.TrashCategoryRequest) (*models.TrashCategory, error) {
+	if !categoryIDPattern.MatchString(id) {
+		return nil, ErrInvalidCategory
+	}
+	category, err := newTrashCategory(id, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateTrashCategory(ctx, category); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// UpdateCategory 更新类别属性并整体替换其模型类别映射
+func (s *TaxonomyService) UpdateCategory(ctx context.Context, id string, req models.TrashCategoryRequest) (*models.TrashCategory, error) {
+	category, err := newTrashCategory(id, req)
+	if err != nil {
+		return nil, err
+	}
+	found, err := s.repo.UpdateTrashCategory(ctx, category)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrCategoryNotFound
+	}
+	return category, nil
+}
+
+// DeleteCategory 删除类别，其模型类别映射一并删除
+func (s *TaxonomyService) DeleteCategory(ctx context.Context, id string) error {
+	found, err := s.repo.DeleteTrashCategory(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// newTrashCategory 校验请求并去除重复和空白的模型类别
+func newTrashCategory(id string, req models.TrashCategoryRequest) (*models.TrashCategory, error) {
+	if req.EstimatedWeightGrams < 0 || math.IsNaN(req.EstimatedWeightGrams) {
+		return nil, ErrInvalidCategory
+	}
+
+	seen := make(map[string]bool)
+	classes := []string{}
+	for _, class := range req.ModelClasses {
+		class = strings.TrimSpace(class)
+		if class == "" || seen[class] {
+			continue
+		}
+		seen[class] = true
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	return &models.TrashCategory{
+		ID:                   id,
+		NameZh:               req.NameZh,
+		NameEn:               req.NameEn,
+		Recyclable:           req.Recyclable,
+		EstimatedWeightGrams: req.EstimatedWeightGrams,
+		ModelClasses:         classes,
+	}, nil
+}
+
+// CollectionStatsQuery 描述收集统计的范围和分组方式
+type CollectionStatsQuery struct {
+	StartTime     time.Time
+	EndTime       time.Time
+	GroupBy       string
+	ZonePrecision int            // GroupBy 为 zone 时使用的 geohash 位数
+	Location      *time.Location // GroupBy 为 day 时用于划分日期的时区
+}
+
+// CollectionStats 统计时间范围内被拾取 (action 为 pickup) 的垃圾数量和估计质量
+func (s *TaxonomyService) CollectionStats(ctx context.Context, q CollectionStatsQuery) ([]*models.CollectionStat, error) {
+	if q.Location == nil {
+		q.Location = time.UTC
+	}
+	if q.ZonePrecision == 0 {
+		q.ZonePrecision = DefaultZonePrecision
+	}
+	keyOf, err := collectionKeyFunc(q)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := s.repo.ListCollectionRecords(ctx, q.StartTime, q.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	return computeCollectionStats(records, keyOf), nil
+}
+
+// collectionKeyFunc 返回按 q.GroupBy 提取分组键的函数
+func collectionKeyFunc(q CollectionStatsQuery) (func(*models.CollectionRecord) string, error) {
+	switch q.GroupBy {
+	case StatsByCategory:
+		return categoryKey, nil
+	case StatsByVehicle:
+		return func(r *models.CollectionRecord) string { return r.VehicleID }, nil
+	case StatsByZone:
+		if q.ZonePrecision < 1 || q.ZonePrecision > 12 {
+			return nil, ErrInvalidStatsGroupBy
+		}
+		return func(r *models.CollectionRecord) string {
+			if r.Location == nil {
+				return unlocatedZone
+			}
+			return geo.Geohash(*r.Location, q.ZonePrecision)
+		}, nil
+	case StatsByDay:
+		return func(r *models.CollectionRecord) string { return r.Timestamp.In(q.Location).Format("2006-01-02") }, nil
+	default:
+		return nil, ErrInvalidStatsGroupBy
+	}
+}
+
+func categoryKey(r *models.CollectionRecord) string {
+	if r.CategoryID == "" {
+		return unclassifiedCategory
+	}
+	return r.CategoryID
+}
+
+// computeCollectionStats 按 keyOf 分组累加数量和估计质量，结果按键排序
+func computeCollectionStats(records []*models.CollectionRecord, keyOf func(*models.CollectionRecord) string) []*models.CollectionStat {
+	groups := make(map[string]*models.CollectionStat)
+	grams := make(map[string]float64)
+	for _, r := range records {
+		key := keyOf(r)
+		stat, ok := groups[key]
+		if !ok {
+			stat = &models.CollectionStat{Key: key, Categories: make(map[string]int)}
+			groups[key] = stat
+		}
+		stat.Count++
+		if r.Recyclable {
+			stat.RecyclableCount++
+		}
+		stat.Categories[categoryKey(r)]++
+		grams[key] += r.EstimatedWeightGrams
+	}
+
+	stats := make([]*models.CollectionStat, 0, len(groups))
+	for key, stat := range groups {
+		stat.EstimatedMassKg = math.Round(grams[key]) / 1000
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Key < stats[j].Key })
+	return stats
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"patrol-cloud/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeCollectionStats(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+
+	day1 := time.Date(2024, 5, 1, 15, 30, 0, 0, time.UTC) // 上海时间 5 月 1 日 23:30
+	day2 := time.Date(2024, 5, 1, 16, 30, 0, 0, time.UTC) // 上海时间 5 月 2 日 00:30
+	records := []*models.CollectionRecord{
+		{VehicleID: "v1", Timestamp: day1, Class: "bottle", CategoryID: "plastic", Recyclable: true, EstimatedWeightGrams: 25},
+		{VehicleID: "v1", Timestamp: day1, Class: "bottle", CategoryID: "plastic", Recyclable: true, EstimatedWeightGrams: 25},
+		{VehicleID: "v2", Timestamp: day2, Class: "mystery"},
+	}
+
+	byCategory, err := collectionKeyFunc(CollectionStatsQuery{GroupBy: StatsByCategory})
+	require.NoError(t, err)
+	stats := computeCollectionStats(records, byCategory)
+	require.Len(t, stats, 2)
+	assert.Equal(t, "plastic", stats[0].Key)
+	assert.Equal(t, 2, stats[0].Count)
+	assert.Equal(t, 2, stats[0].RecyclableCount)
+	assert.InDelta(t, 0.05, stats[0].EstimatedMassKg, 1e-9)
+	assert.Equal(t, unclassifiedCategory, stats[1].Key)
+
+	byDay, err := collectionKeyFunc(CollectionStatsQuery{GroupBy: StatsByDay, Location: shanghai})
+	require.NoError(t, err)
+	stats = computeCollectionStats(records, byDay)
+	require.Len(t, stats, 2)
+	assert.Equal(t, "2024-05-01", stats[0].Key)
+	assert.Equal(t, map[string]int{"plastic": 2}, stats[0].Categories)
+	assert.Equal(t, "2024-05-02", stats[1].Key)
+
+	_, err = collectionKeyFunc(CollectionStatsQuery{GroupBy: "weekday"})
+	assert.ErrorIs(t, err, ErrInvalidStatsGroupBy)
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"patrol-cloud/internal/db"
+	"patrol-cloud/internal/metrics"
+	"patrol-cloud/internal/models"
+	"strings"
+	"time"
+)
+
+// maxRejectPayloadBytes 是隔离记录中保留的原始 Payload 的最大长度
+const maxRejectPayloadBytes = 16 << 10
+
+// TelemetryRejectService 校验车辆的状态上报，并将不合法的上报连同原因和原始 Payload 隔离到数据库，
+// 供排查有问题的固件
+type TelemetryRejectService struct {
+	repo      db.Repository
+	access    *AccessService
+	validator *TelemetryValidator
+	rejected  *metrics.Counter
+}
+
+// NewTelemetryRejectService 创建一个新的 TelemetryRejectService
+func NewTelemetryRejectService(repo db.Repository, access *AccessService, validator *TelemetryValidator) *TelemetryRejectService {
+	return &TelemetryRejectService{
+		repo:      repo,
+		access:    access,
+		validator: validator,
+		rejected:  metrics.Default.Counter("telemetry.rejected"),
+	}
+}
+
+// Inspect 校验一条状态上报。合法时返回解码后的状态；不合法时返回待隔离的记录 (由 Quarantine 写入)。
+func (s *TelemetryRejectService) Inspect(vehicleID, topic string, payload []byte) (*models.VehicleStatus, *models.TelemetryReject) {
+	status, err := s.validator.Validate(payload, time.Now())
+	if err == nil {
+		return status, nil
+	}
+	s.rejected.Inc()
+
+	reject := &models.TelemetryReject{
+		VehicleID: vehicleID,
+		Topic:     topic,
+		Reason:    CodePayloadMalformed,
+		Detail:    err.Error(),
+		Payload:   sanitizePayload(payload),
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		reject.Reason = verr.Code
+	}
+	return nil, reject
+}
+
+// Quarantine 写入隔离记录，失败时只记录日志
+func (s *TelemetryRejectService) Quarantine(ctx context.Context, reject *models.TelemetryReject) {
+	log.Printf("level=warn msg=\"telemetry rejected\" vehicle_id=%s reason=%s detail=\"%s\"", reject.VehicleID, reject.Reason, reject.Detail)
+	if err := s.repo.CreateTelemetryReject(ctx, reject); err != nil {
+		log.Printf("ERROR: Failed to quarantine telemetry from %s: %v", reject.VehicleID, err)
+	}
+}
+
+// ListRejects 返回车辆被隔离的状态上报 (最新的在前)，用户无权访问该车辆时返回 ErrAccessDenied
+func (s *TelemetryRejectService) ListRejects(ctx context.Context, userID, vehicleID, reason string, startTime, endTime time.Time, limit int) ([]*models.TelemetryReject, error) {
+	if err := s.access.CheckVehicleAccess(ctx, userID, vehicleID); err != nil {
+		return nil, err
+	}
+	rejects, err := s.repo.ListTelemetryRejects(ctx, vehicleID, reason, startTime, endTime, limit)
+	if rejects == nil {
+		rejects = []*models.TelemetryReject{}
+	}
+	return rejects, err
+}
+
+// CountRejects 按车辆和原因统计时间范围内的隔离次数
+func (s *TelemetryRejectService) CountRejects(ctx context.Context, startTime, endTime time.Time) ([]*models.TelemetryRejectCount, error) {
+	counts, err := s.repo.CountTelemetryRejects(ctx, startTime, endTime)
+	if counts == nil {
+		counts = []*models.TelemetryRejectCount{}
+	}
+	return counts, err
+}
+
+// sanitizePayload 将原始 Payload 转换为可存入 TEXT 列的字符串：截断过长的内容，替换非法 UTF-8 和 NUL 字符
+func sanitizePayload(payload []byte) string {
+	if len(payload) > maxRejectPayloadBytes {
+		payload = payload[:maxRejectPayloadBytes]
+	}
+	s := strings.ToValidUTF8(string(payload), "�")
+	return strings.ReplaceAll(s, "\x00", "�")
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"encoding/json"
+	"patrol-cloud/internal/models"
+	"time"
+)
+
+// 遥测校验错误码 (另见 CodeTimestampOutOfRange)，同时作为隔离记录的原因
+const (
+	CodePayloadMalformed   = "payload_malformed"
+	CodePositionOutOfRange = "position_out_of_range"
+	CodeBatteryOutOfRange  = "battery_out_of_range"
+	CodeUnknownState       = "unknown_state"
+)
+
+// knownVehicleStates 是 design.md 3.1.1 定义的状态枚举
+var knownVehicleStates = map[string]bool{
+	models.VehicleStateIdle:                 true,
+	models.VehicleStatePlanning:             true,
+	models.VehicleStateNavigating:           true,
+	models.VehicleStateOperating:            true,
+	models.VehicleStateAwaitingConfirmation: true,
+	models.VehicleStateError:                true,
+}
+
+// TelemetryLimits 是状态上报的校验阈值
+type TelemetryLimits struct {
+	MaxClockSkew time.Duration // 时间戳最多可超前服务器时间多久
+	MaxAge       time.Duration // 时间戳最多可落后服务器时间多久 (边缘端重连后会补发离线期间的状态)
+}
+
+// DefaultTelemetryLimits 是未显式配置时使用的校验阈值
+var DefaultTelemetryLimits = TelemetryLimits{
+	MaxClockSkew: 5 * time.Minute,
+	MaxAge:       7 * 24 * time.Hour,
+}
+
+// TelemetryValidator 校验车辆通过 MQTT 上报的状态
+type TelemetryValidator struct {
+	limits TelemetryLimits
+}
+
+// NewTelemetryValidator 创建一个新的 TelemetryValidator
+func NewTelemetryValidator(limits TelemetryLimits) *TelemetryValidator {
+	return &TelemetryValidator{limits: limits}
+}
+
+// Validate 解码并校验一条状态上报，不合法时返回 *ValidationError
+func (v *TelemetryValidator) Validate(payload []byte, now time.Time) (*models.VehicleStatus, error) {
+	var status models.VehicleStatus
+	if err := json.Unmarshal(payload, &status); err != nil {
+		return nil, &ValidationError{Code: CodePayloadMalformed, Field: "payload", Message: err.Error()}
+	}
+
+	ts := time.Unix(status.Timestamp, 0)
+	if status.Timestamp <= 0 || ts.After(now.Add(v.limits.MaxClockSkew)) || ts.Before(now.Add(-v.limits.MaxAge)) {
+		return nil, &ValidationError{
+			Code:    CodeTimestampOutOfRange,
+			Field:   "timestamp",
+			Message: "timestamp is missing or too far from server time",
+			Details: map[string]interface{}{"timestamp": status.Timestamp, "server_time": now.Unix()},
+		}
+	}
+
+	if p := status.Position; p.Lat < -90 || p.Lat > 90 || p.Lng < -180 || p.Lng > 180 {
+		return nil, &ValidationError{
+			Code:    CodePositionOutOfRange,
+			Field:   "position",
+			Message: "position is out of range",
+			Details: map[string]interface{}{"lat": p.Lat, "lng": p.Lng},
+		}
+	}
+
+	if status.Battery < 0 || status.Battery > 100 {
+		return nil, &ValidationError{
+			Code:    CodeBatteryOutOfRange,
+			Field:   "battery",
+			Message: "battery must be between 0 and 100",
+			Details: map[string]interface{}{"battery": status.Battery},
+		}
+	}
+
+	if !knownVehicleStates[status.State] {
+		return nil, &ValidationError{
+			Code:    CodeUnknownState,
+			Field:   "state",
+			Message: "state is not a known vehicle state",
+			Details: map[string]interface{}{"state": status.State},
+		}
+	}
+
+	return &status, nil
+}
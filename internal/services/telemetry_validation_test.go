@@ -0,0 +1,39 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemetryValidator(t *testing.T) {
+	v := NewTelemetryValidator(DefaultTelemetryLimits)
+	now := time.Unix(1700000000, 0)
+
+	status, err := v.Validate([]byte(`{"timestamp":1699999990,"position":{"lat":31.2,"lng":121.5},"battery":88,"state":"NAVIGATING"}`), now)
+	require.NoError(t, err)
+	assert.Equal(t, "NAVIGATING", status.State)
+
+	cases := map[string]struct {
+		payload string
+		code    string
+	}{
+		"malformed":      {`{"timestamp":`, CodePayloadMalformed},
+		"zero timestamp": {`{"timestamp":0,"battery":50,"state":"IDLE"}`, CodeTimestampOutOfRange},
+		"future":         {`{"timestamp":1700003600,"battery":50,"state":"IDLE"}`, CodeTimestampOutOfRange},
+		"latitude":       {`{"timestamp":1700000000,"position":{"lat":91,"lng":0},"battery":50,"state":"IDLE"}`, CodePositionOutOfRange},
+		"battery":        {`{"timestamp":1700000000,"battery":130,"state":"IDLE"}`, CodeBatteryOutOfRange},
+		"state":          {`{"timestamp":1700000000,"battery":50,"state":"DANCING"}`, CodeUnknownState},
+	}
+	for name, tc := range cases {
+		_, err := v.Validate([]byte(tc.payload), now)
+		var verr *ValidationError
+		require.ErrorAs(t, err, &verr, name)
+		assert.Equal(t, tc.code, verr.Code, name)
+	}
+
+	// 隔离记录中的 Payload 可以安全地写入 TEXT 列
+	assert.Equal(t, "a�b", sanitizePayload([]byte("a\x00b")))
+}
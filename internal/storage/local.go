@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSignature 表示本地后端的下载链接签名无效或已过期
+var ErrInvalidSignature = errors.New("invalid or expired signature")
+
+// LocalStore 是 ObjectStore 的本地目录实现，对象保存为 <root>/<bucket>/<name>，
+// 适用于开发和测试环境。下载链接由服务自身提供 (见 api.ObjectHandler)，以 HMAC 签名防止伪造。
+type LocalStore struct {
+	root    string
+	baseURL string // 对象下载地址的前缀，如 http://localhost:8888/objects
+	secret  []byte
+}
+
+var _ ObjectStore = (*LocalStore)(nil)
+
+// NewLocalStore 创建本地后端，root 目录不存在时自动创建
+func NewLocalStore(root, baseURL string, secret []byte) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	log.Printf("INFO: Local object store at %s", root)
+	return &LocalStore{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+	}, nil
+}
+
+// objectPath 返回对象对应的文件路径，拒绝会逃出 Bucket 目录的名称
+func (s *LocalStore) objectPath(bucket, name string) (string, error) {
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || bucket == "." || bucket == ".." {
+		return "", fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	if name == "" || strings.HasPrefix(name, "/") || path.Clean(name) != name || strings.HasPrefix(name, "../") || name == ".." {
+		return "", fmt.Errorf("invalid object name %q", name)
+	}
+	return filepath.Join(s.root, bucket, filepath.FromSlash(name)), nil
+}
+
+// Put 将对象写入临时文件后原子地重命名，避免读到写了一半的对象
+func (s *LocalStore) Put(ctx context.Context, bucket, name string, reader io.Reader, size int64, contentType string) (string, error) {
+	p, err := s.objectPath(bucket, name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if size >= 0 && written != size {
+		return "", fmt.Errorf("short upload for %s: wrote %d of %d bytes", name, written, size)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return "", err
+	}
+
+	return s.objectURL(bucket, name), nil
+}
+
+// Get 打开对象文件
+func (s *LocalStore) Get(ctx context.Context, bucket, name string) (io.ReadCloser, *ObjectInfo, error) {
+	p, err := s.objectPath(bucket, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, translateFSError(err)
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		f.Close()
+		return nil, nil, ErrObjectNotFound
+	}
+	return f, localObjectInfo(bucket, name, fi), nil
+}
+
+// Delete 删除对象文件
+func (s *LocalStore) Delete(ctx context.Context, bucket, name string) error {
+	p, err := s.objectPath(bucket, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Stat 返回对象的元信息，内容类型由扩展名推断
+func (s *LocalStore) Stat(ctx context.Context, bucket, name string) (*ObjectInfo, error) {
+	p, err := s.objectPath(bucket, name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, translateFSError(err)
+	}
+	if fi.IsDir() {
+		return nil, ErrObjectNotFound
+	}
+	return localObjectInfo(bucket, name, fi), nil
+}
+
+// List 遍历 Bucket 目录，返回以 prefix 开头的对象 (忽略未完成的临时文件)
+func (s *LocalStore) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	dir, err := s.objectPath(bucket, "x")
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Dir(dir)
+
+	var objects []ObjectInfo
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, *localObjectInfo(bucket, name, fi))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+// PresignGet 生成带过期时间和 HMAC 签名的下载链接
+func (s *LocalStore) PresignGet(ctx context.Context, bucket, name string, expiry time.Duration) (string, error) {
+	if _, err := s.objectPath(bucket, name); err != nil {
+		return "", err
+	}
+	expires := time.Now().Add(expiry).Unix()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("signature", s.sign(bucket, name, expires))
+	return s.objectURL(bucket, name) + "?" + q.Encode(), nil
+}
+
+// VerifySignature 校验 PresignGet 生成的链接参数
+func (s *LocalStore) VerifySignature(bucket, name, expires, signature string) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(bucket, name, exp))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (s *LocalStore) sign(bucket, name string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "GET\n%s/%s\n%d", bucket, name, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *LocalStore) objectURL(bucket, name string) string {
+	return s.baseURL + "/" + url.PathEscape(bucket) + "/" + (&url.URL{Path: name}).EscapedPath()
+}
+
+func localObjectInfo(bucket, name string, fi fs.FileInfo) *ObjectInfo {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &ObjectInfo{
+		Bucket:       bucket,
+		Name:         name,
+		Size:         fi.Size(),
+		ContentType:  contentType,
+		LastModified: fi.ModTime(),
+	}
+}
+
+func translateFSError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrObjectNotFound
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8888/objects/", []byte("secret"))
+	require.NoError(t, err)
+
+	objectURL, err := PutBytes(ctx, store, "decisions", "thumbnails/a.jpg", []byte("thumb"), "image/jpeg")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8888/objects/decisions/thumbnails/a.jpg", objectURL)
+	_, err = PutBytes(ctx, store, "decisions", "a.png", []byte("image"), "image/png")
+	require.NoError(t, err)
+
+	data, err := GetBytes(ctx, store, "decisions", "a.png")
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(data))
+
+	info, err := store.Stat(ctx, "decisions", "thumbnails/a.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size)
+	assert.Equal(t, "image/jpeg", info.ContentType)
+
+	objects, err := store.List(ctx, "decisions", "thumbnails/")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "thumbnails/a.jpg", objects[0].Name)
+
+	objects, err = store.List(ctx, "missing-bucket", "")
+	require.NoError(t, err)
+	assert.Empty(t, objects)
+
+	require.NoError(t, store.Delete(ctx, "decisions", "a.png"))
+	require.NoError(t, store.Delete(ctx, "decisions", "a.png"))
+	_, err = store.Stat(ctx, "decisions", "a.png")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+
+	for _, bad := range []string{"../escape", "a/../../escape", "/abs", ""} {
+		_, err := PutBytes(ctx, store, "decisions", bad, []byte("x"), "text/plain")
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestLocalStorePresign(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8888/objects", []byte("secret"))
+	require.NoError(t, err)
+
+	link, err := store.PresignGet(context.Background(), "exports", "e1.zip", time.Minute)
+	require.NoError(t, err)
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(u.Path, "/exports/e1.zip"))
+
+	q := u.Query()
+	assert.NoError(t, store.VerifySignature("exports", "e1.zip", q.Get("expires"), q.Get("signature")))
+	assert.ErrorIs(t, store.VerifySignature("exports", "e2.zip", q.Get("expires"), q.Get("signature")), ErrInvalidSignature)
+	assert.ErrorIs(t, store.VerifySignature("exports", "e1.zip", "1", q.Get("signature")), ErrInvalidSignature)
+}
@@ -1,22 +1,27 @@
 package storage
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log"
-	"github.com/minio/minio-go/v7"
 	"net/url"
+	"sort"
+	"time"
+
+	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
-// MinIOClient (4.2.1) 封装了 MinIO 客户端
+// MinIOClient (4.2.1) 封装了 MinIO 客户端，是 ObjectStore 的 MinIO 实现
 type MinIOClient struct {
 	client   *minio.Client
 	endpoint string
 	useSSL   bool
 }
 
+var _ ObjectStore = (*MinIOClient)(nil)
+
 func NewMinIOClient(endpoint, accessKey, secretKey string, useSSL bool) (*MinIOClient, error) {
 	minioClient, err := minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
@@ -25,14 +30,14 @@ func NewMinIOClient(endpoint, accessKey, secretKey string, useSSL bool) (*MinIOC
 	if err != nil {
 		return nil, err
 	}
-	
+
 	log.Println("INFO: MinIO client connected")
 	return &MinIOClient{client: minioClient, endpoint: endpoint, useSSL: useSSL}, nil
 }
 
-// Upload (4.2.3) 上传文件到 MinIO
-func (s *MinIOClient) Upload(ctx context.Context, bucketName, objectName string, data []byte, contentType string) (string, error) {
-	
+// Put (4.2.3) 以流的方式上传文件到 MinIO
+func (s *MinIOClient) Put(ctx context.Context, bucketName, objectName string, reader io.Reader, size int64, contentType string) (string, error) {
+
 	// (确保 Bucket 存在)
 	err := s.client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{})
 	if err != nil {
@@ -42,18 +47,16 @@ func (s *MinIOClient) Upload(ctx context.Context, bucketName, objectName string,
 		}
 	}
 
-	reader := bytes.NewReader(data)
-	
-	info, err := s.client.PutObject(ctx, bucketName, objectName, reader, int64(len(data)), minio.PutObjectOptions{
+	info, err := s.client.PutObject(ctx, bucketName, objectName, reader, size, minio.PutObjectOptions{
 		ContentType: contentType,
 	})
-	
+
 	if err != nil {
 		return "", err
 	}
 
 	log.Printf("INFO: Successfully uploaded %s to MinIO. Size: %d", objectName, info.Size)
-	
+
 	// 返回可公开访问的 URL (或签名 URL)
 	url := &url.URL{
 		Scheme: "http",
@@ -65,3 +68,83 @@ func (s *MinIOClient) Upload(ctx context.Context, bucketName, objectName string,
 	}
 	return url.String(), nil
 }
+
+// Get 打开 MinIO 中的一个对象
+func (s *MinIOClient) Get(ctx context.Context, bucketName, objectName string) (io.ReadCloser, *ObjectInfo, error) {
+	obj, err := s.client.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, translateMinIOError(err)
+	}
+	// GetObject 是惰性的，Stat 才会真正访问服务端
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, nil, translateMinIOError(err)
+	}
+	return obj, minioObjectInfo(bucketName, stat), nil
+}
+
+// Delete 删除 MinIO 中的一个对象
+func (s *MinIOClient) Delete(ctx context.Context, bucketName, objectName string) error {
+	err := s.client.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{})
+	if err := translateMinIOError(err); err != nil && err != ErrObjectNotFound {
+		return err
+	}
+	return nil
+}
+
+// Stat 返回 MinIO 中一个对象的元信息
+func (s *MinIOClient) Stat(ctx context.Context, bucketName, objectName string) (*ObjectInfo, error) {
+	stat, err := s.client.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, translateMinIOError(err)
+	}
+	return minioObjectInfo(bucketName, stat), nil
+}
+
+// List 列出 Bucket 中以 prefix 开头的所有对象
+func (s *MinIOClient) List(ctx context.Context, bucketName, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for obj := range s.client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			if err := translateMinIOError(obj.Err); err == ErrObjectNotFound {
+				return nil, nil
+			}
+			return nil, obj.Err
+		}
+		objects = append(objects, *minioObjectInfo(bucketName, obj))
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+// PresignGet 生成一个在 expiry 内有效的对象下载链接
+func (s *MinIOClient) PresignGet(ctx context.Context, bucketName, objectName string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, bucketName, objectName, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func minioObjectInfo(bucketName string, obj minio.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Bucket:       bucketName,
+		Name:         obj.Key,
+		Size:         obj.Size,
+		ContentType:  obj.ContentType,
+		LastModified: obj.LastModified,
+	}
+}
+
+// translateMinIOError 将对象或 Bucket 不存在的错误转换为 ErrObjectNotFound
+func translateMinIOError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket":
+		return ErrObjectNotFound
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrObjectNotFound 表示对象 (或其所在的 Bucket) 不存在
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo 是对象的元信息
+type ObjectInfo struct {
+	Bucket       string    `json:"bucket"`
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ObjectStore 抽象了对象存储，由 MinIO 和本地目录两种后端实现
+type ObjectStore interface {
+	// Put 写入对象 (Bucket 不存在时自动创建)，返回对象的 URL
+	Put(ctx context.Context, bucket, name string, reader io.Reader, size int64, contentType string) (string, error)
+	// Get 打开对象用于读取，调用方负责关闭；对象不存在时返回 ErrObjectNotFound
+	Get(ctx context.Context, bucket, name string) (io.ReadCloser, *ObjectInfo, error)
+	// Delete 删除对象，对象不存在时不视为错误
+	Delete(ctx context.Context, bucket, name string) error
+	// Stat 返回对象的元信息，对象不存在时返回 ErrObjectNotFound
+	Stat(ctx context.Context, bucket, name string) (*ObjectInfo, error)
+	// List 列出 Bucket 中以 prefix 开头的所有对象，按名称排序
+	List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error)
+	// PresignGet 生成一个在 expiry 内有效的下载链接
+	PresignGet(ctx context.Context, bucket, name string, expiry time.Duration) (string, error)
+}
+
+// PutBytes 将内存中的数据写入对象
+func PutBytes(ctx context.Context, store ObjectStore, bucket, name string, data []byte, contentType string) (string, error) {
+	return store.Put(ctx, bucket, name, bytes.NewReader(data), int64(len(data)), contentType)
+}
+
+// GetBytes 读取对象的全部内容
+func GetBytes(ctx context.Context, store ObjectStore, bucket, name string) ([]byte, error) {
+	rc, _, err := store.Get(ctx, bucket, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,3 @@
+-- 000006_create_shadow_evaluations_table.down.sql
+
+DROP TABLE IF EXISTS shadow_evaluations;
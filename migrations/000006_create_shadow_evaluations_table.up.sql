@@ -0,0 +1,18 @@
+-- 000006_create_shadow_evaluations_table.up.sql
+
+CREATE TABLE IF NOT EXISTS shadow_evaluations (
+    id BIGSERIAL PRIMARY KEY,
+    decision_id VARCHAR(255) NOT NULL,
+    vehicle_id VARCHAR(255) NOT NULL,
+    active_model VARCHAR(255) NOT NULL,
+    candidate_model VARCHAR(255) NOT NULL,
+    active_result JSONB NOT NULL,
+    candidate_result JSONB,
+    candidate_error TEXT,
+    agreed BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- 报告按时间范围查询，并按模型对聚合
+CREATE INDEX IF NOT EXISTS idx_shadow_evaluations_created_at ON shadow_evaluations(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_shadow_evaluations_decision_id ON shadow_evaluations(decision_id);
@@ -0,0 +1,3 @@
+-- 000007_create_decision_labels_table.down.sql
+
+DROP TABLE IF EXISTS decision_labels;
@@ -0,0 +1,12 @@
+-- 000007_create_decision_labels_table.up.sql
+
+CREATE TABLE IF NOT EXISTS decision_labels (
+    decision_id VARCHAR(255) PRIMARY KEY REFERENCES decision_logs(id) ON DELETE CASCADE,
+    correct_action VARCHAR(255) NOT NULL,
+    corrected_class VARCHAR(255),
+    bounding_boxes JSONB NOT NULL DEFAULT '[]',
+    notes TEXT,
+    labelled_by VARCHAR(255) NOT NULL,
+    labelled_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- 000008_create_dataset_exports_table.down.sql
+
+DROP TABLE IF EXISTS dataset_exports;
@@ -0,0 +1,13 @@
+-- 000008_create_dataset_exports_table.up.sql
+
+CREATE TABLE IF NOT EXISTS dataset_exports (
+    id VARCHAR(255) PRIMARY KEY,
+    status VARCHAR(32) NOT NULL,
+    filter JSONB NOT NULL,
+    object_name VARCHAR(255),
+    image_count INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
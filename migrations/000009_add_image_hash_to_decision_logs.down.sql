@@ -0,0 +1,4 @@
+-- 000009_add_image_hash_to_decision_logs.down.sql
+
+DROP INDEX IF EXISTS idx_decision_logs_vehicle_id_timestamp;
+ALTER TABLE decision_logs DROP COLUMN IF EXISTS image_hash;
@@ -0,0 +1,6 @@
+-- 000009_add_image_hash_to_decision_logs.up.sql
+
+-- 64 位感知哈希按位存入 BIGINT，用于识别同一车辆的重复决策请求
+ALTER TABLE decision_logs ADD COLUMN IF NOT EXISTS image_hash BIGINT;
+
+CREATE INDEX IF NOT EXISTS idx_decision_logs_vehicle_id_timestamp ON decision_logs(vehicle_id, "timestamp" DESC);
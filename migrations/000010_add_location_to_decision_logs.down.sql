@@ -0,0 +1,7 @@
+-- 000010_add_location_to_decision_logs.down.sql
+
+DROP INDEX IF EXISTS idx_decision_logs_timestamp_located;
+ALTER TABLE decision_logs
+    DROP COLUMN IF EXISTS location_source,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS latitude;
@@ -0,0 +1,9 @@
+-- 000010_add_location_to_decision_logs.up.sql
+
+-- 决策发生的位置：来自请求元数据，或由车辆遥测轨迹插值得到
+ALTER TABLE decision_logs
+    ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS location_source VARCHAR(32);
+
+CREATE INDEX IF NOT EXISTS idx_decision_logs_timestamp_located ON decision_logs("timestamp") WHERE latitude IS NOT NULL;
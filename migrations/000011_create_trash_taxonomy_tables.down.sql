@@ -0,0 +1,4 @@
+-- 000011_create_trash_taxonomy_tables.down.sql
+
+DROP TABLE IF EXISTS trash_class_mappings;
+DROP TABLE IF EXISTS trash_categories;
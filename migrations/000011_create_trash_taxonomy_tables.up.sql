@@ -0,0 +1,20 @@
+-- 000011_create_trash_taxonomy_tables.up.sql
+
+-- 受管理的垃圾分类体系
+CREATE TABLE IF NOT EXISTS trash_categories (
+    id VARCHAR(64) PRIMARY KEY,
+    name_zh VARCHAR(255) NOT NULL,
+    name_en VARCHAR(255) NOT NULL,
+    recyclable BOOLEAN NOT NULL DEFAULT FALSE,
+    estimated_weight_grams DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- 模型输出类别 (server_decision->>'class') 到分类体系的映射，一个模型类别只属于一个类别
+CREATE TABLE IF NOT EXISTS trash_class_mappings (
+    model_class VARCHAR(255) PRIMARY KEY,
+    category_id VARCHAR(64) NOT NULL REFERENCES trash_categories(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_trash_class_mappings_category_id ON trash_class_mappings(category_id);
@@ -0,0 +1,5 @@
+-- 000012_add_derivative_urls_to_decision_logs.down.sql
+
+ALTER TABLE decision_logs
+    DROP COLUMN IF EXISTS preview_url,
+    DROP COLUMN IF EXISTS thumbnail_url;
@@ -0,0 +1,6 @@
+-- 000012_add_derivative_urls_to_decision_logs.up.sql
+
+-- 由决策图片派生的缩略图和预览图，历史记录或生成失败时为空字符串
+ALTER TABLE decision_logs
+    ADD COLUMN IF NOT EXISTS thumbnail_url VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS preview_url VARCHAR(255) NOT NULL DEFAULT '';
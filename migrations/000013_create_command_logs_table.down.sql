@@ -0,0 +1,3 @@
+-- 000013_create_command_logs_table.down.sql
+
+DROP TABLE IF EXISTS command_logs;
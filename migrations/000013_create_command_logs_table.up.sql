@@ -0,0 +1,15 @@
+-- 000013_create_command_logs_table.up.sql
+
+-- 下发给车辆的宏观指令，用于审计和证据导出
+CREATE TABLE IF NOT EXISTS command_logs (
+    id VARCHAR(255) PRIMARY KEY,
+    vehicle_id VARCHAR(255) NOT NULL,
+    command VARCHAR(255) NOT NULL,
+    task_id VARCHAR(255),
+    issued_by VARCHAR(255),
+    status VARCHAR(32) NOT NULL,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_command_logs_vehicle_id_created_at ON command_logs(vehicle_id, created_at DESC);
@@ -0,0 +1,20 @@
+-- 000014_add_image_keys_and_vehicle_access.down.sql
+
+DROP TABLE IF EXISTS user_vehicle_access;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
+
+-- 无法恢复原始的 endpoint，回退为相对路径 /decisions/<key>
+ALTER TABLE decision_logs
+    ADD COLUMN IF NOT EXISTS image_url VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS thumbnail_url VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS preview_url VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE decision_logs SET
+    image_url = CASE WHEN image_key <> '' THEN '/decisions/' || image_key ELSE '' END,
+    thumbnail_url = CASE WHEN thumbnail_key <> '' THEN '/decisions/' || thumbnail_key ELSE '' END,
+    preview_url = CASE WHEN preview_key <> '' THEN '/decisions/' || preview_key ELSE '' END;
+
+ALTER TABLE decision_logs
+    DROP COLUMN IF EXISTS image_key,
+    DROP COLUMN IF EXISTS thumbnail_key,
+    DROP COLUMN IF EXISTS preview_key;
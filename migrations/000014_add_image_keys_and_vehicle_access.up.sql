@@ -0,0 +1,31 @@
+-- 000014_add_image_keys_and_vehicle_access.up.sql
+
+-- 决策图片改为保存对象名 (decisions Bucket 内的 key)，URL 在响应时按需生成
+ALTER TABLE decision_logs
+    ADD COLUMN IF NOT EXISTS image_key VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS thumbnail_key VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS preview_key VARCHAR(255) NOT NULL DEFAULT '';
+
+-- 旧记录的 URL 形如 http(s)://<endpoint>/decisions/<key>
+UPDATE decision_logs SET
+    image_key = COALESCE(substring(image_url FROM '/decisions/(.+)$'), ''),
+    thumbnail_key = COALESCE(substring(thumbnail_url FROM '/decisions/(.+)$'), ''),
+    preview_key = COALESCE(substring(preview_url FROM '/decisions/(.+)$'), '');
+
+ALTER TABLE decision_logs
+    DROP COLUMN IF EXISTS image_url,
+    DROP COLUMN IF EXISTS thumbnail_url,
+    DROP COLUMN IF EXISTS preview_url;
+
+-- 用户角色：admin 可访问所有车辆，operator 只能访问被授权的车辆。
+-- 只有初始化创建的 admin 账号提升为管理员，其余已有用户默认为 operator，
+-- 需要由管理员授权车辆 (或手动 UPDATE users SET role = 'admin' 提升)。
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'operator';
+UPDATE users SET role = 'admin' WHERE username = 'admin';
+
+CREATE TABLE IF NOT EXISTS user_vehicle_access (
+    user_id VARCHAR(255) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    vehicle_id VARCHAR(255) NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, vehicle_id)
+);
@@ -0,0 +1,5 @@
+-- 000015_create_telemetry_rollups_table.down.sql
+
+DROP INDEX IF EXISTS idx_decision_logs_timestamp_with_image;
+DROP INDEX IF EXISTS idx_vehicle_telemetry_timestamp;
+DROP TABLE IF EXISTS telemetry_rollups_hourly;
@@ -0,0 +1,22 @@
+-- 000015_create_telemetry_rollups_table.up.sql
+
+-- 原始遥测超过保留期后按小时汇总到此表再删除，汇总数据保留更长时间
+CREATE TABLE IF NOT EXISTS telemetry_rollups_hourly (
+    vehicle_id VARCHAR(255) NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    bucket_start TIMESTAMPTZ NOT NULL,
+    sample_count INTEGER NOT NULL,
+    avg_latitude DOUBLE PRECISION NOT NULL,
+    avg_longitude DOUBLE PRECISION NOT NULL,
+    avg_battery DOUBLE PRECISION NOT NULL,
+    min_battery DOUBLE PRECISION NOT NULL,
+    max_battery DOUBLE PRECISION NOT NULL,
+    last_state VARCHAR(255) NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (vehicle_id, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_telemetry_rollups_hourly_bucket_start ON telemetry_rollups_hourly(bucket_start);
+
+-- 保留期任务按时间范围扫描原始遥测和决策图片
+CREATE INDEX IF NOT EXISTS idx_vehicle_telemetry_timestamp ON vehicle_telemetry("timestamp");
+CREATE INDEX IF NOT EXISTS idx_decision_logs_timestamp_with_image ON decision_logs("timestamp") WHERE image_key <> '';
@@ -0,0 +1,3 @@
+-- 000016_create_outbox_table.down.sql
+
+DROP TABLE IF EXISTS outbox;
@@ -0,0 +1,18 @@
+-- 000016_create_outbox_table.up.sql
+
+-- 事务性发件箱：与领域数据在同一事务中写入的后台工作，由各副本的分发器以
+-- SELECT ... FOR UPDATE SKIP LOCKED 领取 (同时将 available_at 推迟作为租约) 后在事务外执行，成功后删除。
+-- 超过最大尝试次数的消息标记 dead_at 后保留，供人工排查。
+-- 消息只保存引用 (如对象名)，大的二进制数据放在对象存储中。
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    available_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    dead_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_available_at ON outbox(available_at, id) WHERE dead_at IS NULL;
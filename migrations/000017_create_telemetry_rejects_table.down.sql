@@ -0,0 +1,3 @@
+-- 000017_create_telemetry_rejects_table.down.sql
+
+DROP TABLE IF EXISTS telemetry_rejects;
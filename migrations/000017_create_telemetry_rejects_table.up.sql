@@ -0,0 +1,16 @@
+-- 000017_create_telemetry_rejects_table.up.sql
+
+-- 未通过校验的车辆状态上报，保留原始 Payload 用于排查固件问题。
+-- vehicle_id 取自主题，可能是未登记的车辆，因此不设外键。
+CREATE TABLE IF NOT EXISTS telemetry_rejects (
+    id BIGSERIAL PRIMARY KEY,
+    vehicle_id VARCHAR(255) NOT NULL,
+    topic VARCHAR(255) NOT NULL,
+    reason VARCHAR(64) NOT NULL,
+    detail TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_telemetry_rejects_vehicle_id_received_at ON telemetry_rejects(vehicle_id, received_at DESC);
+CREATE INDEX IF NOT EXISTS idx_telemetry_rejects_received_at ON telemetry_rejects(received_at);
@@ -0,0 +1,4 @@
+-- 000018_add_unique_vehicle_telemetry_timestamp.down.sql
+
+CREATE INDEX IF NOT EXISTS idx_vehicle_telemetry_vehicle_id_timestamp ON vehicle_telemetry(vehicle_id, "timestamp" DESC);
+ALTER TABLE vehicle_telemetry DROP CONSTRAINT IF EXISTS uq_vehicle_telemetry_vehicle_id_timestamp;
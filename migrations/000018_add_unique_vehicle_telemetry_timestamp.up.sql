@@ -0,0 +1,11 @@
+-- 000018_add_unique_vehicle_telemetry_timestamp.up.sql
+
+-- QoS1 重复投递和边缘端重连后的补发会产生同一时刻的重复遥测，先保留最早写入的一条
+DELETE FROM vehicle_telemetry t
+USING vehicle_telemetry d
+WHERE t.vehicle_id = d.vehicle_id AND t."timestamp" = d."timestamp" AND t.id > d.id;
+
+-- 每辆车每个时刻只有一条遥测，写入时以此去重；唯一约束的索引同时替代原有的查询索引
+ALTER TABLE vehicle_telemetry
+    ADD CONSTRAINT uq_vehicle_telemetry_vehicle_id_timestamp UNIQUE (vehicle_id, "timestamp");
+DROP INDEX IF EXISTS idx_vehicle_telemetry_vehicle_id_timestamp;
@@ -0,0 +1,3 @@
+-- 000019_add_last_seen_at_to_vehicles.down.sql
+
+ALTER TABLE vehicles DROP COLUMN IF EXISTS last_seen_at;
@@ -0,0 +1,4 @@
+-- 000019_add_last_seen_at_to_vehicles.up.sql
+
+-- 服务器最后一次收到车辆消息的时间，重启后据此恢复车辆的在线状态
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;